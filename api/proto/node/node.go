@@ -2,9 +2,12 @@ package node
 
 import (
 	"bytes"
+	"errors"
 	"log"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/golang/snappy"
 	"github.com/harmony-one/harmony/api/proto"
 	"github.com/harmony-one/harmony/block"
 	"github.com/harmony-one/harmony/consensus/engine"
@@ -26,6 +29,43 @@ const (
 	PING       // node send ip/pki to register with leader
 	ShardState // Deprecated
 	Staking
+	Envelope  // wraps a node message together with its message version
+	ChainInfo // chain state exchanged among peers
+)
+
+// String returns the name of the message type, as used in metric labels.
+func (t MessageType) String() string {
+	switch t {
+	case Transaction:
+		return "transaction"
+	case Block:
+		return "block"
+	case Client:
+		return "client"
+	case PING:
+		return "ping"
+	case ShardState:
+		return "shard_state"
+	case Staking:
+		return "staking"
+	case Envelope:
+		return "envelope"
+	case ChainInfo:
+		return "chain_info"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// MessageVersion1 is the version of node messages sent without an envelope
+	MessageVersion1 byte = 1
+	// MessageVersion2 is the version of node messages which may be of a type added after
+	// version 1, as the compressed messages, the transaction announces and the chain info.
+	// Nodes only understanding version 1 reject the envelope as an unknown message type.
+	MessageVersion2 byte = 2
+	// LatestMessageVersion is the highest node message version understood by this node
+	LatestMessageVersion = MessageVersion2
 )
 
 // TransactionMessageType representa the types of messages used for Node/Transaction
@@ -35,8 +75,16 @@ type TransactionMessageType int
 const (
 	Send TransactionMessageType = iota
 	Unlock
+	Announce       // hashes of transactions the sender has, which the receiver may request
+	Request        // request for the full transactions of announced hashes
+	SendCompressed // transaction list with a snappy compressed payload
 )
 
+// TransactionRequest asks the peer it is sent to for the transactions of Hashes, which it announced
+type TransactionRequest struct {
+	Hashes []common.Hash
+}
+
 // BlockMessageType represents the type of messages used for Node/Block
 type BlockMessageType int
 
@@ -48,8 +96,52 @@ const (
 	SlashCandidate                      // A report of a double-signing event
 	CrosslinkHeartbeat                  // Heart beat signal for crosslinks. Needed for epoch chain.
 	Epoch
+	CrosslinkAck    // beacon chain acknowledgement of accepted crosslinks
+	SyncCompressed  // blocks sync message with a snappy compressed payload
+	CrossLinkReplay // request for the crosslink messages a shard node sent recently
 )
 
+// CrossLinkReplayRequest asks the shard node it is sent to for the crosslink messages of
+// ShardID it sent covering the blocks after FromBlockNum
+type CrossLinkReplayRequest struct {
+	ShardID      uint32
+	FromBlockNum uint64
+}
+
+// String returns the name of the block message type, as used in metric labels.
+func (t BlockMessageType) String() string {
+	switch t {
+	case Sync:
+		return "sync"
+	case CrossLink:
+		return "crosslink"
+	case Receipt:
+		return "receipt"
+	case SlashCandidate:
+		return "slash_candidate"
+	case CrosslinkHeartbeat:
+		return "crosslink_heartbeat"
+	case Epoch:
+		return "epoch"
+	case CrosslinkAck:
+		return "crosslink_ack"
+	case SyncCompressed:
+		return "sync_compressed"
+	case CrossLinkReplay:
+		return "crosslink_replay"
+	default:
+		return "unknown"
+	}
+}
+
+// Known returns true if t is one of the defined block message types.
+func (t BlockMessageType) Known() bool {
+	return t >= Sync && t <= CrossLinkReplay
+}
+
+// MaxBlocksSyncSize is the largest decompressed blocks sync payload accepted
+const MaxBlocksSyncSize = 64 * 1024 * 1024
+
 var (
 	// B suffix means Byte
 	nodeB               = byte(proto.Node)
@@ -63,6 +155,14 @@ var (
 	crossLinkHeardBeatB = byte(CrosslinkHeartbeat)
 	receiptB            = byte(Receipt)
 	epochB              = byte(Epoch)
+	envelopeB           = byte(Envelope)
+	crossLinkAckB       = byte(CrosslinkAck)
+	chainInfoB          = byte(ChainInfo)
+	syncCompressedB     = byte(SyncCompressed)
+	announceB           = byte(Announce)
+	requestB            = byte(Request)
+	sendCompressedB     = byte(SendCompressed)
+	crossLinkReplayB    = byte(CrossLinkReplay)
 	// H suffix means header
 	slashH              = []byte{nodeB, blockB, slashB}
 	transactionListH    = []byte{nodeB, txnB, sendB}
@@ -72,8 +172,49 @@ var (
 	cxReceiptH          = []byte{nodeB, blockB, receiptB}
 	crossLinkHeartBeatH = []byte{nodeB, blockB, crossLinkHeardBeatB}
 	epochBlockH         = []byte{nodeB, blockB, epochB}
+	crossLinkAckH       = []byte{nodeB, blockB, crossLinkAckB}
+	chainInfoH          = []byte{nodeB, chainInfoB}
+	syncCompressedH     = []byte{nodeB, blockB, syncCompressedB}
+	txAnnounceH         = []byte{nodeB, txnB, announceB}
+	txRequestH          = []byte{nodeB, txnB, requestB}
+	txListCompressedH   = []byte{nodeB, txnB, sendCompressedB}
+	crossLinkReplayH    = []byte{nodeB, blockB, crossLinkReplayB}
 )
 
+// ChainInfo is the state of a node's chain reported to its peers
+type ChainInfo struct {
+	ShardID   uint32
+	BlockNum  uint64
+	BlockHash common.Hash
+	Epoch     uint64
+	// Request asks the receiver to respond with its own chain info, sent directly to the requester
+	Request bool
+}
+
+// ConstructEnvelope wraps the node message msg into an envelope carrying the given message version.
+// Nodes of releases before the envelope reject it, it is only to be sent once they upgraded.
+func ConstructEnvelope(version byte, msg []byte) []byte {
+	byteBuffer := bytes.NewBuffer([]byte{nodeB, envelopeB, version})
+	byteBuffer.Write(msg[proto.MessageCategoryBytes:])
+	return byteBuffer.Bytes()
+}
+
+// OpenEnvelope returns the message version and the node message wrapped in content.
+// Messages without an envelope are of MessageVersion1 and returned as they are.
+func OpenEnvelope(content []byte) (byte, []byte, error) {
+	if len(content) <= proto.MessageCategoryBytes || MessageType(content[proto.MessageCategoryBytes]) != Envelope {
+		return MessageVersion1, content, nil
+	}
+	versionIndex := proto.MessageCategoryBytes + proto.MessageTypeBytes
+	if len(content) <= versionIndex {
+		return 0, nil, errors.New("envelope without message version")
+	}
+	inner := make([]byte, 0, len(content)-proto.MessageTypeBytes-1)
+	inner = append(inner, content[:proto.MessageCategoryBytes]...)
+	inner = append(inner, content[versionIndex+1:]...)
+	return content[versionIndex], inner, nil
+}
+
 // ConstructTransactionListMessageAccount constructs serialized transactions in account model
 func ConstructTransactionListMessageAccount(transactions types.Transactions) []byte {
 	byteBuffer := bytes.NewBuffer(transactionListH)
@@ -86,6 +227,38 @@ func ConstructTransactionListMessageAccount(transactions types.Transactions) []b
 	return byteBuffer.Bytes()
 }
 
+// ConstructTransactionListMessageCompressed constructs transaction list message whose payload
+// is snappy compressed if it is at least threshold bytes, and a plain transaction list message
+// otherwise or if threshold is not positive. A compressed message is wrapped into a
+// MessageVersion2 envelope.
+func ConstructTransactionListMessageCompressed(transactions types.Transactions, threshold int) []byte {
+	txs, _ := rlp.EncodeToBytes(transactions)
+	if threshold <= 0 || len(txs) < threshold {
+		byteBuffer := bytes.NewBuffer(transactionListH)
+		byteBuffer.Write(txs)
+		return byteBuffer.Bytes()
+	}
+	byteBuffer := bytes.NewBuffer(txListCompressedH)
+	byteBuffer.Write(snappy.Encode(nil, txs))
+	return ConstructEnvelope(MessageVersion2, byteBuffer.Bytes())
+}
+
+// ConstructTransactionAnnounceMessage constructs a message announcing the hashes of transactions
+func ConstructTransactionAnnounceMessage(hashes []common.Hash) []byte {
+	byteBuffer := bytes.NewBuffer(txAnnounceH)
+	data, _ := rlp.EncodeToBytes(hashes)
+	byteBuffer.Write(data)
+	return byteBuffer.Bytes()
+}
+
+// ConstructTransactionRequestMessage constructs a message requesting announced transactions
+func ConstructTransactionRequestMessage(req TransactionRequest) []byte {
+	byteBuffer := bytes.NewBuffer(txRequestH)
+	data, _ := rlp.EncodeToBytes(req)
+	byteBuffer.Write(data)
+	return byteBuffer.Bytes()
+}
+
 // ConstructStakingTransactionListMessageAccount constructs serialized staking transactions in account model
 func ConstructStakingTransactionListMessageAccount(
 	transactions staking.StakingTransactions,
@@ -108,6 +281,59 @@ func ConstructBlocksSyncMessage(blocks []*types.Block) []byte {
 	return byteBuffer.Bytes()
 }
 
+// ConstructBlocksSyncMessageCompressed constructs blocks sync message whose payload is snappy
+// compressed if it is at least threshold bytes, and a plain blocks sync message otherwise or
+// if threshold is not positive. A compressed message is wrapped into a MessageVersion2
+// envelope.
+func ConstructBlocksSyncMessageCompressed(blocks []*types.Block, threshold int) []byte {
+	blocksData, _ := rlp.EncodeToBytes(blocks)
+	if threshold <= 0 || len(blocksData) < threshold {
+		byteBuffer := bytes.NewBuffer(syncH)
+		byteBuffer.Write(blocksData)
+		return byteBuffer.Bytes()
+	}
+	byteBuffer := bytes.NewBuffer(syncCompressedH)
+	byteBuffer.Write(snappy.Encode(nil, blocksData))
+	return ConstructEnvelope(MessageVersion2, byteBuffer.Bytes())
+}
+
+// ErrBlocksSyncTooLarge is returned for a compressed blocks sync payload which decompresses
+// to more than the size limit.
+var ErrBlocksSyncTooLarge = errors.New("decompressed blocks sync payload too large")
+
+// DecompressBlocksSync returns the RLP encoded blocks of a compressed blocks sync payload.
+// The payload is not decompressed if it is larger than maxSize decompressed, a non positive
+// maxSize uses MaxBlocksSyncSize.
+func DecompressBlocksSync(payload []byte, maxSize int) ([]byte, error) {
+	if maxSize <= 0 || maxSize > MaxBlocksSyncSize {
+		maxSize = MaxBlocksSyncSize
+	}
+	return decompress(payload, maxSize, ErrBlocksSyncTooLarge)
+}
+
+// ErrTransactionListTooLarge is returned for a compressed transaction list which decompresses
+// to more than the size limit.
+var ErrTransactionListTooLarge = errors.New("decompressed transaction list too large")
+
+// DecompressTransactionList returns the RLP encoded transactions of a compressed transaction
+// list. The payload is not decompressed if it is larger than maxSize decompressed.
+func DecompressTransactionList(payload []byte, maxSize int) ([]byte, error) {
+	return decompress(payload, maxSize, ErrTransactionListTooLarge)
+}
+
+// decompress returns the snappy compressed payload decompressed, or tooLarge if it is larger
+// than maxSize decompressed.
+func decompress(payload []byte, maxSize int, tooLarge error) ([]byte, error) {
+	n, err := snappy.DecodedLen(payload)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSize {
+		return nil, tooLarge
+	}
+	return snappy.Decode(nil, payload)
+}
+
 // ConstructSlashMessage ..
 func ConstructSlashMessage(witnesses slash.Records) []byte {
 	byteBuffer := bytes.NewBuffer(slashH)
@@ -123,25 +349,58 @@ func ConstructCrossLinkHeartBeatMessage(hb types.CrosslinkHeartbeat) []byte {
 	return byteBuffer.Bytes()
 }
 
+// ConstructCrossLinkAckMessage constructs crosslink acknowledgement message to send to shard chains
+func ConstructCrossLinkAckMessage(ack types.CrosslinkAck) []byte {
+	byteBuffer := bytes.NewBuffer(crossLinkAckH)
+	data, _ := rlp.EncodeToBytes(ack)
+	byteBuffer.Write(data)
+	return byteBuffer.Bytes()
+}
+
 // ConstructCrossLinkMessage constructs cross link message to send to beacon chain
 func ConstructCrossLinkMessage(bc engine.ChainReader, headers []*block.Header) []byte {
 	byteBuffer := bytes.NewBuffer(crossLinkH)
 	crosslinks := []*types.CrossLink{}
 	for _, header := range headers {
-		if header.Number().Uint64() <= 1 || !bc.Config().IsCrossLink(header.Epoch()) {
-			continue
-		}
-		parentHeader := bc.GetHeaderByHash(header.ParentHash())
-		if parentHeader == nil {
-			continue
+		if cl := CrossLinkOf(bc, header); cl != nil {
+			crosslinks = append(crosslinks, cl)
 		}
-		crosslinks = append(crosslinks, types.NewCrossLink(header, parentHeader))
 	}
 	crosslinksData, _ := rlp.EncodeToBytes(crosslinks)
 	byteBuffer.Write(crosslinksData)
 	return byteBuffer.Bytes()
 }
 
+// CrossLinkOf returns the crosslink of header sent to the beacon chain by
+// ConstructCrossLinkMessage, or nil if header has none
+func CrossLinkOf(bc engine.ChainReader, header *block.Header) *types.CrossLink {
+	if header.Number().Uint64() <= 1 || !bc.Config().IsCrossLink(header.Epoch()) {
+		return nil
+	}
+	parentHeader := bc.GetHeaderByHash(header.ParentHash())
+	if parentHeader == nil {
+		return nil
+	}
+	return types.NewCrossLink(header, parentHeader)
+}
+
+// ConstructCrossLinkReplayRequestMessage constructs a message requesting the crosslink
+// messages a shard node sent recently
+func ConstructCrossLinkReplayRequestMessage(req CrossLinkReplayRequest) []byte {
+	byteBuffer := bytes.NewBuffer(crossLinkReplayH)
+	data, _ := rlp.EncodeToBytes(req)
+	byteBuffer.Write(data)
+	return byteBuffer.Bytes()
+}
+
+// ConstructChainInfoMessage constructs chain info message to send to peers
+func ConstructChainInfoMessage(info ChainInfo) []byte {
+	byteBuffer := bytes.NewBuffer(chainInfoH)
+	data, _ := rlp.EncodeToBytes(info)
+	byteBuffer.Write(data)
+	return byteBuffer.Bytes()
+}
+
 // ConstructEpochBlockMessage creates epoch block message
 func ConstructEpochBlockMessage(blockBytes []byte) []byte {
 	byteBuffer := bytes.NewBuffer(epochBlockH)
@@ -260,6 +260,30 @@ func (c *BlockNumberCache) InvalidateStream(streamID sttypes.StreamID) {
 	}
 }
 
+// SetBlockNumber caches the block number a stream reported by itself, so that it is picked
+// for the targets up to blockNumber without being queried. The streams invalidated after a
+// failure are left to be queried again.
+func (c *BlockNumberCache) SetBlockNumber(streamID sttypes.StreamID, blockNumber uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, exists := c.cache[streamID]
+	if exists && !info.IsValid {
+		return
+	}
+	if !exists {
+		if len(c.cache) >= c.config.MaxSize {
+			c.evictOldestEntries()
+		}
+		info = &BlockInfo{}
+		c.cache[streamID] = info
+	}
+	info.BlockNumber = blockNumber
+	info.Timestamp = time.Now()
+	info.LastUsed = time.Now()
+	info.IsValid = true
+}
+
 // RemoveStream completely removes a stream from the cache
 func (c *BlockNumberCache) RemoveStream(streamID sttypes.StreamID) {
 	c.mu.Lock()
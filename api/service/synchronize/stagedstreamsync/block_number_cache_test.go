@@ -351,6 +351,30 @@ func TestInvalidateStream(t *testing.T) {
 	assert.False(t, info.IsValid)
 }
 
+func TestSetBlockNumber(t *testing.T) {
+	mockProtocol := &MockProtocolProvider{}
+	cache := NewBlockNumberCache(mockProtocol, nil)
+	defer cache.Stop()
+
+	streamID := sttypes.StreamID("test-stream")
+	cache.SetBlockNumber(streamID, 1200)
+
+	// The reported block number is served without querying the stream
+	blockNumber, err := cache.GetBlockNumber(context.Background(), streamID, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1200), blockNumber)
+	mockProtocol.AssertNotCalled(t, "GetCurrentBlockNumber", mock.Anything, mock.Anything)
+
+	// An invalidated stream is not made valid again by its report
+	cache.InvalidateStream(streamID)
+	cache.SetBlockNumber(streamID, 1500)
+	cache.mu.RLock()
+	info := cache.cache[streamID]
+	cache.mu.RUnlock()
+	assert.False(t, info.IsValid)
+	assert.Equal(t, uint64(1200), info.BlockNumber)
+}
+
 func TestRemoveStream(t *testing.T) {
 	mockProtocol := &MockProtocolProvider{}
 	cache := NewBlockNumberCache(mockProtocol, nil)
@@ -17,6 +17,7 @@ import (
 	"github.com/harmony-one/harmony/p2p"
 	"github.com/harmony-one/harmony/p2p/stream/common/streammanager"
 	streamSyncProtocol "github.com/harmony-one/harmony/p2p/stream/protocols/sync"
+	sttypes "github.com/harmony-one/harmony/p2p/stream/types"
 	"github.com/harmony-one/harmony/shard"
 )
 
@@ -195,6 +196,14 @@ func (d *Downloader) NumPeers() int {
 	return d.syncProtocol.NumStreams()
 }
 
+// SetPeerBlockNumber records the block number reported by the peer of stream stid, which
+// makes it a candidate for the blocks up to blockNumber.
+func (d *Downloader) SetPeerBlockNumber(stid sttypes.StreamID, blockNumber uint64) {
+	if d.stagedSyncInstance != nil && d.stagedSyncInstance.bnCache != nil {
+		d.stagedSyncInstance.bnCache.SetBlockNumber(stid, blockNumber)
+	}
+}
+
 // SyncStatus returns the current sync status
 func (d *Downloader) SyncStatus() (bool, uint64, uint64) {
 	syncing, target := d.stagedSyncInstance.status.Get()
@@ -6,6 +6,7 @@ import (
 	"github.com/harmony-one/harmony/core"
 	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
 	"github.com/harmony-one/harmony/p2p"
+	sttypes "github.com/harmony-one/harmony/p2p/stream/types"
 )
 
 // Downloaders is the set of downloaders
@@ -83,6 +84,14 @@ func (ds *Downloaders) NumPeers() map[uint32]int {
 	return res
 }
 
+// SetPeerBlockNumber records the block number reported by the peer of stream stid to the
+// downloader of the given shard.
+func (ds *Downloaders) SetPeerBlockNumber(shardID uint32, stid sttypes.StreamID, blockNumber uint64) {
+	if d, ok := ds.ds[shardID]; ok && d != nil {
+		d.SetPeerBlockNumber(stid, blockNumber)
+	}
+}
+
 // SyncStatus returns whether the given shard is doing syncing task and the target block number
 func (ds *Downloaders) SyncStatus(shardID uint32) (bool, uint64, uint64) {
 	d, ok := ds.ds[shardID]
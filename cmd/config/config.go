@@ -359,6 +359,7 @@ func applyRootFlags(cmd *cobra.Command, config *harmonyconfig.HarmonyConfig) {
 	applyShardDataFlags(cmd, config)
 	applyGPOFlags(cmd, config)
 	applyCacheFlags(cmd, config)
+	applyHandlerFlags(cmd, config)
 }
 
 func registerRootCmdFlags(rootCmd *cobra.Command) error {
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	harmonyconfig "github.com/harmony-one/harmony/internal/configs/harmony"
 	"github.com/stretchr/testify/require"
@@ -194,3 +195,58 @@ func TestPersistConfig(t *testing.T) {
 		}
 	}
 }
+
+func TestHandlerConfig(t *testing.T) {
+	testDir := filepath.Join(testBaseDir, t.Name())
+	os.RemoveAll(testDir)
+	os.MkdirAll(testDir, 0777)
+	file := filepath.Join(testDir, "test.config")
+	if err := writeHarmonyConfigToFile(GetDefaultHmyConfigCopy(nodeconfig.Mainnet), file); err != nil {
+		t.Fatal(err)
+	}
+	handler := `
+[Handler]
+  CrossLinkBatchSize = 4
+  CrossLinkBatchCapMultiplier = 2
+  CrossLinkSentWindowMultiplier = 6
+  CrossLinkBatchGrowthDivisor = 5
+  CrossLinkBatchMode = "Steady"
+  CrossLinkHeaderFetchTimeout = "5s"
+  TxGossipRateLimit = 2.5
+  [Handler.ShardClientGroups]
+    1 = "custom/client/1"
+`
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(handler); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	config, _, err := loadHarmonyConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlerConfig, err := config.ToHandlerConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handlerConfig.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	require.Equal(t, 4, handlerConfig.CrossLinkBatchSize)
+	require.Equal(t, nodeconfig.CrossLinkBatchSteady, handlerConfig.CrossLinkBatchMode)
+	require.Equal(t, 5*time.Second, handlerConfig.CrossLinkHeaderFetchTimeout)
+	require.Equal(t, 2.5, handlerConfig.TxGossipRateLimit)
+	require.Equal(t, map[uint32]nodeconfig.GroupID{1: "custom/client/1"}, handlerConfig.ShardClientGroups)
+
+	config.Handler.CrossLinkBatchSize = 0
+	if handlerConfig, err = config.ToHandlerConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := handlerConfig.Validate(); err == nil {
+		t.Errorf("expected a zero crosslink batch size to be rejected")
+	}
+}
@@ -182,6 +182,14 @@ var defaultLocalnetConfig = harmonyconfig.LocalnetConfig{
 	BlocksPerEpochV2: 16,
 }
 
+var defaultHandlerConfig = harmonyconfig.HandlerConfig{
+	CrossLinkBatchSize:            nodeconfig.DefaultCrossLinkBatchSize,
+	CrossLinkBatchCapMultiplier:   nodeconfig.DefaultCrossLinkBatchCapMultiplier,
+	CrossLinkSentWindowMultiplier: nodeconfig.DefaultCrossLinkSentWindowMultiplier,
+	CrossLinkBatchGrowthDivisor:   nodeconfig.DefaultCrossLinkBatchGrowthDivisor,
+	CrossLinkBatchMode:            nodeconfig.CrossLinkBatchAdaptive.String(),
+}
+
 var defaultPrometheusConfig = harmonyconfig.PrometheusConfig{
 	Enabled:    true,
 	IP:         "0.0.0.0",
@@ -374,6 +382,11 @@ func GetDefaultCacheConfigCopy() harmonyconfig.CacheConfig {
 	return config
 }
 
+func GetDefaultHandlerConfigCopy() harmonyconfig.HandlerConfig {
+	config := defaultHandlerConfig
+	return config
+}
+
 const (
 	NodeTypeValidator = "validator"
 	NodeTypeExplorer  = "explorer"
@@ -291,6 +291,22 @@ var (
 		metricsETHFlag,
 		metricsExpensiveETHFlag,
 	}
+
+	handlerFlags = []cli.Flag{
+		handlerCrossLinkBatchSizeFlag,
+		handlerCrossLinkBatchCapMultiplierFlag,
+		handlerCrossLinkSentWindowMultiplierFlag,
+		handlerCrossLinkBatchGrowthDivisorFlag,
+		handlerCrossLinkBatchModeFlag,
+		handlerCrossLinkHeaderFetchTimeoutFlag,
+		handlerMaxConcurrentSyncDecodesFlag,
+		handlerTxGossipRateLimitFlag,
+		handlerTxGossipRateBurstFlag,
+		handlerBootstrapTimeoutFlag,
+		handlerBootstrapCheckIntervalFlag,
+		handlerBootstrapCheckIntervalMinFlag,
+		handlerBootstrapCheckIntervalMaxFlag,
+	}
 )
 
 var (
@@ -401,6 +417,7 @@ func getRootFlags() []cli.Flag {
 	flags = append(flags, shardDataFlags...)
 	flags = append(flags, gpoFlags...)
 	flags = append(flags, metricsFlags...)
+	flags = append(flags, handlerFlags...)
 
 	return flags
 }
@@ -2246,3 +2263,142 @@ func applyCacheFlags(cmd *cobra.Command, cfg *harmonyconfig.HarmonyConfig) {
 		cfg.Cache.SnapshotWait = cli.GetBoolFlagValue(cmd, cacheSnapshotWait)
 	}
 }
+
+var (
+	handlerCrossLinkBatchSizeFlag = cli.IntFlag{
+		Name:     "handler.crosslink.batch-size",
+		Usage:    "base number of crosslinks of a crosslink broadcast",
+		DefValue: defaultHandlerConfig.CrossLinkBatchSize,
+	}
+	handlerCrossLinkBatchCapMultiplierFlag = cli.IntFlag{
+		Name:     "handler.crosslink.batch-cap-multiplier",
+		Usage:    "multiple of the crosslink batch size an adaptive batch grows up to",
+		DefValue: defaultHandlerConfig.CrossLinkBatchCapMultiplier,
+	}
+	handlerCrossLinkSentWindowMultiplierFlag = cli.IntFlag{
+		Name:     "handler.crosslink.sent-window-multiplier",
+		Usage:    "multiple of the crosslink batch size by which the last sent crosslink may be ahead of the beacon chain",
+		DefValue: defaultHandlerConfig.CrossLinkSentWindowMultiplier,
+	}
+	handlerCrossLinkBatchGrowthDivisorFlag = cli.IntFlag{
+		Name:     "handler.crosslink.batch-growth-divisor",
+		Usage:    "number of blocks behind for which an adaptive crosslink batch grows by one crosslink",
+		DefValue: defaultHandlerConfig.CrossLinkBatchGrowthDivisor,
+	}
+	handlerCrossLinkBatchModeFlag = cli.StringFlag{
+		Name:     "handler.crosslink.batch-mode",
+		Usage:    "how crosslink batches follow the backlog (Adaptive, Steady)",
+		DefValue: defaultHandlerConfig.CrossLinkBatchMode,
+	}
+	handlerCrossLinkHeaderFetchTimeoutFlag = cli.StringFlag{
+		Name:     "handler.crosslink.header-fetch-timeout",
+		Usage:    "time bound of the header reads of a crosslink broadcast as a golang duration string, zero for no bound",
+		DefValue: defaultHandlerConfig.CrossLinkHeaderFetchTimeout.String(),
+	}
+	handlerMaxConcurrentSyncDecodesFlag = cli.IntFlag{
+		Name:     "handler.sync.max-concurrent-decodes",
+		Usage:    "number of block sync messages decoded at the same time, zero for no limit",
+		DefValue: defaultHandlerConfig.MaxConcurrentSyncDecodes,
+	}
+	handlerTxGossipRateLimitFlag = cli.StringFlag{
+		Name:     "handler.tx.gossip-rate-limit",
+		Usage:    "transaction messages per second processed from each publisher, zero for no limit",
+		DefValue: strconv.FormatFloat(defaultHandlerConfig.TxGossipRateLimit, 'f', -1, 64),
+	}
+	handlerTxGossipRateBurstFlag = cli.IntFlag{
+		Name:     "handler.tx.gossip-rate-burst",
+		Usage:    "transaction messages a publisher can send at once above the rate limit, zero for the default",
+		DefValue: defaultHandlerConfig.TxGossipRateBurst,
+	}
+	handlerBootstrapTimeoutFlag = cli.StringFlag{
+		Name:     "handler.bootstrap.timeout",
+		Usage:    "how long consensus bootstrap waits for the min peers as a golang duration string, zero for the default",
+		DefValue: defaultHandlerConfig.BootstrapTimeout.String(),
+	}
+	handlerBootstrapCheckIntervalFlag = cli.StringFlag{
+		Name:     "handler.bootstrap.check-interval",
+		Usage:    "delay before the first peer count check of consensus bootstrap, zero for the default",
+		DefValue: defaultHandlerConfig.BootstrapCheckInterval.String(),
+	}
+	handlerBootstrapCheckIntervalMinFlag = cli.StringFlag{
+		Name:     "handler.bootstrap.check-interval-min",
+		Usage:    "delay between peer count checks of consensus bootstrap once the peers grew, zero for the default",
+		DefValue: defaultHandlerConfig.BootstrapCheckIntervalMin.String(),
+	}
+	handlerBootstrapCheckIntervalMaxFlag = cli.StringFlag{
+		Name:     "handler.bootstrap.check-interval-max",
+		Usage:    "longest delay between peer count checks of consensus bootstrap, zero for the default",
+		DefValue: defaultHandlerConfig.BootstrapCheckIntervalMax.String(),
+	}
+)
+
+func applyHandlerFlags(cmd *cobra.Command, config *harmonyconfig.HarmonyConfig) {
+	if !cli.HasFlagsChanged(cmd, handlerFlags) {
+		return
+	}
+	if config.Handler == nil {
+		cfg := GetDefaultHandlerConfigCopy()
+		config.Handler = &cfg
+	}
+	positive := func(flag cli.IntFlag) int {
+		value := cli.GetIntFlagValue(cmd, flag)
+		if value <= 0 {
+			panic(fmt.Sprintf("Must provide positive value for %s", flag.Name))
+		}
+		return value
+	}
+	duration := func(flag cli.StringFlag) time.Duration {
+		value, err := time.ParseDuration(cli.GetStringFlagValue(cmd, flag))
+		if err != nil {
+			panic(fmt.Sprintf("Invalid value for %s: %v", flag.Name, err))
+		}
+		return value
+	}
+	if cli.IsFlagChanged(cmd, handlerCrossLinkBatchSizeFlag) {
+		config.Handler.CrossLinkBatchSize = positive(handlerCrossLinkBatchSizeFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerCrossLinkBatchCapMultiplierFlag) {
+		config.Handler.CrossLinkBatchCapMultiplier = positive(handlerCrossLinkBatchCapMultiplierFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerCrossLinkSentWindowMultiplierFlag) {
+		config.Handler.CrossLinkSentWindowMultiplier = positive(handlerCrossLinkSentWindowMultiplierFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerCrossLinkBatchGrowthDivisorFlag) {
+		config.Handler.CrossLinkBatchGrowthDivisor = positive(handlerCrossLinkBatchGrowthDivisorFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerCrossLinkBatchModeFlag) {
+		mode, err := nodeconfig.ParseCrossLinkBatchMode(cli.GetStringFlagValue(cmd, handlerCrossLinkBatchModeFlag))
+		if err != nil {
+			panic(fmt.Sprintf("Invalid value for %s: %v", handlerCrossLinkBatchModeFlag.Name, err))
+		}
+		config.Handler.CrossLinkBatchMode = mode.String()
+	}
+	if cli.IsFlagChanged(cmd, handlerCrossLinkHeaderFetchTimeoutFlag) {
+		config.Handler.CrossLinkHeaderFetchTimeout = duration(handlerCrossLinkHeaderFetchTimeoutFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerMaxConcurrentSyncDecodesFlag) {
+		config.Handler.MaxConcurrentSyncDecodes = cli.GetIntFlagValue(cmd, handlerMaxConcurrentSyncDecodesFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerTxGossipRateLimitFlag) {
+		value, err := strconv.ParseFloat(cli.GetStringFlagValue(cmd, handlerTxGossipRateLimitFlag), 64)
+		if err != nil {
+			panic(fmt.Sprintf("Invalid value for %s: %v", handlerTxGossipRateLimitFlag.Name, err))
+		}
+		config.Handler.TxGossipRateLimit = value
+	}
+	if cli.IsFlagChanged(cmd, handlerTxGossipRateBurstFlag) {
+		config.Handler.TxGossipRateBurst = cli.GetIntFlagValue(cmd, handlerTxGossipRateBurstFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerBootstrapTimeoutFlag) {
+		config.Handler.BootstrapTimeout = duration(handlerBootstrapTimeoutFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerBootstrapCheckIntervalFlag) {
+		config.Handler.BootstrapCheckInterval = duration(handlerBootstrapCheckIntervalFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerBootstrapCheckIntervalMinFlag) {
+		config.Handler.BootstrapCheckIntervalMin = duration(handlerBootstrapCheckIntervalMinFlag)
+	}
+	if cli.IsFlagChanged(cmd, handlerBootstrapCheckIntervalMaxFlag) {
+		config.Handler.BootstrapCheckIntervalMax = duration(handlerBootstrapCheckIntervalMaxFlag)
+	}
+}
@@ -1695,6 +1695,50 @@ func TestCacheFlags(t *testing.T) {
 	}
 }
 
+func TestHandlerFlags(t *testing.T) {
+	tests := []struct {
+		args      []string
+		expConfig *harmonyconfig.HandlerConfig
+		expErr    error
+	}{
+		{
+			args:      []string{},
+			expConfig: nil,
+		},
+		{
+			args: []string{"--handler.crosslink.batch-size", "5", "--handler.crosslink.batch-mode", "steady",
+				"--handler.crosslink.header-fetch-timeout", "3s", "--handler.tx.gossip-rate-limit", "2.5",
+				"--handler.bootstrap.check-interval-max", "1m"},
+			expConfig: func() *harmonyconfig.HandlerConfig {
+				cfg := GetDefaultHandlerConfigCopy()
+				cfg.CrossLinkBatchSize = 5
+				cfg.CrossLinkBatchMode = "Steady"
+				cfg.CrossLinkHeaderFetchTimeout = 3 * time.Second
+				cfg.TxGossipRateLimit = 2.5
+				cfg.BootstrapCheckIntervalMax = time.Minute
+				return &cfg
+			}(),
+		},
+	}
+
+	for i, test := range tests {
+		ts := newFlagTestSuite(t, handlerFlags, applyHandlerFlags)
+		hc, err := ts.run(test.args)
+
+		if assErr := assertError(err, test.expErr); assErr != nil {
+			t.Fatalf("Test %v: %v", i, assErr)
+		}
+		if err != nil || test.expErr != nil {
+			continue
+		}
+
+		if !reflect.DeepEqual(hc.Handler, test.expConfig) {
+			t.Errorf("Test %v:\n\t%+v\n\t%+v", i, hc.Handler, test.expConfig)
+		}
+		ts.tearDown()
+	}
+}
+
 func TestDevnetFlags(t *testing.T) {
 	tests := []struct {
 		args      []string
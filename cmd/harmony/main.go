@@ -646,6 +646,15 @@ func createGlobalConfig(hc harmonyconfig.HarmonyConfig) (*nodeconfig.ConfigType,
 
 	nodeConfig.TraceEnable = hc.General.TraceEnable
 
+	handlerConfig, err := hc.ToHandlerConfig()
+	if err != nil {
+		return nil, err
+	}
+	nodeConfig.Handler = handlerConfig
+	if err := nodeConfig.Handler.Validate(); err != nil {
+		return nil, err
+	}
+
 	return nodeConfig, nil
 }
 
@@ -128,6 +128,13 @@ type Consensus struct {
 
 	dHelper DownloadAsync
 
+	// blockHooks observe the new blocks broadcast
+	blockHooks blockBroadcastHooks
+	// newBlocks coalesces the new blocks broadcast within the coalesce window
+	newBlocks blockCoalescer
+	// leaderHook is run when the node becomes leader
+	leaderHook atomic.Pointer[LeaderTransitionHook]
+
 	// Both flags only for initialization state.
 	start           bool
 	isInitialLeader bool
@@ -245,7 +252,22 @@ func (consensus *Consensus) SetLeaderPubKey(pub *bls_cosi.PublicKeyWrapper) {
 }
 
 func (consensus *Consensus) setLeaderPubKey(pub *bls_cosi.PublicKeyWrapper) {
+	wasLeader := consensus.isLeader()
 	consensus.current.setLeaderPubKey(pub)
+	if !wasLeader && consensus.isMyKey(pub) {
+		if hook := consensus.leaderHook.Load(); hook != nil {
+			go (*hook)()
+		}
+	}
+}
+
+// LeaderTransitionHook is run when the node becomes the leader of its shard.
+type LeaderTransitionHook func()
+
+// SetLeaderTransitionHook sets the hook run in the background each time the node becomes
+// the leader of its shard, after being a validator.
+func (consensus *Consensus) SetLeaderTransitionHook(hook LeaderTransitionHook) {
+	consensus.leaderHook.Store(&hook)
 }
 
 func (consensus *Consensus) GetPrivateKeys() multibls.PrivateKeys {
@@ -101,3 +101,37 @@ func TestFinalCommitDisablesTransition(t *testing.T) {
 
 	require.False(t, consensus.transitions.finalCommit)
 }
+
+func TestLeaderTransitionHook(t *testing.T) {
+	own := multibls.GetPrivateKeys(bls.RandPrivateKey())
+	other := multibls.GetPrivateKeys(bls.RandPrivateKey())
+	consensus := &Consensus{priKey: own}
+	became := make(chan struct{}, 4)
+	consensus.SetLeaderTransitionHook(func() { became <- struct{}{} })
+
+	expect := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-became:
+			case <-time.After(time.Second):
+				t.Fatalf("expected the hook run %d times, got %d", n, i)
+			}
+		}
+		select {
+		case <-became:
+			t.Fatalf("expected the hook run %d times, got more", n)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	consensus.SetLeaderPubKey(other[0].Pub)
+	expect(0)
+	consensus.SetLeaderPubKey(own[0].Pub)
+	// staying leader is no transition
+	consensus.SetLeaderPubKey(own[0].Pub)
+	expect(1)
+	consensus.SetLeaderPubKey(other[0].Pub)
+	consensus.SetLeaderPubKey(own[0].Pub)
+	expect(1)
+}
@@ -2,6 +2,9 @@ package consensus
 
 import (
 	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	proto_node "github.com/harmony-one/harmony/api/proto/node"
 	"github.com/harmony-one/harmony/block"
@@ -13,6 +16,7 @@ import (
 	"github.com/harmony-one/harmony/shard"
 	"github.com/harmony-one/harmony/staking/availability"
 	"github.com/harmony-one/harmony/webhooks"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // postConsensusProcessing is called by consensus participants, after consensus is done, to:
@@ -23,7 +27,7 @@ func (consensus *Consensus) postConsensusProcessing(newBlock *types.Block) error
 		if IsRunningBeaconChain(consensus) {
 			// TODO: consider removing this and letting other nodes broadcast new blocks.
 			// But need to make sure there is at least 1 node that will do the job.
-			BroadcastNewBlock(consensus.host, newBlock, consensus.registry.GetNodeConfig())
+			consensus.broadcastNewBlock(newBlock)
 		}
 		BroadcastCXReceipts(newBlock, consensus)
 	} else {
@@ -52,7 +56,7 @@ func (consensus *Consensus) postConsensusProcessing(newBlock *types.Block) error
 			if rnd < 1 {
 				// Beacon validators also broadcast new blocks to make sure beacon sync is strong.
 				if IsRunningBeaconChain(consensus) {
-					BroadcastNewBlock(consensus.host, newBlock, consensus.registry.GetNodeConfig())
+					consensus.broadcastNewBlock(newBlock)
 				}
 				BroadcastCXReceipts(newBlock, consensus)
 			}
@@ -104,22 +108,180 @@ func (consensus *Consensus) postConsensusProcessing(newBlock *types.Block) error
 }
 
 // BroadcastNewBlock is called by consensus leader to sync new blocks with other clients/nodes.
-// NOTE: For now, just send to the client (basically not broadcasting)
-// TODO (lc): broadcast the new blocks to new nodes doing state sync
-func BroadcastNewBlock(host p2p.Host, newBlock *types.Block, nodeConfig *nodeconfig.ConfigType) {
-	groups := []nodeconfig.GroupID{nodeConfig.GetClientGroupID()}
+// The blocks are sent to the client group, to the shard group of the nodes doing state sync
+// and to the extra groups of the handler config. It returns nodeconfig.ErrNoNewBlockGroups
+// if none of them is set, or the error of the host if the block could not be sent.
+// The block is sent uncompressed.
+func BroadcastNewBlock(host p2p.Host, newBlock *types.Block, nodeConfig *nodeconfig.ConfigType) error {
+	return broadcastNewBlocks(host, []*types.Block{newBlock}, nodeConfig, 0)
+}
+
+// broadcastNewBlocks sends newBlocks in a single blocks sync message, as BroadcastNewBlock,
+// compressed from compressThreshold if it is positive.
+func broadcastNewBlocks(host p2p.Host, newBlocks []*types.Block, nodeConfig *nodeconfig.ConfigType, compressThreshold int) error {
+	last := newBlocks[len(newBlocks)-1]
+	if !nodeConfig.BlockBroadcastEnabled() {
+		consensusCounterVec.With(prometheus.Labels{"consensus": "block_broadcast_suppressed"}).Inc()
+		utils.Logger().Info().
+			Uint64("blockNum", last.NumberU64()).
+			Msg("block broadcast disabled, not broadcasting new block")
+		return nil
+	}
+	groups := nodeConfig.NewBlockGroupIDs(last.ShardID())
+	if len(groups) == 0 {
+		return nodeconfig.ErrNoNewBlockGroups
+	}
 	utils.Logger().Info().
+		Int("count", len(newBlocks)).
 		Msgf(
-			"broadcasting new block %d, group %s", newBlock.NumberU64(), groups[0],
+			"broadcasting new block %d, groups %v", last.NumberU64(), groups,
 		)
 	msg := p2p.ConstructMessage(
-		proto_node.ConstructBlocksSyncMessage([]*types.Block{newBlock}),
+		proto_node.ConstructBlocksSyncMessageCompressed(newBlocks, compressThreshold),
 	)
-	if err := host.SendMessageToGroups(groups, msg); err != nil {
-		utils.Logger().Warn().Err(err).Msg("cannot broadcast new block")
+	return host.SendMessageToGroups(groups, msg)
+}
+
+// blockCoalescer collects the new blocks produced within a short window, so that they
+// are broadcast as a single sync message.
+type blockCoalescer struct {
+	mu      sync.Mutex
+	pending []*types.Block
+	timer   *time.Timer
+}
+
+// add adds newBlock to the pending blocks, passed to flush once window passed since the
+// first of them was added.
+func (c *blockCoalescer) add(newBlock *types.Block, window time.Duration, flush func([]*types.Block)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, newBlock)
+	if c.timer == nil {
+		c.timer = time.AfterFunc(window, func() {
+			c.mu.Lock()
+			blocks := c.pending
+			c.pending, c.timer = nil, nil
+			c.mu.Unlock()
+			flush(blocks)
+		})
 	}
 }
 
+// BlockBroadcastHook observes a new block broadcast by the node, so that an embedded explorer
+// or indexer can ingest the blocks without joining the gossip network.
+type BlockBroadcastHook func(*types.Block)
+
+// maxBlockBroadcastHookRuns is the number of new blocks the hooks run for at the same time.
+// The hooks are not run for blocks broadcast while all runs are busy, so that a slow hook
+// doesn't hold consensus back.
+const maxBlockBroadcastHookRuns = 4
+
+// blockBroadcastHooks runs the hooks of the new blocks broadcast.
+type blockBroadcastHooks struct {
+	mu      sync.RWMutex
+	hooks   []BlockBroadcastHook
+	running atomic.Int32
+}
+
+func (h *blockBroadcastHooks) set(hooks []BlockBroadcastHook) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.hooks = append([]BlockBroadcastHook(nil), hooks...)
+}
+
+// run runs the hooks for newBlock in the background, in the order they were set.
+func (h *blockBroadcastHooks) run(newBlock *types.Block) {
+	h.mu.RLock()
+	hooks := h.hooks
+	h.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+	if h.running.Add(1) > maxBlockBroadcastHookRuns {
+		h.running.Add(-1)
+		consensusCounterVec.With(prometheus.Labels{"consensus": "block_hook_dropped"}).Inc()
+		utils.Logger().Warn().
+			Uint64("blockNum", newBlock.NumberU64()).
+			Msg("[broadcastNewBlock] block broadcast hooks busy, skipping block")
+		return
+	}
+	go func() {
+		defer h.running.Add(-1)
+		for _, hook := range hooks {
+			hook(newBlock)
+		}
+	}()
+}
+
+// SetBlockBroadcastHooks sets the hooks run for each new block the node broadcasts. The
+// hooks run in the background and are skipped for a block while they are still busy with
+// earlier blocks.
+func (consensus *Consensus) SetBlockBroadcastHooks(hooks ...BlockBroadcastHook) {
+	consensus.blockHooks.set(hooks)
+}
+
+// blockBroadcastRetryDelay is the delay before a failed new block broadcast is retried.
+const blockBroadcastRetryDelay = time.Second
+
+// coalesceWindow returns the new block coalesce window, capped to a quarter of blockPeriod
+// so that the coalesced blocks are not older than the receivers' head once broadcast.
+func coalesceWindow(window, blockPeriod time.Duration) time.Duration {
+	if blockPeriod > 0 && window > blockPeriod/4 {
+		return blockPeriod / 4
+	}
+	return window
+}
+
+// broadcastNewBlock broadcasts the new block, coalesced with the other blocks produced
+// within the coalesce window of the handler config if it is set.
+func (consensus *Consensus) broadcastNewBlock(newBlock *types.Block) {
+	consensus.blockHooks.run(newBlock)
+	nodeConfig := consensus.registry.GetNodeConfig()
+	if window := coalesceWindow(nodeConfig.Handler.NewBlockCoalesceWindow, consensus.BlockPeriod); window > 0 {
+		consensus.newBlocks.add(newBlock, window, func(blocks []*types.Block) {
+			consensus.sendNewBlocks(blocks, nodeConfig)
+		})
+		return
+	}
+	consensus.sendNewBlocks([]*types.Block{newBlock}, nodeConfig)
+}
+
+// blockSyncCompressThreshold returns the size from which the sync message of the blocks up
+// to last is compressed, zero before the MessageVersion2Epoch of the chain config as the
+// compressed messages are sent in a version 2 envelope.
+func (consensus *Consensus) blockSyncCompressThreshold(last *types.Block, nodeConfig *nodeconfig.ConfigType) int {
+	bc := consensus.Blockchain()
+	if bc == nil || !bc.Config().IsMessageVersion2(last.Epoch()) {
+		return 0
+	}
+	return nodeConfig.Handler.BlockSyncCompressThreshold
+}
+
+// sendNewBlocks sends the new blocks, retrying once on failure so that a transient send
+// error does not leave the blocks unannounced. The retry is not counted by the goroutine
+// cap of the node package, there is at most one per failed broadcast.
+func (consensus *Consensus) sendNewBlocks(newBlocks []*types.Block, nodeConfig *nodeconfig.ConfigType) {
+	last := newBlocks[len(newBlocks)-1]
+	threshold := consensus.blockSyncCompressThreshold(last, nodeConfig)
+	err := broadcastNewBlocks(consensus.host, newBlocks, nodeConfig, threshold)
+	if err == nil {
+		return
+	}
+	consensusCounterVec.With(prometheus.Labels{"consensus": "block_broadcast_failed"}).Inc()
+	consensus.getLogger().Error().Err(err).
+		Uint64("blockNum", last.NumberU64()).
+		Msg("[broadcastNewBlock] cannot broadcast new block, retrying")
+	time.AfterFunc(blockBroadcastRetryDelay, func() {
+		if err := broadcastNewBlocks(consensus.host, newBlocks, nodeConfig, threshold); err != nil {
+			consensusCounterVec.With(prometheus.Labels{"consensus": "block_broadcast_failed"}).Inc()
+			consensus.getLogger().Error().Err(err).
+				Uint64("blockNum", last.NumberU64()).
+				Msg("[broadcastNewBlock] cannot broadcast new block after retry")
+		}
+	})
+}
+
 func IsRunningBeaconChain(c *Consensus) bool {
 	return c.ShardID == shard.BeaconChainShardID
 }
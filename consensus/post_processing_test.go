@@ -0,0 +1,228 @@
+package consensus
+
+import (
+	"errors"
+	"math/big"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	blockfactory "github.com/harmony-one/harmony/block/factory"
+	"github.com/harmony-one/harmony/core"
+	"github.com/harmony-one/harmony/core/types"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/params"
+	"github.com/harmony-one/harmony/internal/registry"
+	"github.com/harmony-one/harmony/p2p"
+)
+
+// failingHost is a p2p.Host failing to send to groups.
+type failingHost struct {
+	p2p.Host
+	err   error
+	sends int
+}
+
+func (h *failingHost) SendMessageToGroups([]nodeconfig.GroupID, []byte) error {
+	h.sends++
+	return h.err
+}
+
+func TestBroadcastNewBlockError(t *testing.T) {
+	host := &failingHost{err: errors.New("send failed")}
+	conf := &nodeconfig.ConfigType{}
+	block := types.NewBlockWithHeader(blockfactory.NewTestHeader().With().Number(big.NewInt(1)).Header())
+
+	if err := BroadcastNewBlock(host, block, conf); !errors.Is(err, host.err) {
+		t.Fatalf("expected the host error, got %v", err)
+	}
+
+	conf.SetBlockBroadcastEnabled(false)
+	if err := BroadcastNewBlock(host, block, conf); err != nil || host.sends != 1 {
+		t.Fatalf("expected no error and no send while block broadcast is disabled, got %v, %d sends", err, host.sends)
+	}
+}
+
+func TestBlockBroadcastHooks(t *testing.T) {
+	host := &failingHost{}
+	consensus := &Consensus{host: host, registry: registry.New().SetNodeConfig(&nodeconfig.ConfigType{})}
+	block := types.NewBlockWithHeader(blockfactory.NewTestHeader().With().Number(big.NewInt(7)).Header())
+
+	observed := make(chan *types.Block, 2)
+	consensus.SetBlockBroadcastHooks(
+		func(b *types.Block) { observed <- b },
+		func(b *types.Block) { observed <- b },
+	)
+	consensus.broadcastNewBlock(block)
+	for i := 0; i < 2; i++ {
+		select {
+		case b := <-observed:
+			if b.Hash() != block.Hash() {
+				t.Errorf("hook %d: expected block %d, got %d", i, block.NumberU64(), b.NumberU64())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("hook %d not invoked with the broadcast block", i)
+		}
+	}
+	if host.sends != 1 {
+		t.Errorf("expected the block to be sent, got %d sends", host.sends)
+	}
+}
+
+func TestBlockBroadcastHooksSlow(t *testing.T) {
+	host := &failingHost{}
+	consensus := &Consensus{host: host, registry: registry.New().SetNodeConfig(&nodeconfig.ConfigType{})}
+	release := make(chan struct{})
+	started := make(chan uint64, maxBlockBroadcastHookRuns+2)
+	consensus.SetBlockBroadcastHooks(func(b *types.Block) {
+		started <- b.NumberU64()
+		<-release
+	})
+
+	done := make(chan struct{})
+	go func() {
+		for i := int64(1); i <= maxBlockBroadcastHookRuns+2; i++ {
+			consensus.broadcastNewBlock(types.NewBlockWithHeader(blockfactory.NewTestHeader().With().Number(big.NewInt(i)).Header()))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("slow hooks held the block broadcast back")
+	}
+	close(release)
+	if host.sends != maxBlockBroadcastHookRuns+2 {
+		t.Errorf("expected every block to be sent, got %d sends", host.sends)
+	}
+	for i := 0; i < maxBlockBroadcastHookRuns; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("expected the hooks to run for %d blocks, got %d", maxBlockBroadcastHookRuns, i)
+		}
+	}
+	if n := consensus.blockHooks.running.Load(); n > maxBlockBroadcastHookRuns {
+		t.Errorf("expected at most %d hook runs, got %d", maxBlockBroadcastHookRuns, n)
+	}
+}
+
+// recordingHost is a p2p.Host recording the messages sent to groups, and their groups.
+type recordingHost struct {
+	p2p.Host
+	mu     sync.Mutex
+	msgs   [][]byte
+	groups [][]nodeconfig.GroupID
+}
+
+func (h *recordingHost) SendMessageToGroups(groups []nodeconfig.GroupID, msg []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.msgs = append(h.msgs, msg)
+	h.groups = append(h.groups, append([]nodeconfig.GroupID(nil), groups...))
+	return nil
+}
+
+func (h *recordingHost) sent() [][]byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]byte(nil), h.msgs...)
+}
+
+func (h *recordingHost) sentGroups() [][]nodeconfig.GroupID {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]nodeconfig.GroupID(nil), h.groups...)
+}
+
+func TestCoalesceWindow(t *testing.T) {
+	for _, test := range []struct {
+		window, blockPeriod, want time.Duration
+	}{
+		{100 * time.Millisecond, 2 * time.Second, 100 * time.Millisecond},
+		{time.Second, 2 * time.Second, 500 * time.Millisecond},
+		{time.Second, 0, time.Second},
+		{0, 2 * time.Second, 0},
+	} {
+		if got := coalesceWindow(test.window, test.blockPeriod); got != test.want {
+			t.Errorf("window %v, block period %v: expected %v, got %v", test.window, test.blockPeriod, test.want, got)
+		}
+	}
+}
+
+func TestBroadcastNewBlockCoalesce(t *testing.T) {
+	host := &recordingHost{}
+	conf := &nodeconfig.ConfigType{}
+	conf.SetClientGroupID("client")
+	conf.Handler.NewBlockCoalesceWindow = 50 * time.Millisecond
+	consensus := &Consensus{host: host, registry: registry.New().SetNodeConfig(conf)}
+
+	for i := int64(1); i <= 3; i++ {
+		consensus.broadcastNewBlock(types.NewBlockWithHeader(blockfactory.NewTestHeader().With().Number(big.NewInt(i)).Header()))
+	}
+	if n := len(host.sent()); n != 0 {
+		t.Fatalf("expected no message before the window ends, got %d", n)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(host.sent()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sent := host.sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 coalesced message, got %d", len(sent))
+	}
+	// the 5 byte p2p message prefix, the node message category and type and the sync type
+	// precede the blocks
+	var blocks []*types.Block
+	if err := rlp.DecodeBytes(sent[0][5+3:], &blocks); err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks in the message, got %d", len(blocks))
+	}
+	want := []nodeconfig.GroupID{"client", nodeconfig.SyncGroupIDForShard(blocks[2].ShardID())}
+	if groups := host.sentGroups(); !slices.Equal(groups[0], want) {
+		t.Errorf("expected the blocks sent to %v, got %v", want, groups[0])
+	}
+
+	// each consensus coalesces its own blocks
+	other := &Consensus{host: &recordingHost{}, registry: registry.New().SetNodeConfig(conf)}
+	other.broadcastNewBlock(types.NewBlockWithHeader(blockfactory.NewTestHeader().With().Number(big.NewInt(4)).Header()))
+	if n := len(consensus.newBlocks.pending); n != 0 {
+		t.Errorf("expected no block pending on another consensus, got %d", n)
+	}
+}
+
+// upgradeChain is a blockchain sending the node messages of version 2 from epoch.
+type upgradeChain struct {
+	core.Stub
+	epoch *big.Int
+}
+
+func (c upgradeChain) Config() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.MessageVersion2Epoch = c.epoch
+	return &config
+}
+
+func TestBlockSyncCompressThreshold(t *testing.T) {
+	conf := &nodeconfig.ConfigType{}
+	conf.Handler.BlockSyncCompressThreshold = 100
+	atEpoch := func(epoch int64) *types.Block {
+		return types.NewBlockWithHeader(blockfactory.NewTestHeader().With().Epoch(big.NewInt(epoch)).Header())
+	}
+
+	consensus := &Consensus{registry: registry.New().SetBlockchain(upgradeChain{epoch: big.NewInt(5)})}
+	if n := consensus.blockSyncCompressThreshold(atEpoch(4), conf); n != 0 {
+		t.Errorf("expected no compression before the message version 2 epoch, got %d", n)
+	}
+	if n := consensus.blockSyncCompressThreshold(atEpoch(5), conf); n != 100 {
+		t.Errorf("expected the configured threshold from the message version 2 epoch, got %d", n)
+	}
+	if n := (&Consensus{registry: registry.New()}).blockSyncCompressThreshold(atEpoch(5), conf); n != 0 {
+		t.Errorf("expected no compression without a blockchain, got %d", n)
+	}
+}
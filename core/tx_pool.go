@@ -61,6 +61,14 @@ var (
 	// configured for the transaction pool.
 	ErrUnderpriced = errors.New("transaction underpriced")
 
+	// ErrTxPoolFull is returned if a transaction's gas price is below the ones of all
+	// the transactions of a full transaction pool.
+	ErrTxPoolFull = errors.New("transaction underpriced in full transaction pool")
+
+	// ErrQueueCapExceeded is reported if a queued transaction is dropped for exceeding
+	// the account or the global cap of queued transactions.
+	ErrQueueCapExceeded = errors.New("exceeds cap for queued transactions")
+
 	// ErrReplaceUnderpriced is returned if a transaction is attempted to be replaced
 	// with a different one without the required price bump.
 	ErrReplaceUnderpriced = errors.New("replacement transaction underpriced")
@@ -962,7 +970,7 @@ func (pool *TxPool) add(tx types.PoolTransaction, local bool) (replaced bool, er
 				Str("price", tx.GasPrice().String()).
 				Msg("Discarding underpriced transaction")
 			underpricedTxCounter.Inc(1)
-			return false, errors.WithMessagef(ErrUnderpriced, "transaction gas-price is %.18f ONE in full transaction pool", gasPrice)
+			return false, errors.WithMessagef(ErrTxPoolFull, "transaction gas-price is %.18f ONE", gasPrice)
 		}
 		// New transaction is better than our worse ones, make room for it
 		drop := pool.priced.Discard(pool.all.Count()-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.locals)
@@ -972,7 +980,7 @@ func (pool *TxPool) add(tx types.PoolTransaction, local bool) (replaced bool, er
 			pool.removeTx(tx.Hash(), false)
 			underpricedTxCounter.Inc(1)
 			pool.txErrorSink.Add(tx,
-				errors.WithMessagef(ErrUnderpriced, "transaction gas-price is %.18f ONE in full transaction pool", gasPrice))
+				errors.WithMessagef(ErrTxPoolFull, "transaction gas-price is %.18f ONE", gasPrice))
 			logger.Debug().
 				Str("hash", tx.Hash().Hex()).
 				Str("price", tx.GasPrice().String()).
@@ -1360,7 +1368,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 				pool.all.Remove(hash)
 				pool.priced.Removed()
 				queuedRateLimitCounter.Inc(1)
-				pool.txErrorSink.Add(tx, fmt.Errorf("exceeds cap for queued transactions for account %s", addr.String()))
+				pool.txErrorSink.Add(tx, errors.WithMessagef(ErrQueueCapExceeded, "account %s", addr.String()))
 				logger.Warn().Str("hash", hash.Hex()).Msg("Removed cap-exceeding queued transaction")
 			}
 		}
@@ -1471,7 +1479,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			// Drop all transactions if they are less than the overflow
 			if size := uint64(list.Len()); size <= drop {
 				for _, tx := range list.Flatten() {
-					pool.txErrorSink.Add(tx, fmt.Errorf("exceeds global cap for queued transactions"))
+					pool.txErrorSink.Add(tx, errors.WithMessage(ErrQueueCapExceeded, "global"))
 					pool.removeTx(tx.Hash(), true)
 				}
 				drop -= size
@@ -1481,7 +1489,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			// Otherwise drop only last few transactions
 			txs := list.Flatten()
 			for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
-				pool.txErrorSink.Add(txs[i], fmt.Errorf("exceeds global cap for queued transactions"))
+				pool.txErrorSink.Add(txs[i], errors.WithMessage(ErrQueueCapExceeded, "global"))
 				pool.removeTx(txs[i].Hash(), true)
 				drop--
 				queuedRateLimitCounter.Inc(1)
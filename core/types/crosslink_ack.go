@@ -0,0 +1,14 @@
+package types
+
+import "github.com/harmony-one/harmony/block"
+
+// CrosslinkAck is the beacon chain acknowledgement that the crosslinks of a shard
+// were accepted up to BlockNum, proven by the committed beacon block including them.
+type CrosslinkAck struct {
+	ShardID  uint32
+	BlockNum uint64
+	// BeaconHeader is the header of the beacon block including the crosslink of BlockNum
+	BeaconHeader *block.Header
+	// CommitSig is the commit signature and bitmap of the beacon block
+	CommitSig []byte
+}
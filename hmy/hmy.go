@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
@@ -120,6 +121,10 @@ type NodeAPI interface {
 	GetConsensusViewChangingID() uint64
 	GetConsensusCurViewID() uint64
 	GetConfig() commonRPC.Config
+	HandlerConfig() commonRPC.HandlerConfig
+	QuarantinedPeers() map[peer.ID]time.Time
+	BroadcastBreakerState() map[string]commonRPC.BreakerStatus
+	ResetBroadcastBreaker(group string) bool
 	ShutDown()
 	GetLastSigningPower() (float64, error)
 }
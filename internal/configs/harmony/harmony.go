@@ -3,6 +3,7 @@ package harmony
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
@@ -41,6 +42,7 @@ type HarmonyConfig struct {
 	GPO        GasPriceOracleConfig
 	Preimage   *PreimageConfig
 	Cache      CacheConfig
+	Handler    *HandlerConfig `toml:",omitempty"`
 }
 
 func (hc HarmonyConfig) ToRPCServerConfig() nodeconfig.RPCServerConfig {
@@ -392,6 +394,185 @@ type StagedSyncConfig struct {
 	DebugMode              bool   // log every single process and error to help to debug syncing issues (DebugMode is not accessible to the end user and is only an aid for development)
 }
 
+// HandlerConfig is the config of node message handling and broadcasting, see
+// nodeconfig.HandlerConfig for the meaning of the fields. ShardClientGroups is keyed by
+// shard ID and CrossLinkBatchMode is "Adaptive", the default, or "Steady".
+type HandlerConfig struct {
+	SalvagePartialTxDecode        bool
+	ShardClientGroups             map[string]string
+	CrossLinkAcks                 bool
+	NewBlockCoalesceWindow        time.Duration
+	CrossLinkStarvationThreshold  time.Duration
+	TxSignatureCheckPercent       int
+	HeartbeatShardsPerRound       int
+	CrossLinkFutureTolerance      uint64
+	CrossLinkWarmUp               time.Duration
+	ReadyPeerMargin               int
+	ReplayInterval                time.Duration
+	CrossLinkHeaderFetchTimeout   time.Duration
+	AcceptSelfMessages            bool
+	CrossLinkRateLimit            float64
+	CrossLinkRateBurst            int
+	CrossLinkBatchMode            string
+	MaxConcurrentSyncDecodes      int
+	SyncDecodeWait                time.Duration
+	CrossLinkContinuity           bool
+	MaxGoroutines                 int
+	TxRequeueRetries              int
+	TxRequeueBackoff              time.Duration
+	NewBlockExtraGroups           []string
+	NewBlockSkipSyncGroup         bool
+	MaxTxsPerMessage              int
+	MaxTxListBytes                int
+	MaxSyncBlocksPerMessage       int
+	MaxSyncBlocksBytes            int
+	RecordCrossLinkRecipients     bool
+	CrossLinkQuarantineThreshold  int
+	CrossLinkQuarantineWindow     time.Duration
+	CrossLinkQuarantineCooldown   time.Duration
+	CrossLinkConfirmationDepth    uint64
+	BroadcastBreakerThreshold     int
+	BroadcastBreakerCooldown      time.Duration
+	TxGossipRateLimit             float64
+	TxGossipRateBurst             int
+	SeenTxCacheSize               int
+	BlockSyncCompressThreshold    int
+	BootstrapTimeout              time.Duration
+	BootstrapCheckInterval        time.Duration
+	BootstrapCheckIntervalMin     time.Duration
+	BootstrapCheckIntervalMax     time.Duration
+	BootstrapStableChecks         int
+	BootstrapPeerTolerance        int
+	CrossLinkHeaderFetchWorkers   int
+	CrossLinkBatchSize            int
+	CrossLinkBatchCapMultiplier   int
+	CrossLinkSentWindowMultiplier int
+	CrossLinkBatchGrowthDivisor   int
+	MessageTracing                bool
+	CrossLinkSamplePercent        int
+	HeartbeatSamplePercent        int
+	BroadcastSampleJitter         time.Duration
+	CrossLinkMaxMessageSize       int
+	CrossLinkSendRetries          int
+	CrossLinkSendBackoff          time.Duration
+	CrossLinkMaxHeaderAge         uint64
+	SlashSendRetries              int
+	SlashSendBackoff              time.Duration
+	SlashDedupSize                int
+	SlashDedupTTL                 time.Duration
+	MaxConcurrentTxMessages       int
+	MaxConcurrentBlockMessages    int
+	MaxConcurrentOtherMessages    int
+	MessageHandlingWait           time.Duration
+	TxGossipCompressThreshold     int
+	TxAnnounce                    bool
+	TxRequestRateLimit            float64
+	TxRequestRateBurst            int
+}
+
+// ToHandlerConfig returns the node handler config of the Handler section, the default one if
+// the section is not set.
+func (hc HarmonyConfig) ToHandlerConfig() (nodeconfig.HandlerConfig, error) {
+	h := hc.Handler
+	if h == nil {
+		return nodeconfig.DefaultHandlerConfig(), nil
+	}
+	mode := nodeconfig.CrossLinkBatchAdaptive
+	if h.CrossLinkBatchMode != "" {
+		var err error
+		if mode, err = nodeconfig.ParseCrossLinkBatchMode(h.CrossLinkBatchMode); err != nil {
+			return nodeconfig.HandlerConfig{}, err
+		}
+	}
+	var shardClientGroups map[uint32]nodeconfig.GroupID
+	if len(h.ShardClientGroups) > 0 {
+		shardClientGroups = make(map[uint32]nodeconfig.GroupID, len(h.ShardClientGroups))
+		for shardID, group := range h.ShardClientGroups {
+			id, err := strconv.ParseUint(shardID, 10, 32)
+			if err != nil {
+				return nodeconfig.HandlerConfig{}, fmt.Errorf("invalid shard ID %q of ShardClientGroups: %w", shardID, err)
+			}
+			shardClientGroups[uint32(id)] = nodeconfig.GroupID(group)
+		}
+	}
+	var extraGroups []nodeconfig.GroupID
+	for _, group := range h.NewBlockExtraGroups {
+		extraGroups = append(extraGroups, nodeconfig.GroupID(group))
+	}
+	return nodeconfig.HandlerConfig{
+		ShardClientGroups:             shardClientGroups,
+		CrossLinkBatchMode:            mode,
+		NewBlockExtraGroups:           extraGroups,
+		SalvagePartialTxDecode:        h.SalvagePartialTxDecode,
+		CrossLinkAcks:                 h.CrossLinkAcks,
+		NewBlockCoalesceWindow:        h.NewBlockCoalesceWindow,
+		CrossLinkStarvationThreshold:  h.CrossLinkStarvationThreshold,
+		TxSignatureCheckPercent:       h.TxSignatureCheckPercent,
+		HeartbeatShardsPerRound:       h.HeartbeatShardsPerRound,
+		CrossLinkFutureTolerance:      h.CrossLinkFutureTolerance,
+		CrossLinkWarmUp:               h.CrossLinkWarmUp,
+		ReadyPeerMargin:               h.ReadyPeerMargin,
+		ReplayInterval:                h.ReplayInterval,
+		CrossLinkHeaderFetchTimeout:   h.CrossLinkHeaderFetchTimeout,
+		AcceptSelfMessages:            h.AcceptSelfMessages,
+		CrossLinkRateLimit:            h.CrossLinkRateLimit,
+		CrossLinkRateBurst:            h.CrossLinkRateBurst,
+		MaxConcurrentSyncDecodes:      h.MaxConcurrentSyncDecodes,
+		SyncDecodeWait:                h.SyncDecodeWait,
+		CrossLinkContinuity:           h.CrossLinkContinuity,
+		MaxGoroutines:                 h.MaxGoroutines,
+		TxRequeueRetries:              h.TxRequeueRetries,
+		TxRequeueBackoff:              h.TxRequeueBackoff,
+		NewBlockSkipSyncGroup:         h.NewBlockSkipSyncGroup,
+		MaxTxsPerMessage:              h.MaxTxsPerMessage,
+		MaxTxListBytes:                h.MaxTxListBytes,
+		MaxSyncBlocksPerMessage:       h.MaxSyncBlocksPerMessage,
+		MaxSyncBlocksBytes:            h.MaxSyncBlocksBytes,
+		RecordCrossLinkRecipients:     h.RecordCrossLinkRecipients,
+		CrossLinkQuarantineThreshold:  h.CrossLinkQuarantineThreshold,
+		CrossLinkQuarantineWindow:     h.CrossLinkQuarantineWindow,
+		CrossLinkQuarantineCooldown:   h.CrossLinkQuarantineCooldown,
+		CrossLinkConfirmationDepth:    h.CrossLinkConfirmationDepth,
+		BroadcastBreakerThreshold:     h.BroadcastBreakerThreshold,
+		BroadcastBreakerCooldown:      h.BroadcastBreakerCooldown,
+		TxGossipRateLimit:             h.TxGossipRateLimit,
+		TxGossipRateBurst:             h.TxGossipRateBurst,
+		SeenTxCacheSize:               h.SeenTxCacheSize,
+		BlockSyncCompressThreshold:    h.BlockSyncCompressThreshold,
+		BootstrapTimeout:              h.BootstrapTimeout,
+		BootstrapCheckInterval:        h.BootstrapCheckInterval,
+		BootstrapCheckIntervalMin:     h.BootstrapCheckIntervalMin,
+		BootstrapCheckIntervalMax:     h.BootstrapCheckIntervalMax,
+		BootstrapStableChecks:         h.BootstrapStableChecks,
+		BootstrapPeerTolerance:        h.BootstrapPeerTolerance,
+		CrossLinkHeaderFetchWorkers:   h.CrossLinkHeaderFetchWorkers,
+		CrossLinkBatchSize:            h.CrossLinkBatchSize,
+		CrossLinkBatchCapMultiplier:   h.CrossLinkBatchCapMultiplier,
+		CrossLinkSentWindowMultiplier: h.CrossLinkSentWindowMultiplier,
+		CrossLinkBatchGrowthDivisor:   h.CrossLinkBatchGrowthDivisor,
+		MessageTracing:                h.MessageTracing,
+		CrossLinkSamplePercent:        h.CrossLinkSamplePercent,
+		HeartbeatSamplePercent:        h.HeartbeatSamplePercent,
+		BroadcastSampleJitter:         h.BroadcastSampleJitter,
+		CrossLinkMaxMessageSize:       h.CrossLinkMaxMessageSize,
+		CrossLinkSendRetries:          h.CrossLinkSendRetries,
+		CrossLinkSendBackoff:          h.CrossLinkSendBackoff,
+		CrossLinkMaxHeaderAge:         h.CrossLinkMaxHeaderAge,
+		SlashSendRetries:              h.SlashSendRetries,
+		SlashSendBackoff:              h.SlashSendBackoff,
+		SlashDedupSize:                h.SlashDedupSize,
+		SlashDedupTTL:                 h.SlashDedupTTL,
+		MaxConcurrentTxMessages:       h.MaxConcurrentTxMessages,
+		MaxConcurrentBlockMessages:    h.MaxConcurrentBlockMessages,
+		MaxConcurrentOtherMessages:    h.MaxConcurrentOtherMessages,
+		MessageHandlingWait:           h.MessageHandlingWait,
+		TxGossipCompressThreshold:     h.TxGossipCompressThreshold,
+		TxAnnounce:                    h.TxAnnounce,
+		TxRequestRateLimit:            h.TxRequestRateLimit,
+		TxRequestRateBurst:            h.TxRequestRateBurst,
+	}, nil
+}
+
 type PriceLimit int64
 
 func (s *PriceLimit) UnmarshalTOML(data interface{}) error {
@@ -6,10 +6,12 @@ package nodeconfig
 import (
 	"fmt"
 	"math/big"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/harmony-one/abool"
 	bls_core "github.com/harmony-one/bls/ffi/go/bls"
 	"github.com/harmony-one/harmony/crypto/bls"
 	shardingconfig "github.com/harmony-one/harmony/internal/configs/sharding"
@@ -133,6 +135,316 @@ type ConfigType struct {
 		Hooks *webhooks.Hooks
 	}
 	TraceEnable bool
+	// Handler holds the settings of node message handling and broadcasting
+	Handler HandlerConfig
+	// blockBroadcastPaused stops the node broadcasting the blocks it produces, for maintenance
+	blockBroadcastPaused abool.AtomicBool
+}
+
+// SetBlockBroadcastEnabled sets whether the node broadcasts the new blocks it produces
+func (conf *ConfigType) SetBlockBroadcastEnabled(enabled bool) {
+	conf.blockBroadcastPaused.SetTo(!enabled)
+}
+
+// BlockBroadcastEnabled returns whether the node broadcasts the new blocks it produces
+func (conf *ConfigType) BlockBroadcastEnabled() bool {
+	return !conf.blockBroadcastPaused.IsSet()
+}
+
+// CrossLinkBatchMode defines how the size of crosslink broadcasts follows the backlog.
+type CrossLinkBatchMode byte
+
+// All constants for crosslink batch modes.
+const (
+	// CrossLinkBatchAdaptive grows the batches with the backlog for a fast catch-up
+	CrossLinkBatchAdaptive CrossLinkBatchMode = iota
+	// CrossLinkBatchSteady keeps the batches small for a smooth beacon chain load
+	CrossLinkBatchSteady
+)
+
+func (mode CrossLinkBatchMode) String() string {
+	switch mode {
+	case CrossLinkBatchSteady:
+		return "Steady"
+	default:
+		return "Adaptive"
+	}
+}
+
+// ParseCrossLinkBatchMode returns the crosslink batch mode of the given name, as returned
+// by String and in any case.
+func ParseCrossLinkBatchMode(name string) (CrossLinkBatchMode, error) {
+	for _, mode := range []CrossLinkBatchMode{CrossLinkBatchAdaptive, CrossLinkBatchSteady} {
+		if strings.EqualFold(name, mode.String()) {
+			return mode, nil
+		}
+	}
+	return CrossLinkBatchAdaptive, errors.Errorf("unknown crosslink batch mode %q", name)
+}
+
+// The defaults of the crosslink batch tunables of the handler config.
+const (
+	DefaultCrossLinkBatchSize            = 3
+	DefaultCrossLinkBatchCapMultiplier   = 2
+	DefaultCrossLinkSentWindowMultiplier = 6
+	DefaultCrossLinkBatchGrowthDivisor   = 5
+)
+
+// DefaultHandlerConfig returns the handler config of the default behaviour, the crosslink
+// batch tunables set to their defaults.
+func DefaultHandlerConfig() HandlerConfig {
+	return HandlerConfig{
+		CrossLinkBatchSize:            DefaultCrossLinkBatchSize,
+		CrossLinkBatchCapMultiplier:   DefaultCrossLinkBatchCapMultiplier,
+		CrossLinkSentWindowMultiplier: DefaultCrossLinkSentWindowMultiplier,
+		CrossLinkBatchGrowthDivisor:   DefaultCrossLinkBatchGrowthDivisor,
+	}
+}
+
+// HandlerConfig is the config for handling incoming node messages and broadcasting
+// blocks and crosslinks. Zero values keep the default behaviour, but for the crosslink
+// batch tunables which DefaultHandlerConfig sets.
+type HandlerConfig struct {
+	// SalvagePartialTxDecode keeps the transactions decoded before a malformed one
+	// in a transaction list instead of dropping the whole list
+	SalvagePartialTxDecode bool
+	// ShardClientGroups maps a shard ID to the client group its new blocks are
+	// broadcast to. Shards without a mapping use the node's client group.
+	ShardClientGroups map[uint32]GroupID
+	// CrossLinkAcks enables beacon chain acknowledgements of accepted crosslinks,
+	// both sending them on the beacon chain and applying them on shard chains
+	CrossLinkAcks bool
+	// NewBlockCoalesceWindow broadcasts the new blocks produced within the window
+	// as one sync message, it is capped to a quarter of the block period. Zero
+	// broadcasts every block right away.
+	NewBlockCoalesceWindow time.Duration
+	// CrossLinkStarvationThreshold forces a crosslink broadcast from a non-leader
+	// which has not sent one for this long, zero disables it
+	CrossLinkStarvationThreshold time.Duration
+	// TxSignatureCheckPercent is the percentage of gossiped transactions whose
+	// signature is verified before they reach the pool, zero disables it
+	TxSignatureCheckPercent int
+	// HeartbeatShardsPerRound is the number of shards a crosslink heartbeat broadcast
+	// covers, successive broadcasts continue round-robin, zero covers all shards
+	HeartbeatShardsPerRound int
+	// CrossLinkFutureTolerance is how many blocks an incoming crosslink may be ahead of
+	// the shard's last crosslink on the beacon chain, zero disables the check
+	CrossLinkFutureTolerance uint64
+	// CrossLinkWarmUp defers crosslink broadcasts after startup until this period passes
+	// or the crosslink state is known from the beacon chain, zero disables it
+	CrossLinkWarmUp time.Duration
+	// ReadyPeerMargin is the peer count hysteresis of consensus readiness: the node becomes
+	// ready with MinPeers plus the margin and unready below MinPeers minus the margin
+	ReadyPeerMargin int
+	// ReplayInterval is the pause between the messages fed by ReplayMessages
+	ReplayInterval time.Duration
+	// CrossLinkHeaderFetchTimeout bounds the time spent reading the headers of a
+	// crosslink broadcast, zero means no bound
+	CrossLinkHeaderFetchTimeout time.Duration
+	// AcceptSelfMessages handles the node messages this node published itself when they
+	// loop back to it, instead of dropping them
+	AcceptSelfMessages bool
+	// CrossLinkRateLimit is the number of crosslinks per second the beacon chain accepts
+	// from each peer, and of verified crosslinks from each shard, zero disables the limits
+	CrossLinkRateLimit float64
+	// CrossLinkRateBurst is the number of crosslinks a peer, or a shard, can send at once
+	// above the rate limit, zero uses a default leaving room for catch-up
+	CrossLinkRateBurst int
+	// CrossLinkBatchMode is how the size of crosslink broadcasts follows the backlog
+	CrossLinkBatchMode CrossLinkBatchMode
+	// MaxConcurrentSyncDecodes is the number of block sync messages decoded at the same
+	// time, zero disables the limit
+	MaxConcurrentSyncDecodes int
+	// SyncDecodeWait is how long a block sync message waits for a decode slot before
+	// it is dropped, zero drops it right away
+	SyncDecodeWait time.Duration
+	// CrossLinkContinuity makes the beacon chain accept only the crosslink immediately
+	// following the last known crosslink of its shard
+	CrossLinkContinuity bool
+	// MaxGoroutines is the number of goroutines the node package spawns for message
+	// handling and broadcasts at the same time, zero disables the cap. It does not cover
+	// the crosslink header fetch workers, bounded by CrossLinkHeaderFetchWorkers per
+	// broadcast, nor the new block broadcast retries of the consensus package, one per
+	// failed broadcast
+	MaxGoroutines int
+	// TxRequeueRetries is how many times a gossiped transaction batch the pool rejected
+	// for a transient reason is offered again, zero drops it right away
+	TxRequeueRetries int
+	// TxRequeueBackoff is the delay before the first retry of a transaction batch, doubled
+	// on each further retry, zero uses a default
+	TxRequeueBackoff time.Duration
+	// NewBlockExtraGroups are the groups new blocks are broadcast to next to the client
+	// group, such as explorer or state sync follower groups
+	NewBlockExtraGroups []GroupID
+	// NewBlockSkipSyncGroup stops broadcasting new blocks to the shard group of the nodes
+	// syncing the shard, for single node and test setups. The shard group is on by default,
+	// which costs one more block message per new block on the shard group, and the peers
+	// subscribed to both the client and the shard group receive each new block twice
+	NewBlockSkipSyncGroup bool
+	// MaxTxsPerMessage is the number of transactions of a transaction message which are
+	// accepted, messages with more are rejected, zero uses a generous default
+	MaxTxsPerMessage int
+	// MaxTxListBytes is the size of the transaction list of a transaction message which is
+	// accepted, larger messages are rejected, zero uses a generous default
+	MaxTxListBytes int
+	// MaxSyncBlocksPerMessage is the number of blocks of a blocks sync message which are
+	// accepted, messages with more are rejected, zero uses a generous default
+	MaxSyncBlocksPerMessage int
+	// MaxSyncBlocksBytes is the size of the block list of a blocks sync message, decompressed,
+	// which is accepted, larger messages are rejected, zero uses a generous default
+	MaxSyncBlocksBytes int
+	// RecordCrossLinkRecipients keeps the peers the last crosslink broadcast was sent to
+	RecordCrossLinkRecipients bool
+	// CrossLinkQuarantineThreshold is the number of invalid crosslinks a peer can send within
+	// the quarantine window before its crosslinks are dropped, zero disables the quarantine
+	CrossLinkQuarantineThreshold int
+	// CrossLinkQuarantineWindow is the period invalid crosslinks of a peer are counted over,
+	// zero uses a default
+	CrossLinkQuarantineWindow time.Duration
+	// CrossLinkQuarantineCooldown is how long the crosslinks of a quarantined peer are dropped,
+	// zero uses a default
+	CrossLinkQuarantineCooldown time.Duration
+	// CrossLinkConfirmationDepth is the number of blocks on top of a block before it is
+	// crosslinked, zero crosslinks the most recent blocks
+	CrossLinkConfirmationDepth uint64
+	// BroadcastBreakerThreshold is the number of consecutive send failures after which a group
+	// is not sent to for a while, zero disables the breaker
+	BroadcastBreakerThreshold int
+	// BroadcastBreakerCooldown is how long a group is not sent to once its breaker opened,
+	// zero uses a default
+	BroadcastBreakerCooldown time.Duration
+	// TxGossipRateLimit is the number of transaction messages per second processed from each
+	// publisher, zero or a negative value disables the limit. Nodes publish one message per
+	// transaction they broadcast, so it has to be above the rate of the busiest RPC nodes.
+	TxGossipRateLimit float64
+	// TxGossipRateBurst is the number of transaction messages a peer can send at once above
+	// the rate limit, zero uses a default
+	TxGossipRateBurst int
+	// SeenTxCacheSize is the number of recently gossiped transaction hashes remembered to drop
+	// duplicate transactions, zero uses a default and a negative value disables the cache
+	SeenTxCacheSize int
+	// BlockSyncCompressThreshold is the size from which the blocks of a new block broadcast
+	// are compressed, zero disables compression. Compressed blocks are sent in a version 2
+	// envelope, which older nodes reject, so they are sent from the MessageVersion2Epoch of
+	// the chain config only.
+	BlockSyncCompressThreshold int
+	// BootstrapTimeout is how long consensus bootstrap waits for the min peers, zero uses a default
+	BootstrapTimeout time.Duration
+	// BootstrapCheckInterval is the delay before the first peer count check of consensus
+	// bootstrap, zero uses a default
+	BootstrapCheckInterval time.Duration
+	// BootstrapCheckIntervalMin is the delay between peer count checks once the number of
+	// peers grew, doubled on each check without progress, zero uses a default
+	BootstrapCheckIntervalMin time.Duration
+	// BootstrapCheckIntervalMax is the longest delay between peer count checks, zero uses a default
+	BootstrapCheckIntervalMax time.Duration
+	// BootstrapStableChecks is the number of consecutive peer count checks which must reach
+	// the min peers before consensus starts, zero uses a default
+	BootstrapStableChecks int
+	// BootstrapPeerTolerance is the number of peers consensus may be short of the min peers
+	// to start anyway once bootstrap timed out, zero disables it
+	BootstrapPeerTolerance int
+	// CrossLinkHeaderFetchWorkers is the number of headers fetched concurrently for a crosslink
+	// broadcast, zero uses a default
+	CrossLinkHeaderFetchWorkers int
+	// CrossLinkBatchSize is the base number of crosslinks of a broadcast
+	CrossLinkBatchSize int
+	// CrossLinkBatchCapMultiplier is the multiple of CrossLinkBatchSize an adaptive batch
+	// grows up to
+	CrossLinkBatchCapMultiplier int
+	// CrossLinkSentWindowMultiplier is the multiple of CrossLinkBatchSize by which the last
+	// sent crosslink may be ahead of the beacon chain and still be built upon
+	CrossLinkSentWindowMultiplier int
+	// CrossLinkBatchGrowthDivisor is the number of blocks behind for which an adaptive batch
+	// grows by one crosslink
+	CrossLinkBatchGrowthDivisor int
+	// MessageTracing traces the handling of node messages with the global OpenTelemetry
+	// tracer provider, with no cost when disabled
+	MessageTracing bool
+	// CrossLinkSamplePercent is the percentage of crosslink broadcast rounds a non-leader
+	// takes part in, zero uses a default and a negative value disables it
+	CrossLinkSamplePercent int
+	// HeartbeatSamplePercent is the percentage of crosslink heartbeat broadcast rounds a
+	// non-leader takes part in, zero uses a default and a negative value disables it
+	HeartbeatSamplePercent int
+	// BroadcastSampleJitter is the longest random delay of a broadcast by a sampled
+	// non-leader, zero uses a default and a negative value sends without delay
+	BroadcastSampleJitter time.Duration
+	// CrossLinkMaxMessageSize is the size limit of a crosslink message, the crosslinks of
+	// a broadcast are split into several messages over it, zero uses a default
+	CrossLinkMaxMessageSize int
+	// CrossLinkSendRetries is the number of times a failed crosslink message is sent again
+	// within a broadcast, zero uses a default and a negative value disables the retries
+	CrossLinkSendRetries int
+	// CrossLinkSendBackoff is the delay before the first retry of a crosslink message,
+	// doubled on each retry, zero uses a default
+	CrossLinkSendBackoff time.Duration
+	// CrossLinkMaxHeaderAge is the number of blocks behind the current block past which
+	// the crosslink of a block is no longer sent, zero sends crosslinks of any age
+	CrossLinkMaxHeaderAge uint64
+	// SlashSendRetries is the number of times a failed slash record message is sent again,
+	// zero uses a default and a negative value disables the retries
+	SlashSendRetries int
+	// SlashSendBackoff is the delay before the first retry of a slash record message,
+	// doubled on each retry, zero uses a default
+	SlashSendBackoff time.Duration
+	// SlashDedupSize is the number of sent slash records remembered so that they are not
+	// broadcast again, zero uses a default
+	SlashDedupSize int
+	// SlashDedupTTL is how long a sent slash record is not broadcast again, zero uses a default
+	SlashDedupTTL time.Duration
+	// MaxConcurrentTxMessages is the number of transaction and staking messages handled
+	// at the same time, zero disables the limit
+	MaxConcurrentTxMessages int
+	// MaxConcurrentBlockMessages is the number of block messages handled at the same
+	// time, zero disables the limit
+	MaxConcurrentBlockMessages int
+	// MaxConcurrentOtherMessages is the number of other node messages handled at the same
+	// time, zero disables the limit
+	MaxConcurrentOtherMessages int
+	// MessageHandlingWait is how long a node message waits for a handling slot of its
+	// class before it is dropped, zero drops it right away
+	MessageHandlingWait time.Duration
+	// TxGossipCompressThreshold is the size from which the transaction lists gossiped by the
+	// node are compressed, zero uses a default and a negative value disables compression.
+	// Compressed lists are sent in a version 2 envelope, which older nodes reject, so they
+	// are sent from the MessageVersion2Epoch of the chain config only.
+	TxGossipCompressThreshold int
+	// TxAnnounce makes the node announce the hashes of the transactions it broadcasts instead
+	// of gossiping them, the peers missing one request it directly from the peer which relayed
+	// the announce to them. The announces are sent in a version 2 envelope, which older
+	// nodes reject, so they are sent from the MessageVersion2Epoch of the chain config only.
+	TxAnnounce bool
+	// TxRequestRateLimit is the number of transaction announces and requests per second
+	// processed from each peer, zero uses a default and a negative value disables the limit
+	TxRequestRateLimit float64
+	// TxRequestRateBurst is the number of transaction announces and requests a peer can send
+	// at once above the rate limit, zero uses a default
+	TxRequestRateBurst int
+}
+
+// Validate returns an error if a crosslink batch tunable is not positive or an extra new
+// block group is empty.
+func (c HandlerConfig) Validate() error {
+	for i, g := range c.NewBlockExtraGroups {
+		if g == "" {
+			return errors.Errorf("invalid handler config: NewBlockExtraGroups entry %d is empty", i)
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value int
+	}{
+		{"CrossLinkBatchSize", c.CrossLinkBatchSize},
+		{"CrossLinkBatchCapMultiplier", c.CrossLinkBatchCapMultiplier},
+		{"CrossLinkSentWindowMultiplier", c.CrossLinkSentWindowMultiplier},
+		{"CrossLinkBatchGrowthDivisor", c.CrossLinkBatchGrowthDivisor},
+	} {
+		if field.value <= 0 {
+			return errors.Errorf("invalid handler config: %s must be positive, got %d", field.name, field.value)
+		}
+	}
+	return nil
 }
 
 // RPCServerConfig is the config for rpc listen addresses
@@ -257,6 +569,42 @@ func (conf *ConfigType) GetClientGroupID() GroupID {
 	return conf.client
 }
 
+// ClientGroupIDForShard returns the client group new blocks of the given shard are broadcast to
+func (conf *ConfigType) ClientGroupIDForShard(shardID uint32) GroupID {
+	if g, ok := conf.Handler.ShardClientGroups[shardID]; ok {
+		return g
+	}
+	return conf.client
+}
+
+// SyncGroupIDForShard returns the group new blocks of the given shard are broadcast to
+// for the nodes syncing the shard
+func SyncGroupIDForShard(shardID uint32) GroupID {
+	return NewGroupIDByShardID(ShardID(shardID))
+}
+
+// ErrNoNewBlockGroups is returned when there is no group to broadcast a new block to.
+var ErrNoNewBlockGroups = errors.New("no group to broadcast new blocks to")
+
+// NewBlockGroupIDs returns the groups new blocks of the given shard are broadcast to: the
+// client group, the shard group unless Handler.NewBlockSkipSyncGroup is set, and the extra
+// groups. Unset groups are left out, so that the list is empty if no group is set.
+func (conf *ConfigType) NewBlockGroupIDs(shardID uint32) []GroupID {
+	var groups []GroupID
+	if g := conf.ClientGroupIDForShard(shardID); g != "" {
+		groups = append(groups, g)
+	}
+	if !conf.Handler.NewBlockSkipSyncGroup {
+		groups = append(groups, SyncGroupIDForShard(shardID))
+	}
+	for _, g := range conf.Handler.NewBlockExtraGroups {
+		if g != "" && !slices.Contains(groups, g) {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
+
 // GetArchival returns archival mode
 func (conf *ConfigType) GetArchival() bool {
 	return conf.isArchival[conf.ShardID]
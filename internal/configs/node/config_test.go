@@ -46,6 +46,93 @@ func TestNodeConfigMultiple(t *testing.T) {
 	}
 }
 
+func TestClientGroupIDForShard(t *testing.T) {
+	conf := ConfigType{}
+	conf.SetClientGroupID("client")
+	if g := conf.ClientGroupIDForShard(1); g != "client" {
+		t.Errorf("expecting client, got: %v", g)
+	}
+
+	conf.Handler.ShardClientGroups = map[uint32]GroupID{1: "client1"}
+	if g := conf.ClientGroupIDForShard(1); g != "client1" {
+		t.Errorf("expecting client1, got: %v", g)
+	}
+	if g := conf.ClientGroupIDForShard(2); g != "client" {
+		t.Errorf("expecting client, got: %v", g)
+	}
+}
+
+func TestNewBlockGroupIDs(t *testing.T) {
+	conf := ConfigType{}
+	conf.SetClientGroupID("client")
+	syncGroup := SyncGroupIDForShard(1)
+	if g := conf.NewBlockGroupIDs(1); len(g) != 2 || g[0] != "client" || g[1] != syncGroup {
+		t.Errorf("expecting [client %s], got: %v", syncGroup, g)
+	}
+
+	conf.Handler.NewBlockSkipSyncGroup = true
+	if g := conf.NewBlockGroupIDs(1); len(g) != 1 || g[0] != "client" {
+		t.Errorf("expecting [client], got: %v", g)
+	}
+
+	conf.Handler.NewBlockExtraGroups = []GroupID{"explorer", "client", "sync"}
+	g := conf.NewBlockGroupIDs(1)
+	if len(g) != 3 || g[0] != "client" || g[1] != "explorer" || g[2] != "sync" {
+		t.Errorf("expecting [client explorer sync], got: %v", g)
+	}
+
+	conf = ConfigType{}
+	conf.Handler.NewBlockSkipSyncGroup = true
+	if g := conf.NewBlockGroupIDs(1); len(g) != 0 {
+		t.Errorf("expecting no group without client group, got: %v", g)
+	}
+}
+
+func TestHandlerConfigValidate(t *testing.T) {
+	if err := DefaultHandlerConfig().Validate(); err != nil {
+		t.Errorf("expected the default config to be valid, got %v", err)
+	}
+	valid := HandlerConfig{
+		CrossLinkBatchSize:            4,
+		CrossLinkBatchCapMultiplier:   3,
+		CrossLinkSentWindowMultiplier: 6,
+		CrossLinkBatchGrowthDivisor:   2,
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("expected a valid config, got %v", err)
+	}
+	for _, change := range []func(*HandlerConfig){
+		func(c *HandlerConfig) { c.CrossLinkBatchSize = 0 },
+		func(c *HandlerConfig) { c.CrossLinkBatchCapMultiplier = -1 },
+		func(c *HandlerConfig) { c.CrossLinkSentWindowMultiplier = 0 },
+		func(c *HandlerConfig) { c.CrossLinkBatchGrowthDivisor = -1 },
+		func(c *HandlerConfig) { c.NewBlockExtraGroups = []GroupID{"explorer", ""} },
+	} {
+		invalid := DefaultHandlerConfig()
+		change(&invalid)
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", invalid)
+		}
+	}
+	if err := (HandlerConfig{}).Validate(); err == nil {
+		t.Error("expected the zero crosslink batch tunables to be rejected")
+	}
+}
+
+func TestParseCrossLinkBatchMode(t *testing.T) {
+	for name, want := range map[string]CrossLinkBatchMode{
+		"Adaptive": CrossLinkBatchAdaptive,
+		"steady":   CrossLinkBatchSteady,
+	} {
+		if mode, err := ParseCrossLinkBatchMode(name); err != nil || mode != want {
+			t.Errorf("%s: expected %v, got %v, %v", name, want, mode, err)
+		}
+	}
+	if _, err := ParseCrossLinkBatchMode("fast"); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
+
 func TestValidateConsensusKeysForSameShard(t *testing.T) {
 	// set localnet config
 	networkType := "localnet"
@@ -84,6 +84,7 @@ var (
 		IsOneSecondEpoch:                      EpochTBD,
 		EIP2537PrecompileEpoch:                EpochTBD,
 		EIP1153TransientStorageEpoch:          EpochTBD,
+		MessageVersion2Epoch:                  EpochTBD,
 	}
 
 	// TestnetChainConfig contains the chain parameters to run a node on the harmony test network.
@@ -136,6 +137,7 @@ var (
 		IsOneSecondEpoch:                      EpochTBD,
 		EIP2537PrecompileEpoch:                EpochTBD,
 		EIP1153TransientStorageEpoch:          big.NewInt(6280),
+		MessageVersion2Epoch:                  EpochTBD,
 	}
 	// PangaeaChainConfig contains the chain parameters for the Pangaea network.
 	// All features except for CrossLink are enabled at launch.
@@ -188,6 +190,7 @@ var (
 		IsOneSecondEpoch:                      EpochTBD,
 		EIP2537PrecompileEpoch:                EpochTBD,
 		EIP1153TransientStorageEpoch:          EpochTBD,
+		MessageVersion2Epoch:                  EpochTBD,
 	}
 
 	// PartnerChainConfig contains the chain parameters for the Partner network.
@@ -241,6 +244,7 @@ var (
 		IsOneSecondEpoch:                      big.NewInt(17436),
 		EIP2537PrecompileEpoch:                EpochTBD,
 		EIP1153TransientStorageEpoch:          big.NewInt(35626),
+		MessageVersion2Epoch:                  EpochTBD,
 	}
 
 	// StressnetChainConfig contains the chain parameters for the Stress test network.
@@ -294,6 +298,7 @@ var (
 		IsOneSecondEpoch:                      EpochTBD,
 		EIP2537PrecompileEpoch:                EpochTBD,
 		EIP1153TransientStorageEpoch:          EpochTBD,
+		MessageVersion2Epoch:                  EpochTBD,
 	}
 
 	// LocalnetChainConfig contains the chain parameters to run for local development.
@@ -346,6 +351,7 @@ var (
 		IsOneSecondEpoch:                      big.NewInt(4),
 		EIP2537PrecompileEpoch:                EpochTBD,
 		EIP1153TransientStorageEpoch:          EpochTBD,
+		MessageVersion2Epoch:                  big.NewInt(0),
 	}
 
 	// AllProtocolChanges ...
@@ -400,6 +406,7 @@ var (
 		big.NewInt(0),                      // HIP32Epoch
 		big.NewInt(0),                      // IsOneSecondEpoch
 		big.NewInt(0),                      // EIP1153TransientStorageEpoch
+		big.NewInt(0),                      // MessageVersion2Epoch
 	}
 
 	// TestChainConfig ...
@@ -454,6 +461,7 @@ var (
 		big.NewInt(0),        // HIP32Epoch
 		big.NewInt(0),        // IsOneSecondEpoch
 		big.NewInt(0),        // EIP1153TransientStorageEpoch
+		big.NewInt(0),        // MessageVersion2Epoch
 	}
 
 	// TestRules ...
@@ -645,6 +653,10 @@ type ChainConfig struct {
 
 	// EIP2537PrecompileEpoch is the first epoch to support the EIP-2537 precompiles
 	EIP1153TransientStorageEpoch *big.Int `json:"eip1153-transient-storage-epoch,omitempty"`
+
+	// MessageVersion2Epoch is the first epoch the nodes send the node messages of version 2,
+	// which the nodes of older releases reject. It is set once the network upgraded.
+	MessageVersion2Epoch *big.Int `json:"message-version2-epoch,omitempty"`
 }
 
 // String implements the fmt.Stringer interface.
@@ -889,6 +901,11 @@ func (c *ChainConfig) IsEIP1153TransientStorage(epoch *big.Int) bool {
 	return isForked(c.EIP1153TransientStorageEpoch, epoch)
 }
 
+// IsMessageVersion2 determines whether the node messages of version 2 are sent
+func (c *ChainConfig) IsMessageVersion2(epoch *big.Int) bool {
+	return isForked(c.MessageVersion2Epoch, epoch)
+}
+
 // IsChainIdFix returns whether epoch is either equal to the ChainId Fix fork epoch or greater.
 func (c *ChainConfig) IsChainIdFix(epoch *big.Int) bool {
 	return isForked(c.ChainIdFixEpoch, epoch)
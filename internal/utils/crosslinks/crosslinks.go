@@ -1,18 +1,45 @@
 package crosslinks
 
 import (
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/harmony-one/harmony/core/types"
 )
 
+const (
+	// maxSentMessages is the maximum number of broadcast crosslink messages kept for replay.
+	maxSentMessages = 128
+	// maxSentMessageAge is how long a broadcast crosslink message is kept for replay.
+	maxSentMessageAge = 10 * time.Minute
+)
+
+// SentMessage is a crosslink message which was broadcast to the beacon chain.
+type SentMessage struct {
+	FirstBlockNum uint64
+	LastBlockNum  uint64
+	Payload       []byte
+	SentAt        time.Time
+}
+
 // Crosslinks is helper for processing crosslinks. It has meaning only for shards.
 type Crosslinks struct {
 	// This number stores value we have already sent.
 	// It can be ahead of CrosslinkHeartbeat.LatestContinuousBlockNum, because processing of crosslink takes some time.
 	latestSentCrosslinkBlockNumber uint64
+	// Highest block number the beacon chain acknowledged accepting crosslinks up to.
+	latestAcceptedCrosslinkBlockNumber uint64
 	// Latest received valid heartbeat signal.
 	lastKnownCrosslinkHeartbeatSignal atomic.Value
+	// Latest received valid heartbeat signal of each shard.
+	signalsMu        sync.RWMutex
+	heartbeatSignals map[uint32]*types.CrosslinkHeartbeat
+
+	// Recently broadcast crosslink messages, oldest first.
+	sentMu     sync.Mutex
+	sentMsgs   []SentMessage
+	lastSentAt time.Time
 }
 
 // New creates new Crosslinks.
@@ -30,6 +57,24 @@ func (a *Crosslinks) SetLatestSentCrosslinkBlockNumber(number uint64) {
 	atomic.StoreUint64(&a.latestSentCrosslinkBlockNumber, number)
 }
 
+// LatestAcceptedCrosslinkBlockNumber returns the block number acknowledged by the beacon chain or zero if not.
+func (a *Crosslinks) LatestAcceptedCrosslinkBlockNumber() uint64 {
+	return atomic.LoadUint64(&a.latestAcceptedCrosslinkBlockNumber)
+}
+
+// AdvanceLatestAcceptedCrosslinkBlockNumber sets the acknowledged block number if it is higher than the current one.
+func (a *Crosslinks) AdvanceLatestAcceptedCrosslinkBlockNumber(number uint64) bool {
+	for {
+		cur := atomic.LoadUint64(&a.latestAcceptedCrosslinkBlockNumber)
+		if number <= cur {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&a.latestAcceptedCrosslinkBlockNumber, cur, number) {
+			return true
+		}
+	}
+}
+
 // LastKnownCrosslinkHeartbeatSignal returns last set value for heartbeat or nil if not.
 func (a *Crosslinks) LastKnownCrosslinkHeartbeatSignal() *types.CrosslinkHeartbeat {
 	val := a.lastKnownCrosslinkHeartbeatSignal.Load()
@@ -39,7 +84,72 @@ func (a *Crosslinks) LastKnownCrosslinkHeartbeatSignal() *types.CrosslinkHeartbe
 	return val.(*types.CrosslinkHeartbeat)
 }
 
-// SetLastKnownCrosslinkHeartbeatSignal sets last known heartbeat.
+// SetLastKnownCrosslinkHeartbeatSignal sets last known heartbeat, also as the last known heartbeat of its shard.
 func (a *Crosslinks) SetLastKnownCrosslinkHeartbeatSignal(signal *types.CrosslinkHeartbeat) {
 	a.lastKnownCrosslinkHeartbeatSignal.Store(signal)
+
+	a.signalsMu.Lock()
+	defer a.signalsMu.Unlock()
+	if a.heartbeatSignals == nil {
+		a.heartbeatSignals = make(map[uint32]*types.CrosslinkHeartbeat)
+	}
+	a.heartbeatSignals[signal.ShardID] = signal
+}
+
+// LastKnownShardCrosslinkHeartbeatSignal returns last set value for heartbeat of shardID or nil if not.
+func (a *Crosslinks) LastKnownShardCrosslinkHeartbeatSignal(shardID uint32) *types.CrosslinkHeartbeat {
+	a.signalsMu.RLock()
+	defer a.signalsMu.RUnlock()
+
+	return a.heartbeatSignals[shardID]
+}
+
+// AddSentMessage keeps a broadcast crosslink message so it can be served again
+// to beacon nodes which missed it. The oldest messages are evicted first.
+func (a *Crosslinks) AddSentMessage(msg SentMessage) {
+	a.sentMu.Lock()
+	defer a.sentMu.Unlock()
+
+	a.sentMsgs = append(a.sentMsgs, msg)
+	if msg.SentAt.After(a.lastSentAt) {
+		a.lastSentAt = msg.SentAt
+	}
+	a.pruneSentMessages(msg.SentAt)
+}
+
+// LastSentAt returns the time of the latest crosslink broadcast or the zero time if none was sent.
+func (a *Crosslinks) LastSentAt() time.Time {
+	a.sentMu.Lock()
+	defer a.sentMu.Unlock()
+
+	return a.lastSentAt
+}
+
+// SentMessagesSince returns the kept crosslink messages containing blocks after blockNum, oldest first.
+func (a *Crosslinks) SentMessagesSince(blockNum uint64, now time.Time) []SentMessage {
+	a.sentMu.Lock()
+	defer a.sentMu.Unlock()
+
+	a.pruneSentMessages(now)
+	var out []SentMessage
+	for _, msg := range a.sentMsgs {
+		if msg.LastBlockNum > blockNum {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// pruneSentMessages drops messages exceeding the count or age bounds. Caller must hold sentMu.
+func (a *Crosslinks) pruneSentMessages(now time.Time) {
+	drop := 0
+	if len(a.sentMsgs) > maxSentMessages {
+		drop = len(a.sentMsgs) - maxSentMessages
+	}
+	for drop < len(a.sentMsgs) && now.Sub(a.sentMsgs[drop].SentAt) > maxSentMessageAge {
+		drop++
+	}
+	if drop > 0 {
+		a.sentMsgs = append(a.sentMsgs[:0:0], a.sentMsgs[drop:]...)
+	}
 }
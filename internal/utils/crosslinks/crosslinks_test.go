@@ -2,6 +2,7 @@ package crosslinks_test
 
 import (
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/harmony-one/harmony/core/types"
@@ -19,6 +20,17 @@ func TestCrosslink(t *testing.T) {
 	require.EqualValues(t, 5, s.LatestSentCrosslinkBlockNumber())
 }
 
+func TestAcceptedCrosslink(t *testing.T) {
+	t.Parallel()
+
+	s := crosslinks.New()
+	require.EqualValues(t, 0, s.LatestAcceptedCrosslinkBlockNumber())
+
+	require.True(t, s.AdvanceLatestAcceptedCrosslinkBlockNumber(10))
+	require.False(t, s.AdvanceLatestAcceptedCrosslinkBlockNumber(5))
+	require.EqualValues(t, 10, s.LatestAcceptedCrosslinkBlockNumber())
+}
+
 func TestSignal(t *testing.T) {
 	t.Parallel()
 
@@ -33,3 +45,54 @@ func TestSignal(t *testing.T) {
 	// They should have even same pointer.
 	require.Equal(t, unsafe.Pointer(signal), unsafe.Pointer(s.LastKnownCrosslinkHeartbeatSignal()))
 }
+
+func TestShardSignals(t *testing.T) {
+	t.Parallel()
+
+	s := crosslinks.New()
+	require.Nil(t, s.LastKnownShardCrosslinkHeartbeatSignal(1))
+
+	signal1 := &types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 10}
+	signal2 := &types.CrosslinkHeartbeat{ShardID: 2, LatestContinuousBlockNum: 20}
+	s.SetLastKnownCrosslinkHeartbeatSignal(signal1)
+	s.SetLastKnownCrosslinkHeartbeatSignal(signal2)
+
+	require.Equal(t, signal1, s.LastKnownShardCrosslinkHeartbeatSignal(1))
+	require.Equal(t, signal2, s.LastKnownShardCrosslinkHeartbeatSignal(2))
+	require.Nil(t, s.LastKnownShardCrosslinkHeartbeatSignal(3))
+	require.Equal(t, signal2, s.LastKnownCrosslinkHeartbeatSignal())
+}
+
+func TestSentMessages(t *testing.T) {
+	t.Parallel()
+
+	s := crosslinks.New()
+	now := time.Now()
+	require.Empty(t, s.SentMessagesSince(0, now))
+
+	s.AddSentMessage(crosslinks.SentMessage{FirstBlockNum: 1, LastBlockNum: 3, SentAt: now.Add(-time.Hour)})
+	s.AddSentMessage(crosslinks.SentMessage{FirstBlockNum: 4, LastBlockNum: 6, SentAt: now})
+	s.AddSentMessage(crosslinks.SentMessage{FirstBlockNum: 7, LastBlockNum: 9, SentAt: now})
+
+	// The message older than the age bound is gone.
+	msgs := s.SentMessagesSince(0, now)
+	require.Len(t, msgs, 2)
+	require.EqualValues(t, 4, msgs[0].FirstBlockNum)
+
+	msgs = s.SentMessagesSince(6, now)
+	require.Len(t, msgs, 1)
+	require.EqualValues(t, 9, msgs[0].LastBlockNum)
+}
+
+func TestSentMessagesCountBound(t *testing.T) {
+	t.Parallel()
+
+	s := crosslinks.New()
+	now := time.Now()
+	for i := uint64(1); i <= 200; i++ {
+		s.AddSentMessage(crosslinks.SentMessage{FirstBlockNum: i, LastBlockNum: i, SentAt: now})
+	}
+	msgs := s.SentMessagesSince(0, now)
+	require.Len(t, msgs, 128)
+	require.EqualValues(t, 73, msgs[0].FirstBlockNum)
+}
@@ -32,6 +32,11 @@ func (c *Cache[K, V]) Contains(key K) bool {
 	return c.cache.Contains(key)
 }
 
+// Remove removes a key from the cache, if present.
+func (c *Cache[K, V]) Remove(key K) {
+	c.cache.Remove(key)
+}
+
 func (c *Cache[K, V]) Len() int {
 	return c.cache.Len()
 }
@@ -26,3 +26,13 @@ func TestKeys(t *testing.T) {
 
 	require.Equal(t, m, m2)
 }
+
+func TestRemove(t *testing.T) {
+	c := NewCache[int, int](10)
+	c.Set(1, 1)
+	c.Remove(1)
+	c.Remove(2)
+
+	require.False(t, c.Contains(1))
+	require.Equal(t, 0, c.Len())
+}
@@ -1,10 +1,14 @@
 package node
 
 import (
+	"time"
+
 	"github.com/harmony-one/harmony/core/types"
 	"github.com/harmony-one/harmony/eth/rpc"
 	"github.com/harmony-one/harmony/hmy"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
 	"github.com/harmony-one/harmony/internal/tikv"
+	"github.com/harmony-one/harmony/internal/utils"
 	"github.com/harmony-one/harmony/rosetta"
 	hmy_rpc "github.com/harmony-one/harmony/rpc/harmony"
 	rpc_common "github.com/harmony-one/harmony/rpc/harmony/common"
@@ -17,6 +21,29 @@ func (node *Node) IsCurrentlyLeader() bool {
 	return node.Consensus.IsLeader()
 }
 
+// ConsensusReady returns true if the node is in sync and connected to enough peers to
+// take part in consensus. The peer count threshold has the configured hysteresis so that
+// the readiness does not flap when the peer count hovers around the minimum.
+func (node *Node) ConsensusReady() bool {
+	wasReady := node.consensusReady.IsSet()
+	ready := node.IsSynchronized.IsSet() && readyWithHysteresis(
+		wasReady, len(node.host.Network().Peers()), node.Consensus.MinPeers, node.NodeConfig.Handler.ReadyPeerMargin,
+	)
+	node.consensusReady.SetTo(ready)
+	return ready
+}
+
+// readyWithHysteresis returns the readiness for the given peer count, given the previous readiness.
+func readyWithHysteresis(wasReady bool, peers, minPeers, margin int) bool {
+	if margin < 0 {
+		margin = 0
+	}
+	if wasReady {
+		return peers >= minPeers-margin
+	}
+	return peers >= minPeers+margin
+}
+
 // PeerConnectivity ..
 func (node *Node) PeerConnectivity() (int, int, int) {
 	return node.host.PeerConnectivity()
@@ -32,6 +59,24 @@ func (node *Node) ListTopic() []string {
 	return node.host.ListTopic()
 }
 
+// SetBlockBroadcastEnabled sets whether the node broadcasts the new blocks it produces,
+// disabling it keeps consensus running during maintenance
+func (node *Node) SetBlockBroadcastEnabled(enabled bool) {
+	node.NodeConfig.SetBlockBroadcastEnabled(enabled)
+	utils.Logger().Info().Bool("enabled", enabled).Msg("block broadcast toggled")
+}
+
+// ActiveGroups returns the groups the node joined which have peers to deliver broadcasts to
+func (node *Node) ActiveGroups() []nodeconfig.GroupID {
+	var groups []nodeconfig.GroupID
+	for _, topic := range node.host.ListTopic() {
+		if len(node.host.ListPeer(topic)) > 0 {
+			groups = append(groups, nodeconfig.GroupID(topic))
+		}
+	}
+	return groups
+}
+
 // ListBlockedPeer return list of blocked peers
 func (node *Node) ListBlockedPeer() []peer.ID {
 	return node.host.ListBlockedPeer()
@@ -166,6 +211,26 @@ func (node *Node) GetConfig() rpc_common.Config {
 	}
 }
 
+// HandlerConfig returns the message handling and broadcasting configuration the node is running with
+func (node *Node) HandlerConfig() rpc_common.HandlerConfig {
+	return rpc_common.HandlerConfig{
+		HandlerConfig:         node.NodeConfig.Handler,
+		BlockBroadcastEnabled: node.NodeConfig.BlockBroadcastEnabled(),
+	}
+}
+
+// BroadcastBreakerState returns the state of the broadcast circuit breaker of every group
+// which failed since its last successful send
+func (node *Node) BroadcastBreakerState() map[string]rpc_common.BreakerStatus {
+	return node.broadcastBreaker.status(time.Now())
+}
+
+// ResetBroadcastBreaker closes the broadcast circuit breaker of group, returning false if
+// the group had no send failures
+func (node *Node) ResetBroadcastBreaker(group string) bool {
+	return node.broadcastBreaker.reset(nodeconfig.GroupID(group))
+}
+
 // GetLastSigningPower get last signed power
 func (node *Node) GetLastSigningPower() (float64, error) {
 	p := node.Consensus.GetLastKnownSignPower()
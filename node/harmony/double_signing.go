@@ -1,11 +1,107 @@
 package node
 
 import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/harmony-one/harmony/core"
+	"github.com/harmony-one/harmony/core/state"
+	"github.com/harmony-one/harmony/crypto/hash"
 	"github.com/harmony-one/harmony/internal/utils"
 	"github.com/harmony-one/harmony/staking/slash"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/pkg/errors"
+)
+
+var (
+	errSlashNoBeaconChain = errors.New("beacon chain not available to verify slash record")
+	errSlashInvalid       = errors.New("invalid slash record")
 )
 
+// slashVerifier verifies a slash record against the committees of chain and the validators
+// of state, as slash.Verify does.
+type slashVerifier func(chain slash.CommitteeReader, state *state.DB, record *slash.Record) error
+
+// verifySlash verifies record against the beacon chain, that its double signed votes are
+// signed by the offender of the committee and that the offender is not banned yet.
+func (node *Node) verifySlash(beacon core.BlockChain, record *slash.Record) error {
+	if beacon == nil {
+		return errSlashNoBeaconChain
+	}
+	beaconState, err := beacon.State()
+	if err != nil {
+		return errors.Wrap(err, "cannot read beacon chain state")
+	}
+	verify := node.slashVerifier
+	if verify == nil {
+		verify = slash.Verify
+	}
+	if err := verify(beacon, beaconState, record); err != nil {
+		return errors.WithMessagef(errSlashInvalid, "%v", err)
+	}
+	return nil
+}
+
+const (
+	// defaultSlashDedupSize is the default number of slash records remembered as sent.
+	defaultSlashDedupSize = 256
+	// defaultSlashDedupTTL is the default time a sent slash record is not broadcast again.
+	defaultSlashDedupTTL = 10 * time.Minute
+)
+
+// slashEvidenceKey returns the key of the double sign evidence of record. The votes are
+// ordered, so that the records of several witnesses of the same double sign, whatever the
+// reporter or the order in which the votes were seen, have the same key.
+func slashEvidenceKey(record *slash.Record) common.Hash {
+	evidence := record.Evidence
+	first, second := &evidence.FirstVote, &evidence.SecondVote
+	if bytes.Compare(first.BlockHeaderHash[:], second.BlockHeaderHash[:]) > 0 {
+		*first, *second = *second, *first
+	}
+	return hash.FromRLPNew256(evidence)
+}
+
+// slashDedup remembers the slash records recently sent, so that a double sign witnessed
+// several times is broadcast once. The zero value is ready to use.
+type slashDedup struct {
+	mu    sync.Mutex
+	cache *lru.Cache[common.Hash, time.Time]
+}
+
+// claim returns whether the record of key is to be sent at now, that is whether it was
+// not sent or claimed within ttl. The claimed record is remembered as sent, with at most
+// size records remembered.
+func (d *slashDedup) claim(key common.Hash, now time.Time, size int, ttl time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cache == nil {
+		if size <= 0 {
+			size = defaultSlashDedupSize
+		}
+		d.cache, _ = lru.New[common.Hash, time.Time](size)
+	}
+	if ttl <= 0 {
+		ttl = defaultSlashDedupTTL
+	}
+	if sent, ok := d.cache.Get(key); ok && now.Sub(sent) < ttl {
+		return false
+	}
+	d.cache.Add(key, now)
+	return true
+}
+
+// release forgets the record of key, as when it could not be sent.
+func (d *slashDedup) release(key common.Hash) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cache != nil {
+		d.cache.Remove(key)
+	}
+}
+
 // ProcessSlashCandidateMessage ..
 func (node *Node) processSlashCandidateMessage(msgPayload []byte) {
 	if !node.IsRunningBeaconChain() {
@@ -0,0 +1,295 @@
+package node
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/harmony-one/harmony/core"
+	"github.com/harmony-one/harmony/core/rawdb"
+	"github.com/harmony-one/harmony/core/state"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/params"
+	"github.com/harmony-one/harmony/p2p"
+	"github.com/harmony-one/harmony/shard"
+	"github.com/harmony-one/harmony/staking/slash"
+)
+
+// stateChain is a beacon chain with an empty state.
+type stateChain struct {
+	core.Stub
+	state *state.DB
+}
+
+func newStateChain(t *testing.T) stateChain {
+	db, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stateChain{state: db}
+}
+
+func (c stateChain) State() (*state.DB, error) {
+	return c.state, nil
+}
+
+func (c stateChain) Config() *params.ChainConfig {
+	return params.TestChainConfig
+}
+
+func testSlashRecord() *slash.Record {
+	return &slash.Record{
+		Evidence: slash.Evidence{
+			Moment:   slash.Moment{Epoch: big.NewInt(1), ShardID: 1, Height: 10},
+			Offender: common.BigToAddress(big.NewInt(1)),
+		},
+		Reporter: common.BigToAddress(big.NewInt(2)),
+	}
+}
+
+func TestBroadcastSlash(t *testing.T) {
+	errDoubleSign := errors.New("no double sign")
+	tests := []struct {
+		name     string
+		beacon   func(t *testing.T) core.BlockChain
+		verifier slashVerifier
+		wantErr  error
+	}{
+		{
+			name:     "valid record",
+			beacon:   func(t *testing.T) core.BlockChain { return newStateChain(t) },
+			verifier: func(slash.CommitteeReader, *state.DB, *slash.Record) error { return nil },
+		},
+		{
+			name:     "invalid record",
+			beacon:   func(t *testing.T) core.BlockChain { return newStateChain(t) },
+			verifier: func(slash.CommitteeReader, *state.DB, *slash.Record) error { return errDoubleSign },
+			wantErr:  errSlashInvalid,
+		},
+		{
+			// the offender is not a validator of the beacon chain state
+			name:    "unknown offender",
+			beacon:  func(t *testing.T) core.BlockChain { return newStateChain(t) },
+			wantErr: errSlashInvalid,
+		},
+		{
+			name:    "no beacon chain",
+			beacon:  func(t *testing.T) core.BlockChain { return nil },
+			wantErr: errSlashNoBeaconChain,
+		},
+	}
+	for _, test := range tests {
+		host := &recordingHost{}
+		node := &Node{
+			host:          host,
+			NodeConfig:    &nodeconfig.ConfigType{ShardID: 1},
+			slashVerifier: test.verifier,
+		}
+		err := node.broadcastSlash(test.beacon(t), testSlashRecord())
+		if test.wantErr == nil {
+			if err != nil {
+				t.Errorf("%s: expected the record to be sent, got %v", test.name, err)
+			}
+			sent := host.sentMessages()
+			if len(sent) != 1 || sent[0].groups[0] != nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID) {
+				t.Errorf("%s: expected one message to the beacon chain, got %v", test.name, sent)
+			}
+			continue
+		}
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+		if calls := host.sendCalls(); calls != 0 {
+			t.Errorf("%s: expected invalid record not to be sent, got %d sends", test.name, calls)
+		}
+	}
+}
+
+func TestBroadcastSlashBeaconStateUnavailable(t *testing.T) {
+	host := &recordingHost{}
+	node := &Node{host: host, NodeConfig: &nodeconfig.ConfigType{ShardID: 1}}
+	if err := node.broadcastSlash(core.Stub{}, testSlashRecord()); err == nil {
+		t.Fatal("expected an error without beacon chain state")
+	}
+	if calls := host.sendCalls(); calls != 0 {
+		t.Errorf("expected no send without beacon chain state, got %d", calls)
+	}
+}
+
+func TestBroadcastSlashDelivery(t *testing.T) {
+	valid := func(slash.CommitteeReader, *state.DB, *slash.Record) error { return nil }
+	newNode := func(host p2p.Host) *Node {
+		return &Node{
+			host: host,
+			NodeConfig: &nodeconfig.ConfigType{ShardID: 1, Handler: nodeconfig.HandlerConfig{
+				SlashSendRetries: 1,
+				SlashSendBackoff: time.Millisecond,
+			}},
+			slashVerifier: valid,
+		}
+	}
+	counter := func(outcome string) float64 {
+		return (&Node{}).MetricsSnapshot()[`hmy_node_slash_broadcast{outcome="`+outcome+`"}`]
+	}
+
+	failed, retried := counter("send_failed"), counter("retry")
+	errSend := errors.New("send failure")
+	host := &recordingHost{err: errSend}
+	if err := newNode(host).broadcastSlash(newStateChain(t), testSlashRecord()); !errors.Is(err, errSend) {
+		t.Fatalf("expected the send error, got %v", err)
+	}
+	if calls := host.sendCalls(); calls != 2 {
+		t.Errorf("expected the failed send to be retried once, got %d sends", calls)
+	}
+	if got := counter("send_failed"); got != failed+1 {
+		t.Errorf("expected the send failure counter to increment, got %v -> %v", failed, got)
+	}
+	if got := counter("retry"); got != retried+1 {
+		t.Errorf("expected the retry counter to increment, got %v -> %v", retried, got)
+	}
+
+	sent := counter("sent")
+	flaky := &flakyHost{failures: 1}
+	if err := newNode(flaky).broadcastSlash(newStateChain(t), testSlashRecord()); err != nil {
+		t.Fatalf("expected the retry to send the record, got %v", err)
+	}
+	if got := counter("sent"); got != sent+1 {
+		t.Errorf("expected the sent counter to increment, got %v -> %v", sent, got)
+	}
+}
+
+func TestBroadcastSlashDedup(t *testing.T) {
+	host := &recordingHost{}
+	node := &Node{
+		host:          host,
+		NodeConfig:    &nodeconfig.ConfigType{ShardID: 1},
+		slashVerifier: func(slash.CommitteeReader, *state.DB, *slash.Record) error { return nil },
+	}
+	record := testSlashRecord()
+	record.Evidence.FirstVote.BlockHeaderHash = common.HexToHash("0x01")
+	record.Evidence.SecondVote.BlockHeaderHash = common.HexToHash("0x02")
+	for i := 0; i < 2; i++ {
+		if err := node.broadcastSlash(newStateChain(t), record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := host.sendCalls(); calls != 1 {
+		t.Fatalf("expected the same record to be sent once, got %d sends", calls)
+	}
+
+	// the same double sign seen by another witness, with the votes swapped
+	witnessed := *record
+	witnessed.Reporter = common.BigToAddress(big.NewInt(3))
+	witnessed.Evidence.FirstVote, witnessed.Evidence.SecondVote = record.Evidence.SecondVote, record.Evidence.FirstVote
+	if err := node.broadcastSlash(newStateChain(t), &witnessed); err != nil {
+		t.Fatal(err)
+	}
+	if calls := host.sendCalls(); calls != 1 {
+		t.Errorf("expected the record of another witness not to be sent, got %d sends", calls)
+	}
+
+	distinct := *record
+	distinct.Evidence.Height++
+	if err := node.broadcastSlash(newStateChain(t), &distinct); err != nil {
+		t.Fatal(err)
+	}
+	if calls := host.sendCalls(); calls != 2 {
+		t.Errorf("expected a distinct record to be sent, got %d sends", calls)
+	}
+}
+
+func TestSlashDedup(t *testing.T) {
+	var dedup slashDedup
+	now := time.Now()
+	a, b, c := common.HexToHash("0x0a"), common.HexToHash("0x0b"), common.HexToHash("0x0c")
+	steps := []struct {
+		key  common.Hash
+		at   time.Duration
+		want bool
+	}{
+		{a, 0, true},
+		{a, time.Second, false},
+		// the record can be sent again after the ttl
+		{a, time.Minute, true},
+		{b, time.Minute, true},
+		// a is evicted by c, as the cache holds two records
+		{c, time.Minute, true},
+		{a, time.Minute, true},
+	}
+	for i, step := range steps {
+		if got := dedup.claim(step.key, now.Add(step.at), 2, 30*time.Second); got != step.want {
+			t.Errorf("step %d: expected claim %v, got %v", i, step.want, got)
+		}
+	}
+	dedup.release(c)
+	if !dedup.claim(c, now.Add(time.Minute), 2, 30*time.Second) {
+		t.Error("expected a released record to be sent again")
+	}
+}
+
+func TestBroadcastSlashBatch(t *testing.T) {
+	errReporter := errors.New("reporter not allowed")
+	banned := common.BigToAddress(big.NewInt(9))
+	host := &recordingHost{}
+	node := &Node{
+		host:       host,
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		slashVerifier: func(_ slash.CommitteeReader, _ *state.DB, record *slash.Record) error {
+			if record.Reporter == banned {
+				return errReporter
+			}
+			return nil
+		},
+	}
+	records := make(slash.Records, 3)
+	for i := range records {
+		records[i] = *testSlashRecord()
+		records[i].Evidence.Height = uint64(10 + i)
+	}
+	invalid := *testSlashRecord()
+	invalid.Evidence.Height = 20
+	invalid.Reporter = banned
+
+	// a batch of three records with a duplicate and an invalid record
+	batch := append(slash.Records{records[0], invalid}, records...)
+	err := node.broadcastSlashBatch(newStateChain(t), batch)
+	if !errors.Is(err, errSlashInvalid) {
+		t.Errorf("expected the invalid record to be reported, got %v", err)
+	}
+	sent := host.sentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("expected the batch to be sent in one message, got %d", len(sent))
+	}
+	var got slash.Records
+	if err := rlp.DecodeBytes(sent[0].msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize+1:], &got); err != nil {
+		t.Fatalf("cannot decode slash message: %v", err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected three records in the message, got %d", len(got))
+	}
+	for i := range got {
+		if got[i].Hash() != records[i].Hash() {
+			t.Errorf("record %d: expected %s, got %s", i, records[i], got[i])
+		}
+	}
+
+	// the records are deduplicated one by one
+	fresh := *testSlashRecord()
+	fresh.Evidence.Height = 30
+	if err := node.broadcastSlashBatch(newStateChain(t), slash.Records{records[1], fresh}); err != nil {
+		t.Fatal(err)
+	}
+	sent = host.sentMessages()
+	if len(sent) != 2 {
+		t.Fatalf("expected a second message, got %d", len(sent))
+	}
+	if err := rlp.DecodeBytes(sent[1].msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize+1:], &got); err != nil {
+		t.Fatalf("cannot decode slash message: %v", err)
+	}
+	if len(got) != 1 || got[0].Hash() != fresh.Hash() {
+		t.Errorf("expected only the new record to be sent, got %v", got)
+	}
+}
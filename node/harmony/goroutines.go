@@ -0,0 +1,70 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// goroutineSpawner runs the goroutines of the node package, keeping count of the active ones.
+type goroutineSpawner struct {
+	active atomic.Int64
+}
+
+// spawn runs f in a new goroutine unless limit goroutines are already active,
+// a non positive limit disables the cap. It returns false if f was not run.
+func (s *goroutineSpawner) spawn(site string, limit int, f func()) bool {
+	if n := s.active.Add(1); limit > 0 && n > int64(limit) {
+		s.active.Add(-1)
+		nodeGoroutineRejectedCounterVec.With(prometheus.Labels{"site": site}).Inc()
+		return false
+	}
+	s.run(f)
+	return true
+}
+
+// track runs f in a new goroutine regardless of the cap, for the goroutines the node cannot do without.
+func (s *goroutineSpawner) track(f func()) {
+	s.active.Add(1)
+	s.run(f)
+}
+
+// run runs f in a new goroutine, the caller already counted it as active.
+func (s *goroutineSpawner) run(f func()) {
+	nodeGoroutinesGauge.Inc()
+	go func() {
+		defer func() {
+			s.active.Add(-1)
+			nodeGoroutinesGauge.Dec()
+		}()
+		f()
+	}()
+}
+
+// goSpawn runs f in a new goroutine within the configured cap, returns false if f was not run.
+func (node *Node) goSpawn(site string, f func()) bool {
+	return node.goroutines.spawn(site, node.NodeConfig.Handler.MaxGoroutines, f)
+}
+
+// shutdownSignal is done once the node shuts down, to stop the goroutines waiting on it.
+type shutdownSignal struct {
+	once   sync.Once
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// context returns the context cancelled on shutdown.
+func (s *shutdownSignal) context() context.Context {
+	s.once.Do(func() {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	})
+	return s.ctx
+}
+
+// trigger cancels the shutdown context.
+func (s *shutdownSignal) trigger() {
+	s.context()
+	s.cancel()
+}
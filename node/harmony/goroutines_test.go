@@ -0,0 +1,38 @@
+package node
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGoroutineSpawnerCap(t *testing.T) {
+	var spawner goroutineSpawner
+	block := make(chan struct{})
+	started := make(chan struct{}, 2)
+
+	for i := 0; i < 2; i++ {
+		if !spawner.spawn("test", 2, func() {
+			started <- struct{}{}
+			<-block
+		}) {
+			t.Fatalf("goroutine %d rejected below the cap", i)
+		}
+	}
+	<-started
+	<-started
+	if spawner.spawn("test", 2, func() {}) {
+		t.Error("expected goroutine over the cap to be rejected")
+	}
+
+	done := make(chan struct{})
+	spawner.track(func() { close(done) })
+	<-done
+
+	close(block)
+	for spawner.active.Load() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if !spawner.spawn("test", 2, func() {}) {
+		t.Error("expected goroutine to be spawned once others finished")
+	}
+}
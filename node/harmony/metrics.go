@@ -1,10 +1,12 @@
 package node
 
 import (
+	"strings"
 	"sync"
 
 	prom "github.com/harmony-one/harmony/api/service/prometheus"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var (
@@ -70,6 +72,89 @@ var (
 		},
 	)
 
+	// nodeMessageDispatchCounterVec is used to keep track of the node messages dispatched by type
+	nodeMessageDispatchCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "message_dispatch",
+			Help:      "number of node messages dispatched by action type and block message type",
+		},
+		[]string{
+			"action",
+			"block_type",
+		},
+	)
+
+	// nodeUnknownBlockMessageCounterVec is used to keep track of the block messages of unknown type received
+	nodeUnknownBlockMessageCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "message_unknown_block_type",
+			Help:      "number of block messages received with a block message type not defined by the protocol",
+		},
+		[]string{
+			"block_type",
+		},
+	)
+
+	// nodeMessagePayloadSizeHistogramVec is used to keep track of the payload sizes of the node messages
+	nodeMessagePayloadSizeHistogramVec = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "message_payload_bytes",
+			Help:      "payload size of the node messages dispatched by action type",
+			Buckets:   prometheus.ExponentialBuckets(64, 4, 10),
+		},
+		[]string{
+			"action",
+		},
+	)
+
+	// nodeTxIntakeCounterVec is used to keep track of transactions offered to the pool by source
+	nodeTxIntakeCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "tx_intake",
+			Help:      "number of transactions offered to the pool by source and result",
+		},
+		[]string{
+			"source",
+			"result",
+		},
+	)
+
+	// nodeCrossLinkBroadcastCounterVec is used to keep track of the outcomes of crosslink broadcasts to the beacon chain
+	nodeCrossLinkBroadcastCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "crosslink_broadcast",
+			Help:      "number of crosslink broadcasts to the beacon chain by shard and outcome",
+		},
+		[]string{
+			"shard",
+			"outcome",
+		},
+	)
+
+	// nodeCrossLinkBroadcastHeadersHistogramVec is used to keep track of the number of headers per crosslink broadcast
+	nodeCrossLinkBroadcastHeadersHistogramVec = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "crosslink_broadcast_headers",
+			Help:      "number of headers per crosslink broadcast to the beacon chain",
+			Buckets:   prometheus.LinearBuckets(1, 1, 10),
+		},
+		[]string{
+			"shard",
+		},
+	)
+
 	// CrossLinkPendingQueueGauge is used to monitor the current size of pending crosslink queue
 	CrossLinkPendingQueueGauge = prometheus.NewGauge(
 		prometheus.GaugeOpts{
@@ -80,6 +165,72 @@ var (
 		},
 	)
 
+	// nodeBeaconBlockQueueGauge is used to monitor the number of beacon blocks from block sync queued for the epoch chain
+	nodeBeaconBlockQueueGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "beacon_block_queue_size",
+			Help:      "current number of beacon blocks from block sync queued for the epoch chain",
+		},
+	)
+
+	// nodeBlockSyncReceivedCounter is used to keep track of the blocks received by block sync messages
+	nodeBlockSyncReceivedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "block_sync_received",
+			Help:      "number of blocks received by block sync messages",
+		},
+	)
+
+	// nodeBlockSyncBeaconQueuedCounter is used to keep track of the beacon blocks from block sync queued for the epoch chain
+	nodeBlockSyncBeaconQueuedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "block_sync_beacon_queued",
+			Help:      "number of beacon blocks from block sync messages queued for the epoch chain",
+		},
+	)
+
+	// nodeSlashBroadcastCounterVec is used to keep track of the outcomes of slash record broadcasts to the beacon chain
+	nodeSlashBroadcastCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "slash_broadcast",
+			Help:      "number of slash record broadcasts to the beacon chain by outcome",
+		},
+		[]string{
+			"outcome",
+		},
+	)
+
+	// nodeGoroutinesGauge is used to monitor the goroutines spawned by the node package
+	nodeGoroutinesGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "goroutines",
+			Help:      "current number of goroutines spawned by the node package",
+		},
+	)
+
+	// nodeGoroutineRejectedCounterVec is used to count the goroutines not spawned over the cap
+	nodeGoroutineRejectedCounterVec = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hmy",
+			Subsystem: "node",
+			Name:      "goroutines_rejected",
+			Help:      "number of goroutines not spawned as the cap was reached",
+		},
+		[]string{
+			"site",
+		},
+	)
+
 	onceMetrics sync.Once
 )
 
@@ -91,7 +242,84 @@ func initMetrics() {
 			nodeConsensusMessageCounterVec,
 			nodeNodeMessageCounterVec,
 			nodeCrossLinkMessageCounterVec,
+			nodeTxIntakeCounterVec,
+			nodeMessageDispatchCounterVec,
+			nodeUnknownBlockMessageCounterVec,
+			nodeMessagePayloadSizeHistogramVec,
+			nodeCrossLinkBroadcastCounterVec,
+			nodeCrossLinkBroadcastHeadersHistogramVec,
 			CrossLinkPendingQueueGauge,
+			nodeBeaconBlockQueueGauge,
+			nodeBlockSyncReceivedCounter,
+			nodeBlockSyncBeaconQueuedCounter,
+			nodeSlashBroadcastCounterVec,
+			nodeGoroutinesGauge,
+			nodeGoroutineRejectedCounterVec,
 		)
 	})
 }
+
+// snapshotMetrics are the message handling and broadcasting metrics reported by MetricsSnapshot.
+var snapshotMetrics = []struct {
+	name      string
+	collector prometheus.Collector
+}{
+	{"hmy_p2p_message", nodeP2PMessageCounterVec},
+	{"hmy_p2p_consensus_msg", nodeConsensusMessageCounterVec},
+	{"hmy_p2p_node_msg", nodeNodeMessageCounterVec},
+	{"hmy_p2p_crosslink_msg", nodeCrossLinkMessageCounterVec},
+	{"hmy_node_tx_intake", nodeTxIntakeCounterVec},
+	{"hmy_node_message_dispatch", nodeMessageDispatchCounterVec},
+	{"hmy_node_message_unknown_block_type", nodeUnknownBlockMessageCounterVec},
+	{"hmy_node_crosslink_broadcast", nodeCrossLinkBroadcastCounterVec},
+	{"hmy_p2p_crosslink_pending_queue_size", CrossLinkPendingQueueGauge},
+	{"hmy_node_beacon_block_queue_size", nodeBeaconBlockQueueGauge},
+	{"hmy_node_block_sync_received", nodeBlockSyncReceivedCounter},
+	{"hmy_node_block_sync_beacon_queued", nodeBlockSyncBeaconQueuedCounter},
+	{"hmy_node_slash_broadcast", nodeSlashBroadcastCounterVec},
+	{"hmy_node_goroutines", nodeGoroutinesGauge},
+	{"hmy_node_goroutines_rejected", nodeGoroutineRejectedCounterVec},
+}
+
+// MetricsSnapshot returns the current values of the message handling and broadcasting
+// metrics, keyed in the OpenMetrics form name{label="value",...}. It does not depend
+// on the metrics being registered to the prometheus registry.
+func (node *Node) MetricsSnapshot() map[string]float64 {
+	snapshot := make(map[string]float64)
+	var sb strings.Builder
+	for _, m := range snapshotMetrics {
+		ch := make(chan prometheus.Metric, 16)
+		go func(c prometheus.Collector) {
+			c.Collect(ch)
+			close(ch)
+		}(m.collector)
+		for metric := range ch {
+			var pb dto.Metric
+			if err := metric.Write(&pb); err != nil {
+				continue
+			}
+			sb.Reset()
+			sb.WriteString(m.name)
+			if labels := pb.GetLabel(); len(labels) > 0 {
+				sb.WriteByte('{')
+				for i, l := range labels {
+					if i > 0 {
+						sb.WriteByte(',')
+					}
+					sb.WriteString(l.GetName())
+					sb.WriteString(`="`)
+					sb.WriteString(l.GetValue())
+					sb.WriteByte('"')
+				}
+				sb.WriteByte('}')
+			}
+			switch {
+			case pb.Counter != nil:
+				snapshot[sb.String()] = pb.GetCounter().GetValue()
+			case pb.Gauge != nil:
+				snapshot[sb.String()] = pb.GetGauge().GetValue()
+			}
+		}
+	}
+	return snapshot
+}
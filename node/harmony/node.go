@@ -8,10 +8,10 @@ import (
 	"os"
 	"runtime/pprof"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/harmony-one/abool"
 	"github.com/harmony-one/harmony/api/proto"
 	msg_pb "github.com/harmony-one/harmony/api/proto/message"
@@ -19,6 +19,7 @@ import (
 	"github.com/harmony-one/harmony/api/service"
 	"github.com/harmony-one/harmony/api/service/synchronize/legacysync"
 	"github.com/harmony-one/harmony/api/service/synchronize/legacysync/downloader"
+	"github.com/harmony-one/harmony/common/clock"
 	"github.com/harmony-one/harmony/consensus"
 	"github.com/harmony-one/harmony/core"
 	"github.com/harmony-one/harmony/core/types"
@@ -45,6 +46,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rcrowley/go-metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/semaphore"
 	protobuf "google.golang.org/protobuf/proto"
 )
@@ -91,6 +94,70 @@ type Node struct {
 	BeaconBlockChannel chan *types.Block    // The channel to send beacon blocks for non-beaconchain nodes
 
 	crosslinks *crosslinks.Crosslinks // Memory storage for crosslink processing.
+	// Serializes the crosslink broadcasts, which select from and advance the sent crosslinks.
+	crossLinkBroadcastMu sync.Mutex
+	// Set while a crosslink broadcast of the beacon sync hook runs.
+	beaconSyncBroadcasting atomic.Bool
+	// Cross shard receipts waiting for their source block to be known.
+	bufferedReceipts receiptBuffer
+	// Round-robin position of the next shard a crosslink heartbeat is sent to.
+	heartbeatShardCursor uint32
+	// Last consensus readiness reported, for the peer count hysteresis.
+	consensusReady abool.AtomicBool
+	// Progress of catching up with a crosslink backlog over several broadcasts.
+	crosslinkCatchup crosslinkCatchup
+	// Per peer rate limit of the crosslinks received by the beacon chain.
+	crossLinkPeerLimiter crossLinkRateLimiter[libp2p_peer.ID]
+	// Per shard rate limit of the verified crosslinks received by the beacon chain.
+	crossLinkShardLimiter crossLinkRateLimiter[uint32]
+	// Broadcast groups seen without peers.
+	groupMonitor groupDeliveryMonitor
+	// Chain info reported by peers.
+	peerChainInfo peerChainInfoStore
+	// Handlers of the node messages.
+	messageHandlers nodeMessageHandlers
+	// tracer traces the handling of node messages, nil if tracing is disabled
+	tracer trace.Tracer
+	// sampler picks the broadcast rounds the node takes part in while not leader
+	sampler broadcastSampler
+	// role overrides the role of the node in the broadcasts, nil uses the node's own
+	role broadcastRole
+	// slashVerifier verifies the slash records before they are broadcast, nil uses slash.Verify
+	slashVerifier slashVerifier
+	// slashesSent are the slash records recently broadcast
+	slashesSent slashDedup
+	// clock measures the node timers, nil uses the system clock
+	clock clock.Clock
+	// epochSequence computes the epoch of the epoch block expected next, nil uses the epoch chain head
+	epochSequence epochSequence
+	// txLookup finds the transactions the node has by hash, nil uses the pool
+	txLookup txLookup
+	// receiptPool takes the pending cross shard receipts, nil uses the consensus
+	receiptPool receiptPool
+	// requestedTxs are the hashes of the announced transactions recently requested
+	requestedTxs seenTxCache
+	// Limit of the block sync messages decoded concurrently.
+	syncDecodes concurrencyLimiter
+	// Limits of the node messages handled concurrently, by message class.
+	messageHandling [numMessageClasses]concurrencyLimiter
+	// Goroutines spawned for message handling and broadcasts.
+	goroutines goroutineSpawner
+	// Done once the node shuts down.
+	shutdown shutdownSignal
+	// Recipients of the last crosslink broadcast.
+	lastCrosslinkRecipients crosslinkRecipients
+	// Peers whose crosslinks are dropped for sending invalid ones.
+	crossLinkQuarantine crossLinkQuarantine
+	// Last crosslink replay requested for each shard.
+	crossLinkReplays crossLinkReplayRequests
+	// Groups not sent to after repeated send failures.
+	broadcastBreaker broadcastBreaker
+	// Per peer rate limit of the transaction messages received.
+	txGossipLimiter txGossipRateLimiter
+	// Per peer rate limit of the transaction announces and requests received.
+	txRequestLimiter txGossipRateLimiter
+	// Hashes of the transactions recently received through gossip.
+	seenTxs seenTxCache
 
 	SelfPeer         p2p.Peer
 	stateMutex       sync.Mutex // mutex for change node state
@@ -154,6 +221,15 @@ func (node *Node) GetOrCreateSyncInstance(initiate bool) ISync {
 	return node.stateSync
 }
 
+// getClock returns the clock of the node timers, the system clock unless another clock is
+// set, so that the timers can be driven by tests.
+func (node *Node) getClock() clock.Clock {
+	if node.clock != nil {
+		return node.clock
+	}
+	return clock.SystemClock
+}
+
 // Beaconchain returns the beacon chain from node.
 func (node *Node) Beaconchain() core.BlockChain {
 	// tikv mode not have the BeaconChain storage
@@ -191,15 +267,29 @@ func (node *Node) EpochChain() core.BlockChain {
 	})
 }
 
+// sendsMessageVersion2 returns whether the node sends the node messages of version 2, which
+// the nodes of older releases reject, from the MessageVersion2Epoch of the chain config.
+func (node *Node) sendsMessageVersion2() bool {
+	bc := node.Blockchain()
+	return bc.Config().IsMessageVersion2(bc.CurrentHeader().Epoch())
+}
+
 // TODO: make this batch more transactions
 func (node *Node) tryBroadcast(tx *types.Transaction) {
-	msg := proto_node.ConstructTransactionListMessageAccount(types.Transactions{tx})
+	msg := proto_node.ConstructTransactionListMessageCompressed(
+		types.Transactions{tx}, node.txGossipCompressThreshold(),
+	)
+	if node.NodeConfig.Handler.TxAnnounce && node.sendsMessageVersion2() {
+		// the peers missing the transaction request it from this node
+		msg = proto_node.ConstructEnvelope(proto_node.MessageVersion2,
+			proto_node.ConstructTransactionAnnounceMessage([]common.Hash{tx.Hash()}))
+	}
 
 	shardGroupID := nodeconfig.NewGroupIDByShardID(nodeconfig.ShardID(tx.ShardID()))
 	utils.Logger().Info().Str("shardGroupID", string(shardGroupID)).Msg("tryBroadcast")
 
 	for attempt := 0; attempt < NumTryBroadCast; attempt++ {
-		err := node.host.SendMessageToGroups([]nodeconfig.GroupID{shardGroupID}, p2p.ConstructMessage(msg))
+		err := node.sendToGroups([]nodeconfig.GroupID{shardGroupID}, p2p.ConstructMessage(msg))
 		if err != nil {
 			utils.Logger().Error().Int("attempt", attempt).Msg("Error when trying to broadcast tx")
 		} else {
@@ -217,7 +307,7 @@ func (node *Node) tryBroadcastStaking(stakingTx *staking.StakingTransaction) {
 	utils.Logger().Info().Str("shardGroupID", string(shardGroupID)).Msg("tryBroadcastStaking")
 
 	for attempt := 0; attempt < NumTryBroadCast; attempt++ {
-		if err := node.host.SendMessageToGroups([]nodeconfig.GroupID{shardGroupID},
+		if err := node.sendToGroups([]nodeconfig.GroupID{shardGroupID},
 			p2p.ConstructMessage(msg)); err != nil {
 			utils.Logger().Error().Int("attempt", attempt).Msg("Error when trying to broadcast staking tx")
 		} else {
@@ -226,8 +316,32 @@ func (node *Node) tryBroadcastStaking(stakingTx *staking.StakingTransaction) {
 	}
 }
 
-// Add new transactions to the pending transaction list.
-func addPendingTransactions(registry *registry.Registry, newTxs types.Transactions) []error {
+// txSource is where a transaction offered to the pool came from.
+type txSource string
+
+const (
+	txSourceGossip txSource = "gossip"
+	txSourceRPC    txSource = "rpc"
+)
+
+// recordTxIntake counts the transactions offered to the pool from source,
+// poolErrs being the result of adding the ones which passed the node checks.
+func recordTxIntake(source txSource, offered int, poolErrs []error) {
+	accepted := 0
+	for _, err := range poolErrs {
+		if err == nil {
+			accepted++
+		}
+	}
+	nodeTxIntakeCounterVec.With(prometheus.Labels{"source": string(source), "result": "accepted"}).Add(float64(accepted))
+	nodeTxIntakeCounterVec.With(prometheus.Labels{"source": string(source), "result": "rejected"}).Add(float64(offered - accepted))
+}
+
+// Add new transactions to the pending transaction list, unless ctx is done.
+func addPendingTransactions(ctx context.Context, registry *registry.Registry, newTxs types.Transactions, source txSource) []error {
+	if err := ctx.Err(); err != nil {
+		return []error{err}
+	}
 	var (
 		errs          []error
 		bc            = registry.GetBlockchain()
@@ -263,7 +377,9 @@ func addPendingTransactions(registry *registry.Registry, newTxs types.Transactio
 		}
 		poolTxs = append(poolTxs, tx)
 	}
-	errs = append(errs, registry.GetTxPool().AddRemotes(poolTxs)...)
+	poolErrs := txPool.AddRemotes(poolTxs)
+	recordTxIntake(source, len(newTxs), poolErrs)
+	errs = append(errs, poolErrs...)
 	pendingCount, queueCount := txPool.Stats()
 	utils.Logger().Debug().
 		Interface("err", errs).
@@ -274,8 +390,86 @@ func addPendingTransactions(registry *registry.Registry, newTxs types.Transactio
 	return errs
 }
 
-// Add new staking transactions to the pending staking transaction list.
-func (node *Node) addPendingStakingTransactions(newStakingTxs staking.StakingTransactions) []error {
+// defaultTxRequeueBackoff is the default delay before the first retry of a transaction batch.
+const defaultTxRequeueBackoff = time.Second
+
+// isTransientPoolError returns true if errs contain a rejection by the pool which may not
+// happen again later, such as being underpriced by a full pool or exceeding the queue caps.
+func isTransientPoolError(errs []error) bool {
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		switch errors.Cause(err) {
+		case core.ErrTxPoolFull, core.ErrQueueCapExceeded:
+			return true
+		}
+	}
+	return false
+}
+
+// txRequeueDelay returns the delay before retry attempt of a transaction batch.
+func txRequeueDelay(backoff time.Duration, attempt int) time.Duration {
+	if backoff <= 0 {
+		backoff = defaultTxRequeueBackoff
+	}
+	return backoff << attempt
+}
+
+// addGossipedTransactions adds the gossiped transactions to the pending transaction list,
+// offering the batch again with backoff while the pool rejects it for a transient reason.
+// ctx bounds the first attempt only, the retries wait within the goroutine cap and stop once
+// the node shuts down. A batch finally rejected for a transient reason, not retried for lack
+// of goroutines or not offered to the pool at all is forgotten by the seen transaction
+// cache, so that the pool can take it when gossiped again.
+func (node *Node) addGossipedTransactions(ctx context.Context, txs types.Transactions, attempt int) {
+	_, span := node.startSpan(ctx, "node.pool_insert",
+		attribute.Int("txs", len(txs)),
+		attribute.Int("attempt", attempt),
+	)
+	errs := addPendingTransactions(ctx, node.registry, txs, txSourceGossip)
+	span.End()
+	if !isTransientPoolError(errs) {
+		if ctx.Err() != nil {
+			node.seenTxs.forget(txs)
+		}
+		return
+	}
+	retries := node.NodeConfig.Handler.TxRequeueRetries
+	if retries <= 0 {
+		node.seenTxs.forget(txs)
+		return
+	}
+	if attempt >= retries {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_requeue_dropped"}).Inc()
+		utils.Logger().Debug().
+			Int("txs", len(txs)).
+			Int("attempts", attempt).
+			Msg("[addGossipedTransactions] dropping transaction batch after retries")
+		node.seenTxs.forget(txs)
+		return
+	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_requeue"}).Inc()
+	delay, shutdown := txRequeueDelay(node.NodeConfig.Handler.TxRequeueBackoff, attempt), node.shutdown.context()
+	spawned := node.goSpawn("tx_requeue", func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			node.addGossipedTransactions(shutdown, txs, attempt+1)
+		case <-shutdown.Done():
+		}
+	})
+	if !spawned {
+		node.seenTxs.forget(txs)
+	}
+}
+
+// Add new staking transactions to the pending staking transaction list, unless ctx is done.
+func (node *Node) addPendingStakingTransactions(ctx context.Context, newStakingTxs staking.StakingTransactions, source txSource) []error {
+	if err := ctx.Err(); err != nil {
+		return []error{err}
+	}
 	if node.IsRunningBeaconChain() {
 		if node.Blockchain().Config().IsPreStaking(node.Blockchain().CurrentHeader().Epoch()) {
 			poolTxs := types.PoolTransactions{}
@@ -283,6 +477,7 @@ func (node *Node) addPendingStakingTransactions(newStakingTxs staking.StakingTra
 				poolTxs = append(poolTxs, tx)
 			}
 			errs := node.TxPool.AddRemotes(poolTxs)
+			recordTxIntake(source, len(newStakingTxs), errs)
 			pendingCount, queueCount := node.TxPool.Stats()
 			utils.Logger().Info().
 				Int("length of newStakingTxs", len(poolTxs)).
@@ -291,10 +486,12 @@ func (node *Node) addPendingStakingTransactions(newStakingTxs staking.StakingTra
 				Msg("Got more staking transactions")
 			return errs
 		}
+		recordTxIntake(source, len(newStakingTxs), nil)
 		return []error{
 			errors.WithMessage(errInvalidEpoch, "staking txs not accepted yet"),
 		}
 	}
+	recordTxIntake(source, len(newStakingTxs), nil)
 	return []error{
 		errors.WithMessage(errInvalidShard, fmt.Sprintf("txs only valid on shard %v", shard.BeaconChainShardID)),
 	}
@@ -305,7 +502,7 @@ func (node *Node) AddPendingStakingTransaction(
 	newStakingTx *staking.StakingTransaction,
 ) error {
 	if node.IsRunningBeaconChain() {
-		errs := node.addPendingStakingTransactions(staking.StakingTransactions{newStakingTx})
+		errs := node.addPendingStakingTransactions(context.Background(), staking.StakingTransactions{newStakingTx}, txSourceRPC)
 		var err error
 		for i := range errs {
 			if errs[i] != nil {
@@ -331,7 +528,7 @@ func (node *Node) AddPendingStakingTransaction(
 // This is only called from SDK.
 func (node *Node) AddPendingTransaction(newTx *types.Transaction) error {
 	if newTx.ShardID() == node.NodeConfig.ShardID {
-		errs := addPendingTransactions(node.registry, types.Transactions{newTx})
+		errs := addPendingTransactions(context.Background(), node.registry, types.Transactions{newTx}, txSourceRPC)
 		var err error
 		for i := range errs {
 			if errs[i] != nil {
@@ -349,8 +546,19 @@ func (node *Node) AddPendingTransaction(newTx *types.Transaction) error {
 	return errors.Errorf("shard do not match, txShard: %d, nodeShard: %d", newTx.ShardID(), node.NodeConfig.ShardID)
 }
 
+// SetBlockBroadcastHooks sets the hooks run for each new block the node broadcasts, as
+// for an embedded explorer ingesting the blocks. A slow hook doesn't hold consensus back,
+// see consensus.SetBlockBroadcastHooks.
+func (node *Node) SetBlockBroadcastHooks(hooks ...consensus.BlockBroadcastHook) {
+	node.Consensus.SetBlockBroadcastHooks(hooks...)
+}
+
 // AddPendingReceipts adds one receipt message to pending list.
 func (node *Node) AddPendingReceipts(receipts *types.CXReceiptsProof) {
+	if node.receiptPool != nil {
+		node.receiptPool.AddPendingReceipts(receipts)
+		return
+	}
 	node.Consensus.AddPendingReceipts(receipts)
 }
 
@@ -367,12 +575,41 @@ var (
 	errWrongShardID      = errors.New("wrong shard id")
 	errInvalidNodeMsg    = errors.New("invalid node message")
 	errIgnoreBeaconMsg   = errors.New("ignore beacon sync block")
+	errUnknownMsgVersion = errors.New("unknown node message version")
+	errSyncDecodeBusy    = errors.New("too many block sync messages being decoded")
 	errInvalidEpoch      = errors.New("invalid epoch for transaction")
 	errInvalidShard      = errors.New("invalid shard")
 )
 
 const beaconBlockHeightTolerance = 2
 
+var errBeaconBlockTooOld = errors.New("beacon block height smaller than current height beyond tolerance")
+
+// checkSyncBlocksHeight checks the height of the blocks of a blocks sync message against the
+// current beacon height. A message is judged by its newest block, so that the older blocks
+// of coalesced new blocks don't get it rejected: it is rejected if its newest block is older
+// than the current height beyond tolerance, and ignored if it is not newer than it.
+func checkSyncBlocksHeight(blocks []*types.Block, curBeaconHeight uint64) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	newest := blocks[0].NumberU64()
+	for _, block := range blocks[1:] {
+		newest = max(newest, block.NumberU64())
+	}
+	// Ban blocks number that is smaller than tolerance
+	if newest+beaconBlockHeightTolerance <= curBeaconHeight {
+		utils.Logger().Debug().Uint64("receivedNum", newest).
+			Uint64("currentNum", curBeaconHeight).Msg("beacon block sync message rejected")
+		return errBeaconBlockTooOld
+	} else if newest <= curBeaconHeight {
+		utils.Logger().Debug().Uint64("receivedNum", newest).
+			Uint64("currentNum", curBeaconHeight).Msg("beacon block sync message ignored")
+		return errIgnoreBeaconMsg
+	}
+	return nil
+}
+
 // validateNodeMessage validate node message
 func (node *Node) validateNodeMessage(ctx context.Context, payload []byte) (
 	[]byte, proto_node.MessageType, error) {
@@ -385,6 +622,21 @@ func (node *Node) validateNodeMessage(ctx context.Context, payload []byte) (
 		return nil, 0, core.ErrOversizedData
 	}
 
+	// unwrap the message version envelope, messages without one are version 1
+	version, payload, err := proto_node.OpenEnvelope(payload)
+	if err != nil {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "invalid_envelope"}).Inc()
+		return nil, 0, errors.Wrap(err, "envelope decode error")
+	}
+	if version == 0 || version > proto_node.LatestMessageVersion {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "unknown_version"}).Inc()
+		return nil, 0, errUnknownMsgVersion
+	}
+	if len(payload) <= p2pNodeMsgPrefixSize {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "invalid_size"}).Inc()
+		return nil, 0, errInvalidNodeMsg
+	}
+
 	// just ignore payload[0], which is MsgCategoryType (consensus/node)
 	msgType := proto_node.MessageType(payload[proto.MessageCategoryBytes])
 
@@ -397,7 +649,7 @@ func (node *Node) validateNodeMessage(ctx context.Context, payload []byte) (
 		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "staking_tx"}).Inc()
 	case proto_node.Block:
 		switch proto_node.BlockMessageType(payload[p2pNodeMsgPrefixSize]) {
-		case proto_node.Sync:
+		case proto_node.Sync, proto_node.SyncCompressed:
 			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "block_sync"}).Inc()
 
 			// in tikv mode, not need BeaconChain message
@@ -406,24 +658,23 @@ func (node *Node) validateNodeMessage(ctx context.Context, payload []byte) (
 			}
 
 			// checks whether the beacon block is larger than current block number
-			blocksPayload := payload[p2pNodeMsgPrefixSize+1:]
-			var blocks []*types.Block
-			if err := rlp.DecodeBytes(blocksPayload, &blocks); err != nil {
+			release, ok := node.acquireSyncDecode(ctx)
+			if !ok {
+				return nil, 0, errSyncDecodeBusy
+			}
+			blocks, err := decodeBlocksSync(
+				ctx, proto_node.BlockMessageType(payload[p2pNodeMsgPrefixSize]), payload[p2pNodeMsgPrefixSize+1:],
+				node.maxSyncBlocksPerMessage(), node.maxSyncBlocksBytes(),
+			)
+			release()
+			if isOversizedRLPList(err) {
+				nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "block_sync_oversized"}).Inc()
+			}
+			if err != nil {
 				return nil, 0, errors.Wrap(err, "block decode error")
 			}
-			curBeaconBlock := node.EpochChain().CurrentBlock()
-			curBeaconHeight := curBeaconBlock.NumberU64()
-			for _, block := range blocks {
-				// Ban blocks number that is smaller than tolerance
-				if block.NumberU64()+beaconBlockHeightTolerance <= curBeaconHeight {
-					utils.Logger().Debug().Uint64("receivedNum", block.NumberU64()).
-						Uint64("currentNum", curBeaconHeight).Msg("beacon block sync message rejected")
-					return nil, 0, errors.New("beacon block height smaller than current height beyond tolerance")
-				} else if block.NumberU64() <= curBeaconHeight {
-					utils.Logger().Debug().Uint64("receivedNum", block.NumberU64()).
-						Uint64("currentNum", curBeaconHeight).Msg("beacon block sync message ignored")
-					return nil, 0, errIgnoreBeaconMsg
-				}
+			if err := checkSyncBlocksHeight(blocks, node.EpochChain().CurrentBlock().NumberU64()); err != nil {
+				return nil, 0, err
 			}
 
 			// only non-beacon nodes process the beacon block sync messages
@@ -460,10 +711,27 @@ func (node *Node) validateNodeMessage(ctx context.Context, payload []byte) (
 			if node.IsRunningBeaconChain() {
 				return nil, 0, errInvalidShard
 			}
+		case proto_node.CrossLinkReplay:
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "crosslink_replay"}).Inc()
+			// only shard chains replay the crosslinks they sent
+			if node.IsRunningBeaconChain() {
+				return nil, 0, errIgnoreBeaconMsg
+			}
+		case proto_node.CrosslinkAck:
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "crosslink_ack"}).Inc()
+			// only non beacon chain processes crosslink acknowledgements, when enabled
+			if node.IsRunningBeaconChain() {
+				return nil, 0, errInvalidShard
+			}
+			if !node.NodeConfig.Handler.CrossLinkAcks {
+				return nil, 0, errIgnoreBeaconMsg
+			}
 		default:
 			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "invalid_block_type"}).Inc()
 			return nil, 0, errInvalidNodeMsg
 		}
+	case proto_node.ChainInfo:
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "chain_info"}).Inc()
 	default:
 		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "invalid_node_type"}).Inc()
 		return nil, 0, errInvalidNodeMsg
@@ -622,6 +890,8 @@ var (
 // StartPubSub kicks off the node message handling
 func (node *Node) StartPubSub() error {
 	node.psCtx, node.psCancel = context.WithCancel(context.Background())
+	node.host.SetDirectMessageHandler(node.handleDirectMessage, types.MaxP2PNodeDataSize)
+	node.releaseReceiptsOnChainHead()
 
 	// groupID and whether this topic is used for consensus
 	type t struct {
@@ -681,6 +951,7 @@ func (node *Node) StartPubSub() error {
 	// other p2p message handler function
 	type p2pHandlerElse func(
 		ctx context.Context,
+		peer libp2p_peer.ID,
 		rlpPayload []byte,
 		actionType proto_node.MessageType,
 	) error
@@ -688,6 +959,7 @@ func (node *Node) StartPubSub() error {
 	// interface pass to p2p message validator
 	type validated struct {
 		peerID         libp2p_peer.ID
+		relayID        libp2p_peer.ID
 		consensusBound bool
 		handleC        p2pHandlerConsensus
 		handleCArg     *msg_pb.Message
@@ -779,10 +1051,12 @@ func (node *Node) StartPubSub() error {
 					)
 					if err != nil {
 						switch err {
-						case errIgnoreBeaconMsg:
+						case errIgnoreBeaconMsg, errUnknownMsgVersion:
 							// ignore the further processing of the ignored messages as it is not intended for this node
 							// but propogate the messages to other nodes
 							return libp2p_pubsub.ValidationAccept
+						case errSyncDecodeBusy:
+							return libp2p_pubsub.ValidationIgnore
 						default:
 							// TODO (lc): block peers sending error messages
 							errChan <- withError{err, msg.GetFrom()}
@@ -790,7 +1064,8 @@ func (node *Node) StartPubSub() error {
 						}
 					}
 					msg.ValidatorData = validated{
-						peerID:         peer,
+						peerID:         msg.GetFrom(),
+						relayID:        msg.ReceivedFrom,
 						consensusBound: false,
 						handleE:        node.HandleNodeMessage,
 						handleEArg:     validMsg,
@@ -865,7 +1140,7 @@ func (node *Node) StartPubSub() error {
 			}
 		}()
 
-		semNode := semaphore.NewWeighted(p2p.SetAsideOtherwise)
+		workers := newNodeMessageWorkers(reservedPriorityWorkers, p2p.SetAsideOtherwise-reservedPriorityWorkers)
 		msgChanNode := make(chan validated, MsgChanBuffer)
 
 		// goroutine to handle node messages
@@ -877,10 +1152,10 @@ func (node *Node) StartPubSub() error {
 					msg := m
 					go func() {
 						defer cancel()
-						if semNode.TryAcquire(1) {
-							defer semNode.Release(1)
+						if release, ok := workers.tryAcquire(msg.actionType); ok {
+							defer release()
 
-							if err := msg.handleE(ctx, msg.handleEArg, msg.actionType); err != nil {
+							if err := msg.handleE(withRelayPeer(ctx, msg.relayID), msg.peerID, msg.handleEArg, msg.actionType); err != nil {
 								errChan <- withError{err, nil}
 							}
 						}
@@ -914,7 +1189,8 @@ func (node *Node) StartPubSub() error {
 					continue
 				}
 
-				if nextMsg.GetFrom() == ownID {
+				// node messages from ourselves are left to HandleNodeMessage
+				if nextMsg.GetFrom() == ownID && isConsensusBound {
 					continue
 				}
 
@@ -1024,7 +1300,7 @@ func New(
 			}
 		}
 
-		node.BeaconBlockChannel = make(chan *types.Block)
+		node.BeaconBlockChannel = make(chan *types.Block, beaconBlockQueueSize)
 		txPoolConfig := core.DefaultTxPoolConfig
 
 		if harmonyconfig != nil {
@@ -1066,6 +1342,8 @@ func New(
 		// the sequence number is the next block number to be added in consensus protocol, which is
 		// always one more than current chain header block
 		node.Consensus.SetBlockNum(blockchain.CurrentBlock().NumberU64() + 1)
+		// a new leader sends the pending crosslinks without waiting for the next broadcast
+		node.Consensus.SetLeaderTransitionHook(node.TriggerCrossLinkBroadcast)
 	}
 
 	h := node.Blockchain().GetHeaderByNumber(0)
@@ -1090,11 +1368,18 @@ func New(
 				if hooks := node.NodeConfig.WebHooks.Hooks; hooks != nil {
 					if s := hooks.Slashing; s != nil {
 						url := s.OnNoticeDoubleSign
-						go func() { webhooks.DoPost(url, &doubleSign) }()
+						node.goSpawn("slash_webhook", func() { webhooks.DoPost(url, &doubleSign) })
 					}
 				}
 				if !node.IsRunningBeaconChain() {
-					go node.BroadcastSlash(&doubleSign)
+					// slashes are never dropped at the goroutine cap
+					node.goroutines.track(func() {
+						if err := node.BroadcastSlash(&doubleSign); err != nil {
+							utils.Logger().Err(err).
+								RawJSON("record", []byte(doubleSign.String())).
+								Msg("could not broadcast slash record to beaconchain")
+						}
+					})
 				} else {
 					records := slash.Records{doubleSign}
 					if err := node.Blockchain().AddPendingSlashingCandidates(
@@ -1113,6 +1398,9 @@ func New(
 		node.updateInitialRewardValues()
 	}
 
+	node.messageHandlers.init(&node)
+	node.tracer = newMessageTracer(node.NodeConfig.Handler)
+
 	// init metrics
 	initMetrics()
 	nodeStringCounterVec.WithLabelValues("version", nodeconfig.GetVersion()).Inc()
@@ -1200,6 +1488,8 @@ func (node *Node) ServiceManager() *service.Manager {
 
 // ShutDown gracefully shut down the node server and dump the in-memory blockchain state into DB.
 func (node *Node) ShutDown() {
+	node.shutdown.trigger()
+
 	if err := node.StopRPC(); err != nil {
 		utils.Logger().Error().Err(err).Msg("failed to stop RPC")
 	}
@@ -0,0 +1,120 @@
+package node
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/utils"
+	"github.com/harmony-one/harmony/internal/utils/lrucache"
+	"github.com/harmony-one/harmony/p2p"
+	sttypes "github.com/harmony-one/harmony/p2p/stream/types"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxPeerChainInfo is the number of peers whose reported chain info is kept.
+const maxPeerChainInfo = 512
+
+// peerChainInfoStore keeps the chain info most recently reported by each peer, and the
+// block at which each peer was last answered.
+type peerChainInfoStore struct {
+	once    sync.Once
+	cache   *lrucache.Cache[libp2p_peer.ID, proto_node.ChainInfo]
+	replies *lrucache.Cache[libp2p_peer.ID, uint64]
+}
+
+func (s *peerChainInfoStore) init() {
+	s.once.Do(func() {
+		s.cache = lrucache.NewCache[libp2p_peer.ID, proto_node.ChainInfo](maxPeerChainInfo)
+		s.replies = lrucache.NewCache[libp2p_peer.ID, uint64](maxPeerChainInfo)
+	})
+}
+
+func (s *peerChainInfoStore) infos() *lrucache.Cache[libp2p_peer.ID, proto_node.ChainInfo] {
+	s.init()
+	return s.cache
+}
+
+// set stores the chain info reported by peer.
+func (s *peerChainInfoStore) set(peer libp2p_peer.ID, info proto_node.ChainInfo) {
+	s.infos().Set(peer, info)
+}
+
+// shouldReply returns true if a chain info request of peer is to be answered at block
+// blockNum. Each peer is answered at most once per block.
+func (s *peerChainInfoStore) shouldReply(peer libp2p_peer.ID, blockNum uint64) bool {
+	s.init()
+	if last, ok := s.replies.Get(peer); ok && blockNum <= last {
+		return false
+	}
+	s.replies.Set(peer, blockNum)
+	return true
+}
+
+// ChainInfo returns the state of the node's chain as reported to peers.
+func (node *Node) ChainInfo() proto_node.ChainInfo {
+	header := node.Blockchain().CurrentHeader()
+	return proto_node.ChainInfo{
+		ShardID:   header.ShardID(),
+		BlockNum:  header.Number().Uint64(),
+		BlockHash: header.Hash(),
+		Epoch:     header.Epoch().Uint64(),
+	}
+}
+
+// PeerChainInfo returns the chain info last reported by peer.
+func (node *Node) PeerChainInfo(peer libp2p_peer.ID) (proto_node.ChainInfo, bool) {
+	return node.peerChainInfo.infos().Get(peer)
+}
+
+// requestChainInfo broadcasts the node's chain info to its shard, asking peers to respond
+// with theirs directly. It is sent in a version 2 envelope, so only from the
+// MessageVersion2Epoch of the chain config.
+func (node *Node) requestChainInfo() error {
+	info := node.ChainInfo()
+	info.Request = true
+	msg := proto_node.ConstructEnvelope(proto_node.MessageVersion2, proto_node.ConstructChainInfoMessage(info))
+	return node.sendToGroups(
+		[]nodeconfig.GroupID{node.NodeConfig.GetShardGroupID()},
+		p2p.ConstructMessage(msg),
+	)
+}
+
+// chainInfoMessageHandler stores the chain info reported by the peer and answers its
+// request directly. Requests are only accepted published to the shard and replies only
+// sent directly, so that a request is not answered by every peer of the shard to all.
+func (node *Node) chainInfoMessageHandler(ctx context.Context, msgPayload []byte) error {
+	var info proto_node.ChainInfo
+	if err := rlp.DecodeBytes(msgPayload, &info); err != nil {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "invalid_chain_info"}).Inc()
+		utils.Logger().Debug().Err(err).Msg("[chainInfoMessageHandler] unable to decode chain info")
+		return nil
+	}
+	peer := MessagePeer(ctx)
+	if peer == "" || info.Request == isDirectMessage(ctx) {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "unexpected_chain_info"}).Inc()
+		return nil
+	}
+	node.peerChainInfo.set(peer, info)
+	if ds := node.getDownloaders(); ds != nil {
+		ds.SetPeerBlockNumber(info.ShardID, sttypes.StreamID(peer), info.BlockNum)
+	}
+	if !info.Request {
+		return nil
+	}
+	own := node.ChainInfo()
+	if !node.peerChainInfo.shouldReply(peer, own.BlockNum) {
+		return nil
+	}
+	msg := proto_node.ConstructEnvelope(proto_node.MessageVersion2, proto_node.ConstructChainInfoMessage(own))
+	node.goSpawn("chain_info_reply", func() {
+		if err := node.host.SendMessageToPeer(node.shutdown.context(), peer, msg); err != nil {
+			utils.Logger().Debug().Err(err).Str("peer", peer.String()).
+				Msg("[chainInfoMessageHandler] unable to send chain info")
+		}
+	})
+	return nil
+}
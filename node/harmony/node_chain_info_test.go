@@ -0,0 +1,99 @@
+package node
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	blockfactory "github.com/harmony-one/harmony/block/factory"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/registry"
+)
+
+func TestRequestChainInfo(t *testing.T) {
+	head := blockfactory.NewTestHeader().With().ShardID(1).Number(big.NewInt(42)).Epoch(big.NewInt(3)).Header()
+	host := &recordingHost{}
+	requester := &Node{
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		registry:   registry.New().SetBlockchain(headChain{headerChain{shardID: 1}, head}),
+		host:       idHost{host, "requester"},
+	}
+	if err := requester.requestChainInfo(); err != nil {
+		t.Fatal(err)
+	}
+	sent := host.sentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 chain info request, got %d", len(sent))
+	}
+	version, _, err := proto_node.OpenEnvelope(sent[0].msg[p2pMsgPrefixSize:])
+	if err != nil || version != proto_node.MessageVersion2 {
+		t.Fatalf("expected a version 2 envelope, got version %d: %v", version, err)
+	}
+
+	replies := &recordingHost{}
+	receiver := &Node{
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		registry:   registry.New().SetBlockchain(headChain{headerChain{shardID: 1}, head}),
+		host:       idHost{replies, "receiver"},
+	}
+	payload, actionType, err := receiver.validateNodeMessage(context.Background(), sent[0].msg[p2pMsgPrefixSize:])
+	if err != nil || actionType != proto_node.ChainInfo {
+		t.Fatalf("unexpected chain info message of type %v: %v", actionType, err)
+	}
+	if err := receiver.HandleNodeMessage(context.Background(), "requester", payload, actionType); err != nil {
+		t.Fatal(err)
+	}
+	info, ok := receiver.PeerChainInfo("requester")
+	if !ok || info.BlockNum != 42 || info.Epoch != 3 || !info.Request {
+		t.Errorf("unexpected chain info stored %+v", info)
+	}
+	waitForGoroutines(t, receiver)
+	reply := replies.sentMessages()
+	if len(reply) != 1 || reply[0].peer != "requester" {
+		t.Fatalf("expected the request answered to the requester only, got %+v", reply)
+	}
+
+	// the reply is accepted directly only
+	requester.psCtx = context.Background()
+	payload, _, err = requester.validateNodeMessage(context.Background(), reply[0].msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := requester.HandleNodeMessage(context.Background(), "receiver", payload, proto_node.ChainInfo); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := requester.PeerChainInfo("receiver"); ok {
+		t.Error("expected a published reply to be ignored")
+	}
+	requester.handleDirectMessage("receiver", reply[0].msg)
+	info, ok = requester.PeerChainInfo("receiver")
+	if !ok || info.BlockNum != 42 || info.Request {
+		t.Errorf("unexpected chain info stored from the reply %+v", info)
+	}
+
+	// a request sent directly is not answered
+	request := proto_node.ConstructEnvelope(proto_node.MessageVersion2, proto_node.ConstructChainInfoMessage(proto_node.ChainInfo{Request: true}))
+	receiver.psCtx = context.Background()
+	receiver.handleDirectMessage("other", request)
+	waitForGoroutines(t, receiver)
+	if _, ok := receiver.PeerChainInfo("other"); ok || len(replies.sentMessages()) != 1 {
+		t.Error("expected a direct request to be ignored")
+	}
+}
+
+func TestChainInfoShouldReply(t *testing.T) {
+	var store peerChainInfoStore
+	if !store.shouldReply("a", 5) {
+		t.Error("expected first request to be answered")
+	}
+	if store.shouldReply("a", 5) {
+		t.Error("expected second request at the same block to be ignored")
+	}
+	if !store.shouldReply("b", 5) {
+		t.Error("expected request of another peer to be answered")
+	}
+	if !store.shouldReply("a", 6) {
+		t.Error("expected request at a new block to be answered")
+	}
+}
@@ -1,25 +1,41 @@
 package node
 
 import (
+	"context"
+	"math/big"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	common2 "github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rlp"
 	ffi_bls "github.com/harmony-one/bls/ffi/go/bls"
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	"github.com/harmony-one/harmony/block"
+	"github.com/harmony-one/harmony/consensus/engine"
 	"github.com/harmony-one/harmony/core"
 	"github.com/harmony-one/harmony/core/types"
+	"github.com/harmony-one/harmony/crypto/bls"
+	"github.com/harmony-one/harmony/internal/chain"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
 	"github.com/harmony-one/harmony/internal/utils"
+	"github.com/harmony-one/harmony/internal/utils/crosslinks"
+	"github.com/harmony-one/harmony/internal/utils/lrucache"
+	"github.com/harmony-one/harmony/p2p"
 	"github.com/harmony-one/harmony/shard"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/time/rate"
 )
 
 var CrosslinkOutdatedErr = errors.New("crosslink signal is outdated")
 
 const (
 	maxPendingCrossLinkSize = 1000
-	crossLinkBatchSize      = 3
+	crossLinkBatchSize      = nodeconfig.DefaultCrossLinkBatchSize
 	maxCrossLinkRetries     = 3
 	retryDelay              = 5 * time.Second
 )
@@ -99,7 +115,11 @@ func (t *crossLinkRetryTracker) getRetryCount(cl *types.CrossLink) int {
 // ProcessCrossLinkHeartbeatMessage process crosslink heart beat signal.
 // This function is only called on shards 1,2,3 when network message `CrosslinkHeartbeat` receiving.
 func (node *Node) ProcessCrossLinkHeartbeatMessage(msgPayload []byte) {
-	if err := node.processCrossLinkHeartbeatMessage(msgPayload); err != nil {
+	node.processCrossLinkHeartbeat("", msgPayload)
+}
+
+func (node *Node) processCrossLinkHeartbeat(peerID libp2p_peer.ID, msgPayload []byte) {
+	if err := node.processCrossLinkHeartbeatMessage(peerID, msgPayload); err != nil {
 		utils.Logger().Err(err).
 			Msg("[ProcessCrossLinkHeartbeatMessage] failed process crosslink heartbeat signal")
 	}
@@ -113,9 +133,104 @@ func (node *Node) processEpochBlockMessage(msgPayload []byte) error {
 	if err != nil {
 		return errors.WithMessage(err, "failed to decode block")
 	}
-	if _, err := node.EpochChain().InsertChain(types.Blocks{block}, true); err != nil {
+	next := node.getEpochSequence().NextEpoch()
+	if err := checkEpochSequence(block.Epoch(), next); err != nil {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "epoch_block_out_of_sequence"}).Inc()
+		utils.Logger().Warn().
+			Err(err).
+			Uint64("epoch", block.Epoch().Uint64()).
+			Uint64("expectedEpoch", next.Uint64()).
+			Msg("[ProcessEpochBlock] rejecting epoch block out of sequence")
+		return errors.WithMessage(err, "invalid epoch block")
+	}
+	epochChain := node.EpochChain()
+	if block.Epoch().Cmp(next) < 0 && epochChain.HasBlock(block.Hash(), block.NumberU64()) {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "epoch_block_known"}).Inc()
+		return nil
+	}
+	if err := checkEpochBlock(block, epochChain.CurrentHeader().Epoch()); err != nil {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "epoch_block_rejected"}).Inc()
+		return errors.WithMessage(err, "invalid epoch block")
+	}
+	// The commit signature is verified by InsertChain, which writes the shard state,
+	// head block and header in a single batch only once the signature is valid.
+	if _, err := epochChain.InsertChain(types.Blocks{block}, true); err != nil {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "epoch_block_rejected"}).Inc()
 		return errors.WithMessage(err, "failed insert epoch block")
 	}
+	node.releaseBufferedReceipts(time.Now())
+	return nil
+}
+
+// epochSequence computes the epoch of the epoch block expected next by the epoch chain.
+type epochSequence interface {
+	NextEpoch() *big.Int
+}
+
+// epochChainSequence expects the epoch block of the epoch following the epoch chain head.
+type epochChainSequence struct {
+	chain core.BlockChain
+}
+
+// NextEpoch returns the epoch following the epoch of the epoch chain head.
+func (s epochChainSequence) NextEpoch() *big.Int {
+	return new(big.Int).Add(s.chain.CurrentHeader().Epoch(), common2.Big1)
+}
+
+// getEpochSequence returns the sequence of the epoch blocks received by the node, the
+// epoch chain unless another sequence is set.
+func (node *Node) getEpochSequence() epochSequence {
+	if node.epochSequence != nil {
+		return node.epochSequence
+	}
+	return epochChainSequence{chain: node.EpochChain()}
+}
+
+var (
+	errEpochBlockOutOfOrder = errors.New("epoch block is before the epoch chain head")
+	errEpochBlockFuture     = errors.New("epoch block is after the next expected epoch")
+)
+
+// checkEpochSequence verifies that an epoch block of epoch connects to the epoch chain
+// expecting next: it is either the expected block or the known epoch chain head.
+func checkEpochSequence(epoch, next *big.Int) error {
+	if epoch.Cmp(next) > 0 {
+		return errEpochBlockFuture
+	}
+	if new(big.Int).Sub(next, epoch).Cmp(common2.Big1) > 0 {
+		return errEpochBlockOutOfOrder
+	}
+	return nil
+}
+
+var (
+	errEpochBlockShard      = errors.New("epoch block is not from the beacon chain")
+	errEpochBlockNotLast    = errors.New("epoch block is not the last block in epoch")
+	errEpochBlockStale      = errors.New("epoch block is older than the epoch chain head")
+	errEpochBlockShardState = errors.New("epoch block shard state is for the wrong epoch")
+)
+
+// checkEpochBlock verifies everything about the epoch block which does not
+// need the committee, so that nothing is applied for an invalid block.
+// currentEpoch is the epoch of the epoch chain head.
+func checkEpochBlock(block *types.Block, currentEpoch *big.Int) error {
+	if block.ShardID() != shard.BeaconChainShardID {
+		return errEpochBlockShard
+	}
+	if !block.IsLastBlockInEpoch() {
+		return errEpochBlockNotLast
+	}
+	if block.Epoch().Cmp(currentEpoch) < 0 {
+		return errEpochBlockStale
+	}
+	state, err := shard.DecodeWrapper(block.Header().ShardState())
+	if err != nil {
+		return errors.WithMessage(err, "cannot decode epoch block shard state")
+	}
+	// Legacy shard states carry no epoch.
+	if state.Epoch != nil && state.Epoch.Cmp(new(big.Int).Add(block.Epoch(), big.NewInt(1))) != 0 {
+		return errEpochBlockShardState
+	}
 	return nil
 }
 
@@ -126,22 +241,27 @@ func (node *Node) ProcessEpochBlockMessage(msgPayload []byte) {
 	}
 }
 
-func (node *Node) processCrossLinkHeartbeatMessage(msgPayload []byte) error {
+func (node *Node) processCrossLinkHeartbeatMessage(peerID libp2p_peer.ID, msgPayload []byte) error {
 	hb := types.CrosslinkHeartbeat{}
 	err := rlp.DecodeBytes(msgPayload, &hb)
 	if err != nil {
 		return errors.WithMessagef(err, "cannot decode crosslink heartbeat message, len: %d", len(msgPayload))
 	}
 
-	// Check if the heartbeat is for the current shard
+	// Check that the heartbeat is for the current shard, that it comes from the beacon chain
+	// is checked with its signer, the gossip peer may only relay it
 	cur := node.Blockchain().CurrentBlock()
 	shardID := cur.ShardID()
-	if hb.ShardID != shardID {
-		utils.Logger().Debug().
+	numShards := shard.Schedule.InstanceForEpoch(cur.Epoch()).NumShards()
+	if err := checkHeartbeatShard(hb, shardID, numShards); err != nil {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "heartbeat_shard_mismatch"}).Inc()
+		utils.Logger().Warn().
+			Err(err).
+			Str("peer", peerID.String()).
 			Uint32("expectedShard", shardID).
 			Uint32("heartbeatShard", hb.ShardID).
-			Msg("[ProcessCrossLinkHeartbeatMessage] heartbeat for different shard, ignoring")
-		return nil
+			Msg("[ProcessCrossLinkHeartbeatMessage] rejecting heartbeat")
+		return err
 	}
 
 	// Check if epoch chain is synced to at least hb.Epoch before processing crosslink heartbeat
@@ -170,41 +290,98 @@ func (node *Node) processCrossLinkHeartbeatMessage(msgPayload []byte) error {
 	}
 
 	// Outdated signal.
-	if s := node.crosslinks.LastKnownCrosslinkHeartbeatSignal(); s != nil && s.LatestContinuousBlockNum > hb.LatestContinuousBlockNum {
+	if s := node.crosslinks.LastKnownShardCrosslinkHeartbeatSignal(hb.ShardID); s != nil && s.LatestContinuousBlockNum > hb.LatestContinuousBlockNum {
 		return errors.WithMessagef(CrosslinkOutdatedErr, "latest continuous block num: %d, got %d", s.LatestContinuousBlockNum, hb.LatestContinuousBlockNum)
 	}
 
-	sig := &ffi_bls.Sign{}
-	err = sig.Deserialize(hb.Signature)
-	if err != nil {
-		return errors.WithMessagef(err, "cannot deserialize signature, len: %d", len(hb.Signature))
+	if err := verifyHeartbeatSignature(epochChain, cur.Epoch(), &hb); err != nil {
+		counter := "heartbeat_invalid_signature"
+		switch {
+		case errors.Is(err, errNotBeaconCommittee):
+			counter = "heartbeat_signer_not_committee"
+		case errors.Is(err, errHeartbeatEpochStale):
+			counter = "heartbeat_stale_epoch"
+		}
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": counter}).Inc()
+		utils.Logger().Warn().
+			Err(err).
+			Str("peer", peerID.String()).
+			Uint32("heartbeatShard", hb.ShardID).
+			Msg("[ProcessCrossLinkHeartbeatMessage] rejecting heartbeat")
+		return err
 	}
 
+	utils.Logger().Info().
+		Msgf("[ProcessCrossLinkHeartbeatMessage] storing hb signal with block num %d", hb.LatestContinuousBlockNum)
+	node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&hb)
+	return nil
+}
+
+var errHeartbeatShard = errors.New("heartbeat for another shard")
+
+// checkHeartbeatShard checks that the heartbeat hb received by a node of shardID is for
+// shardID, a non-beacon shard out of numShards.
+func checkHeartbeatShard(hb types.CrosslinkHeartbeat, shardID, numShards uint32) error {
+	if hb.ShardID != shardID || hb.ShardID == shard.BeaconChainShardID || hb.ShardID >= numShards {
+		return errHeartbeatShard
+	}
+	return nil
+}
+
+// beaconCommitteeReader reads the committees of an epoch, as kept by the epoch chain.
+type beaconCommitteeReader interface {
+	ReadShardState(epoch *big.Int) (*shard.State, error)
+}
+
+// heartbeatMaxEpochLag is how many epochs the epoch of a heartbeat can be behind the shard.
+// Heartbeats carry the epoch of the last crosslink, which lags at epoch boundaries, but older
+// epochs would let retired beacon committee members sign heartbeats.
+const heartbeatMaxEpochLag = 1
+
+// verifyHeartbeatSignature verifies that hb is signed by its public key, over its RLP encoding
+// without signature, and that the key belongs to the beacon chain committee of the heartbeat
+// epoch, which is at most heartbeatMaxEpochLag behind curEpoch. The signature of hb is cleared.
+func verifyHeartbeatSignature(committees beaconCommitteeReader, curEpoch *big.Int, hb *types.CrosslinkHeartbeat) error {
+	if hb.Epoch+heartbeatMaxEpochLag < curEpoch.Uint64() {
+		return errors.WithMessagef(errHeartbeatEpochStale, "heartbeat epoch %d, current epoch %d", hb.Epoch, curEpoch.Uint64())
+	}
+	signature := hb.Signature
 	hb.Signature = nil
 	serialized, err := rlp.EncodeToBytes(hb)
 	if err != nil {
 		return errors.WithMessage(err, "cannot serialize crosslink heartbeat message")
 	}
+	return verifyBeaconCommitteeSignature(
+		committees, new(big.Int).SetUint64(hb.Epoch), hb.PublicKey, signature, serialized,
+	)
+}
+
+var (
+	errBeaconSignatureInvalid = errors.New("invalid signature")
+	errNotBeaconCommittee     = errors.New("pub key not in the beacon committee")
+	errHeartbeatEpochStale    = errors.New("heartbeat epoch too old")
+)
+
+// verifyBeaconCommitteeSignature verifies that signature is the signature of signed by pubKey
+// and that pubKey belongs to the beacon chain committee of the given epoch.
+func verifyBeaconCommitteeSignature(committees beaconCommitteeReader, epoch *big.Int, pubKey, signature, signed []byte) error {
+	sig := &ffi_bls.Sign{}
+	if err := sig.Deserialize(signature); err != nil {
+		return errors.WithMessagef(err, "cannot deserialize signature, len: %d", len(signature))
+	}
 
 	pub := ffi_bls.PublicKey{}
-	err = pub.Deserialize(hb.PublicKey)
-	if err != nil {
-		return errors.WithMessagef(err, "cannot deserialize public key, len: %d", len(hb.PublicKey))
+	if err := pub.Deserialize(pubKey); err != nil {
+		return errors.WithMessagef(err, "cannot deserialize public key, len: %d", len(pubKey))
 	}
 
-	ok := sig.VerifyHash(&pub, serialized)
-	if !ok {
-		return errors.New("invalid signature")
+	if !sig.VerifyHash(&pub, signed) {
+		return errBeaconSignatureInvalid
 	}
 
-	state, err := epochChain.ReadShardState(cur.Epoch())
+	state, err := committees.ReadShardState(epoch)
 	if err != nil {
-		utils.Logger().Warn().
-			Err(err).
-			Uint64("heartbeatEpoch", hb.Epoch).
-			Uint64("epochChainEpoch", epochChainEpoch).
-			Msg("[ProcessCrossLinkHeartbeatMessage] cannot read shard state for heartbeat epoch from beacon chain")
-		return errors.WithMessagef(err, "cannot read shard state for epoch %d from beacon chain", hb.Epoch)
+		return errors.WithMessagef(err, "cannot read shard state for epoch %d from beacon chain", epoch.Uint64())
 	}
 	committee, err := state.FindCommitteeByID(shard.BeaconChainShardID)
 	if err != nil {
@@ -215,31 +392,350 @@ func (node *Node) processCrossLinkHeartbeatMessage(msgPayload []byte) error {
 		return errors.WithMessage(err, "cannot get BLS public keys")
 	}
 
-	keyExists := false
 	for _, row := range pubs {
 		if pub.IsEqual(row.Object) {
-			keyExists = true
-			break
+			return nil
 		}
 	}
+	return errors.WithMessagef(errNotBeaconCommittee, "pub key %s, epoch %d, shard %d, pub keys len %d", pub.SerializeToHexStr(), epoch.Uint64(), shard.BeaconChainShardID, len(pubs))
+}
 
-	if !keyExists {
-		return errors.Errorf("pub key %s not found in committiee for epoch %d and shard %d, my current shard is %d, pub keys len %d", pub.SerializeToHexStr(), hb.Epoch, shard.BeaconChainShardID, shardID, len(pubs))
+// ProcessCrossLinkAckMessage process the beacon chain acknowledgement of accepted crosslinks.
+// This function is only called on shards 1,2,3 when network message `CrosslinkAck` receiving.
+func (node *Node) ProcessCrossLinkAckMessage(msgPayload []byte) {
+	if err := node.processCrossLinkAckMessage(msgPayload); err != nil {
+		utils.Logger().Err(err).
+			Msg("[ProcessCrossLinkAckMessage] failed process crosslink acknowledgement")
+	}
+}
+
+func (node *Node) processCrossLinkAckMessage(msgPayload []byte) error {
+	ack := types.CrosslinkAck{}
+	if err := rlp.DecodeBytes(msgPayload, &ack); err != nil {
+		return errors.WithMessagef(err, "cannot decode crosslink ack message, len: %d", len(msgPayload))
+	}
+
+	cur := node.Blockchain().CurrentBlock()
+	if ack.ShardID != cur.ShardID() {
+		return nil
+	}
+	if ack.BlockNum <= node.crosslinks.LatestAcceptedCrosslinkBlockNumber() {
+		return nil
+	}
+	if err := checkCrossLinkAck(ack, cur.NumberU64()); err != nil {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "ack_rejected"}).Inc()
+		return err
+	}
+
+	epochChain := node.EpochChain()
+	if epochChain == nil {
+		return errors.New("epoch chain not available")
+	}
+	sig, bitmap, err := chain.ParseCommitSigAndBitmap(ack.CommitSig)
+	if err != nil {
+		return errors.WithMessage(err, "cannot parse crosslink ack commit signature")
+	}
+	// The committee of the beacon block epoch is read from the epoch chain.
+	if err := epochChain.Engine().VerifyHeaderSignature(epochChain, ack.BeaconHeader, sig, bitmap); err != nil {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "ack_rejected"}).Inc()
+		return errors.WithMessage(err, "invalid crosslink ack beacon block signature")
 	}
 
 	utils.Logger().Info().
-		Msgf("[ProcessCrossLinkHeartbeatMessage] storing hb signal with block num %d", hb.LatestContinuousBlockNum)
-	node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&hb)
+		Msgf("[ProcessCrossLinkAckMessage] crosslinks accepted up to block num %d", ack.BlockNum)
+	node.crosslinks.AdvanceLatestAcceptedCrosslinkBlockNumber(ack.BlockNum)
+	return nil
+}
+
+var (
+	errCrossLinkAckAhead       = errors.New("crosslink ack is ahead of the shard chain")
+	errCrossLinkAckNoBlock     = errors.New("crosslink ack without beacon block")
+	errCrossLinkAckNotIncluded = errors.New("crosslink ack block not included in the beacon block")
+)
+
+// checkCrossLinkAck verifies everything about ack which does not need the beacon
+// committee: the acknowledged block is not ahead of head, the shard chain head, and
+// its crosslink is included in the beacon block of the ack.
+func checkCrossLinkAck(ack types.CrosslinkAck, head uint64) error {
+	if ack.BlockNum > head {
+		return errCrossLinkAckAhead
+	}
+	if ack.BeaconHeader == nil || ack.BeaconHeader.ShardID() != shard.BeaconChainShardID {
+		return errCrossLinkAckNoBlock
+	}
+	crossLinks := types.CrossLinks{}
+	if err := rlp.DecodeBytes(ack.BeaconHeader.CrossLinks(), &crossLinks); err != nil {
+		return errors.WithMessage(err, "cannot decode crosslink ack beacon block crosslinks")
+	}
+	for _, cl := range crossLinks {
+		if cl.ShardID() == ack.ShardID && cl.BlockNum() == ack.BlockNum {
+			return nil
+		}
+	}
+	return errCrossLinkAckNotIncluded
+}
+
+// isFutureCrossLink returns true if cl is more than tolerance blocks ahead of the
+// last crosslink of its shard known to the beacon chain. Crosslinks do not carry a
+// timestamp, so the block number is the only measure of how far ahead they are.
+func isFutureCrossLink(cl types.CrossLink, lastLink *types.CrossLink, tolerance uint64) bool {
+	if lastLink == nil {
+		return false
+	}
+	return cl.BlockNum() > lastLink.BlockNum()+tolerance
+}
+
+// isReplayedCrossLinkMessage returns true if all the crosslinks are at or below the last
+// continuous crosslink of their shard, such as a message processed before being replayed.
+// Those crosslinks would be discarded by the block proposal anyway.
+func isReplayedCrossLinkMessage(crosslinks []types.CrossLink, last func(shardID uint32) (*types.CrossLink, error)) bool {
+	watermarks := make(map[uint32]uint64)
+	for _, cl := range crosslinks {
+		watermark, ok := watermarks[cl.ShardID()]
+		if !ok {
+			lastLink, err := last(cl.ShardID())
+			if err != nil || lastLink == nil {
+				return false
+			}
+			watermark = lastLink.BlockNum()
+			watermarks[cl.ShardID()] = watermark
+		}
+		if cl.BlockNum() > watermark {
+			return false
+		}
+	}
+	return len(crosslinks) > 0
+}
+
+var (
+	errCrossLinkGap     = errors.New("crosslink leaves a gap after the last crosslink of its shard")
+	errCrossLinkOverlap = errors.New("crosslink overlaps the crosslinks of its shard")
+)
+
+// checkCrossLinkContinuity returns an error if cl is not the crosslink of block next,
+// the block following the last known crosslink of its shard.
+func checkCrossLinkContinuity(cl types.CrossLink, next uint64) error {
+	switch {
+	case cl.BlockNum() > next:
+		return errCrossLinkGap
+	case cl.BlockNum() < next:
+		return errCrossLinkOverlap
+	}
+	return nil
+}
+
+// crossLinkSequence tracks the next crosslink block number expected for each shard,
+// following the last crosslink on the beacon chain and the pending ones.
+type crossLinkSequence struct {
+	next    map[uint32]uint64
+	pending []types.CrossLink
+	last    func(shardID uint32) (*types.CrossLink, error)
+}
+
+// expected returns the next crosslink block number of shardID, false if the shard has no crosslink yet.
+func (s *crossLinkSequence) expected(shardID uint32) (uint64, bool) {
+	if next, ok := s.next[shardID]; ok {
+		return next, true
+	}
+	lastLink, err := s.last(shardID)
+	if err != nil || lastLink == nil {
+		return 0, false
+	}
+	next := lastLink.BlockNum() + 1
+	for _, pending := range s.pending {
+		if pending.ShardID() == shardID && pending.BlockNum() >= next {
+			next = pending.BlockNum() + 1
+		}
+	}
+	s.next[shardID] = next
+	return next, true
+}
+
+// accept records cl as the last crosslink of its shard.
+func (s *crossLinkSequence) accept(cl types.CrossLink) {
+	s.next[cl.ShardID()] = cl.BlockNum() + 1
+}
+
+const (
+	// defaultCrossLinkQuarantineWindow is the default period invalid crosslinks of a peer are counted over.
+	defaultCrossLinkQuarantineWindow = 10 * time.Minute
+	// defaultCrossLinkQuarantineCooldown is the default time the crosslinks of a quarantined peer are dropped.
+	defaultCrossLinkQuarantineCooldown = 30 * time.Minute
+)
+
+// crossLinkQuarantine keeps the peers which sent too many invalid crosslinks, so that their
+// crosslinks are dropped without verification for a while.
+type crossLinkQuarantine struct {
+	mu       sync.Mutex
+	failures map[libp2p_peer.ID][]time.Time
+	until    map[libp2p_peer.ID]time.Time
+}
+
+// quarantined returns true if the crosslinks of peer are to be dropped at now.
+func (q *crossLinkQuarantine) quarantined(peer libp2p_peer.ID, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	until, ok := q.until[peer]
+	if ok && !now.Before(until) {
+		delete(q.until, peer)
+		return false
+	}
+	return ok
+}
+
+// recordInvalid counts an invalid crosslink from peer, quarantining it for cooldown once it sent
+// threshold invalid crosslinks within window. It returns true if the peer got quarantined.
+func (q *crossLinkQuarantine) recordInvalid(
+	peer libp2p_peer.ID, now time.Time, threshold int, window, cooldown time.Duration,
+) bool {
+	if window <= 0 {
+		window = defaultCrossLinkQuarantineWindow
+	}
+	if cooldown <= 0 {
+		cooldown = defaultCrossLinkQuarantineCooldown
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.failures == nil {
+		q.failures = make(map[libp2p_peer.ID][]time.Time)
+		q.until = make(map[libp2p_peer.ID]time.Time)
+	}
+	recent := q.failures[peer][:0]
+	for _, at := range q.failures[peer] {
+		if now.Sub(at) < window {
+			recent = append(recent, at)
+		}
+	}
+	recent = append(recent, now)
+	if len(recent) < threshold {
+		q.failures[peer] = recent
+		return false
+	}
+	delete(q.failures, peer)
+	q.until[peer] = now.Add(cooldown)
+	return true
+}
+
+// list returns the quarantined peers with the end of their quarantine.
+func (q *crossLinkQuarantine) list(now time.Time) map[libp2p_peer.ID]time.Time {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	out := make(map[libp2p_peer.ID]time.Time)
+	for peer, until := range q.until {
+		if now.Before(until) {
+			out[peer] = until
+		}
+	}
+	return out
+}
+
+// QuarantinedPeers returns the peers whose crosslinks are dropped for sending too many invalid
+// crosslinks, with the end of their quarantine.
+func (node *Node) QuarantinedPeers() map[libp2p_peer.ID]time.Time {
+	return node.crossLinkQuarantine.list(time.Now())
+}
+
+// defaultCrossLinkRateBurst is the default burst of crosslinks per peer, room for a few
+// catch-up batches.
+const defaultCrossLinkRateBurst = crossLinkBatchSize * 20
+
+// maxCrossLinkPeers is the number of peers, or shards, whose crosslink rate is tracked
+const maxCrossLinkPeers = 1024
+
+// crossLinkRateLimiter limits the crosslinks received by key, the sending peer or the
+// shard of the crosslinks.
+type crossLinkRateLimiter[K comparable] struct {
+	mu       sync.Mutex
+	limiters *lrucache.Cache[K, *rate.Limiter]
+}
+
+// allow returns true if n more crosslinks of key are within the rate limit.
+func (l *crossLinkRateLimiter[K]) allow(key K, n int, limit float64, burst int, now time.Time) bool {
+	if burst <= 0 {
+		burst = defaultCrossLinkRateBurst
+	}
+	if n > burst {
+		n = burst
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limiters == nil {
+		l.limiters = lrucache.NewCache[K, *rate.Limiter](maxCrossLinkPeers)
+	}
+	limiter, ok := l.limiters.Get(key)
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit), burst)
+		l.limiters.Set(key, limiter)
+	}
+	return limiter.AllowN(now, n)
+}
+
+// rateLimitCrossLinks drops the crosslinks of a peer sending above the configured rate,
+// before they are verified. The crosslinks of the node itself, with an empty peerID, are
+// not limited.
+func (node *Node) rateLimitCrossLinks(peerID libp2p_peer.ID, crosslinks []types.CrossLink) []types.CrossLink {
+	limit := node.NodeConfig.Handler.CrossLinkRateLimit
+	if limit <= 0 || peerID == "" {
+		return crosslinks
+	}
+	if node.crossLinkPeerLimiter.allow(peerID, len(crosslinks), limit, node.NodeConfig.Handler.CrossLinkRateBurst, time.Now()) {
+		return crosslinks
+	}
+	nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "rate_limited"}).Add(float64(len(crosslinks)))
+	utils.Logger().Warn().
+		Int("crossLinks", len(crosslinks)).
+		Str("peer", peerID.String()).
+		Msg("[ProcessingCrossLink] Dropping cross-links above the peer rate limit")
 	return nil
 }
 
+// allowVerifiedCrossLink returns true if a verified crosslink of the shard is within the
+// configured rate. The shard is only trusted once the crosslink header and signature are
+// verified, so a peer claiming the shard of others cannot exhaust its rate. The crosslinks
+// of the node itself, with an empty peerID, are not limited.
+func (node *Node) allowVerifiedCrossLink(peerID libp2p_peer.ID, shardID uint32) bool {
+	limit := node.NodeConfig.Handler.CrossLinkRateLimit
+	if limit <= 0 || peerID == "" {
+		return true
+	}
+	return node.crossLinkShardLimiter.allow(shardID, 1, limit, node.NodeConfig.Handler.CrossLinkRateBurst, time.Now())
+}
+
+var errEmptyCrossLinkMessage = errors.New("empty crosslink message")
+
+// decodeCrossLinkMessage decodes the crosslinks of a crosslink message, which cannot be empty.
+func decodeCrossLinkMessage(msgPayload []byte) ([]types.CrossLink, error) {
+	var crosslinks []types.CrossLink
+	if err := rlp.DecodeBytes(msgPayload, &crosslinks); err != nil {
+		return nil, err
+	}
+	if len(crosslinks) == 0 {
+		return nil, errEmptyCrossLinkMessage
+	}
+	return crosslinks, nil
+}
+
 // ProcessCrossLinkMessage verify and process Node/CrossLink message into crosslink when it's valid
 func (node *Node) ProcessCrossLinkMessage(msgPayload []byte) {
+	node.processCrossLinkMessage("", msgPayload)
+}
+
+func (node *Node) processCrossLinkMessage(peerID libp2p_peer.ID, msgPayload []byte) {
 	// Only process cross-link messages on beacon chain
 	if !node.IsRunningBeaconChain() {
 		return
 	}
 
+	if peerID != "" && node.crossLinkQuarantine.quarantined(peerID, time.Now()) {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "quarantined_peer"}).Inc()
+		return
+	}
+
 	pendingCLs, err := node.Blockchain().ReadPendingCrossLinks()
 	if err != nil {
 		utils.Logger().Debug().
@@ -257,16 +753,40 @@ func (node *Node) ProcessCrossLinkMessage(msgPayload []byte) {
 		existingCLs[pending.Hash()] = struct{}{}
 	}
 
-	var crosslinks []types.CrossLink
-	if err := rlp.DecodeBytes(msgPayload, &crosslinks); err != nil {
+	crosslinks, err := decodeCrossLinkMessage(msgPayload)
+	if err == errEmptyCrossLinkMessage {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "empty_crosslink_msg"}).Inc()
+		utils.Logger().Debug().
+			Str("peer", peerID.String()).
+			Msg("[ProcessingCrossLink] Rejecting empty crosslink message")
+		return
+	}
+	if err != nil {
 		utils.Logger().Error().
 			Err(err).
 			Msg("[ProcessingCrossLink] Crosslink Message Broadcast Unable to Decode")
 		return
 	}
+	if isReplayedCrossLinkMessage(crosslinks, node.Blockchain().ReadShardLastCrossLink) {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "crosslink_replay"}).Inc()
+		utils.Logger().Debug().
+			Str("peer", peerID.String()).
+			Int("crosslinks", len(crosslinks)).
+			Msg("[ProcessingCrossLink] Dropping crosslinks already accepted")
+		return
+	}
+	crosslinks = node.rateLimitCrossLinks(peerID, crosslinks)
 
 	var candidates []types.CrossLink
 	var failedCrossLinks []types.CrossLink
+	var sequence *crossLinkSequence
+	if node.NodeConfig.Handler.CrossLinkContinuity {
+		sequence = &crossLinkSequence{
+			next:    make(map[uint32]uint64),
+			pending: pendingCLs,
+			last:    node.Blockchain().ReadShardLastCrossLink,
+		}
+	}
 
 	utils.Logger().Debug().
 		Msgf("[ProcessingCrossLink] Received crosslinks: %d", len(crosslinks))
@@ -309,6 +829,46 @@ func (node *Node) ProcessCrossLinkMessage(msgPayload []byte) {
 			continue
 		}
 
+		// Reject cross-links implausibly ahead of what the beacon chain knows about the shard
+		if tolerance := node.NodeConfig.Handler.CrossLinkFutureTolerance; tolerance > 0 {
+			lastLink, err := node.Blockchain().ReadShardLastCrossLink(cl.ShardID())
+			if err == nil && isFutureCrossLink(cl, lastLink, tolerance) {
+				nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "future_crosslink"}).Inc()
+				utils.Logger().Warn().
+					Str("crossLinkHash", cl.Hash().Hex()).
+					Uint64("crossLinkNumber", cl.Number().Uint64()).
+					Uint64("lastCrossLinkNumber", lastLink.BlockNum()).
+					Uint32("crossLinkShardID", cl.ShardID()).
+					Msg("[ProcessingCrossLink] Rejecting cross-link from the future")
+				continue
+			}
+		}
+
+		// Reject cross-links out of sequence with the last known cross-link of their shard
+		if sequence != nil {
+			if next, ok := sequence.expected(cl.ShardID()); ok {
+				if err := checkCrossLinkContinuity(cl, next); err != nil {
+					counter := "crosslink_gap"
+					if err == errCrossLinkOverlap {
+						counter = "crosslink_overlap"
+					}
+					nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": counter}).Inc()
+					utils.Logger().Warn().
+						Err(err).
+						Str("crossLinkHash", cl.Hash().Hex()).
+						Uint64("crossLinkNumber", cl.Number().Uint64()).
+						Uint64("expectedNumber", next).
+						Uint32("crossLinkShardID", cl.ShardID()).
+						Msg("[ProcessingCrossLink] Rejecting cross-link out of sequence")
+					if err == errCrossLinkGap && peerID != "" {
+						// the sender may still have the crosslinks of the gap
+						node.requestCrossLinkReplay(peerID, cl.ShardID(), next-1)
+					}
+					continue
+				}
+			}
+		}
+
 		// Check if node is synced enough to handle this cross-link
 		localEpoch := node.Blockchain().CurrentBlock().Header().Epoch().Uint64()
 		crossLinkEpoch := cl.Epoch().Uint64()
@@ -355,6 +915,16 @@ func (node *Node) ProcessCrossLinkMessage(msgPayload []byte) {
 				Uint32("crossLinkShardID", cl.ShardID()).
 				Int("retryCount", globalRetryTracker.getRetryCount(&cl)).
 				Msg("[ProcessingCrossLink] Failed to verify cross-link - will retry")
+			if threshold := node.NodeConfig.Handler.CrossLinkQuarantineThreshold; threshold > 0 && peerID != "" &&
+				node.crossLinkQuarantine.recordInvalid(
+					peerID, time.Now(), threshold,
+					node.NodeConfig.Handler.CrossLinkQuarantineWindow, node.NodeConfig.Handler.CrossLinkQuarantineCooldown,
+				) {
+				nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "peer_quarantined"}).Inc()
+				utils.Logger().Warn().
+					Str("peer", peerID.String()).
+					Msg("[ProcessingCrossLink] Quarantining peer sending invalid cross-links")
+			}
 
 			// Sleep before retry to avoid hammering the system
 			time.Sleep(retryDelay)
@@ -364,8 +934,20 @@ func (node *Node) ProcessCrossLinkMessage(msgPayload []byte) {
 		// Success! Clean up the retry tracker (if it has been retried)
 		globalRetryTracker.cleanupFailed(&cl)
 
+		if !node.allowVerifiedCrossLink(peerID, cl.ShardID()) {
+			nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "shard_rate_limited"}).Inc()
+			utils.Logger().Warn().
+				Str("crossLinkHash", cl.Hash().Hex()).
+				Uint32("crossLinkShardID", cl.ShardID()).
+				Msg("[ProcessingCrossLink] Dropping cross-link above the shard rate limit")
+			continue
+		}
+
 		// Add to candidates for processing
 		candidates = append(candidates, cl)
+		if sequence != nil {
+			sequence.accept(cl)
+		}
 		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "new_crosslink"}).Inc()
 	}
 
@@ -429,3 +1011,1001 @@ func (node *Node) VerifyCrossLink(cl types.CrossLink) error {
 	}
 	return nil
 }
+
+// CachedCrossLinkMessages returns the recently broadcast crosslink messages covering
+// blocks after fromBlockNum, so a beacon node which was down can be served without
+// rebuilding the messages from the chain.
+func (node *Node) CachedCrossLinkMessages(fromBlockNum uint64) [][]byte {
+	sent := node.crosslinks.SentMessagesSince(fromBlockNum, time.Now())
+	msgs := make([][]byte, 0, len(sent))
+	for _, msg := range sent {
+		msgs = append(msgs, msg.Payload)
+	}
+	return msgs
+}
+
+// crossLinkReplayInterval is how often the crosslinks of a shard are requested for replay.
+const crossLinkReplayInterval = 10 * time.Second
+
+// crossLinkReplayRequests throttles the crosslink replays requested for each shard.
+type crossLinkReplayRequests struct {
+	mu   sync.Mutex
+	last map[uint32]time.Time
+}
+
+// allow returns true if a replay of the crosslinks of shardID can be requested at now.
+func (r *crossLinkReplayRequests) allow(shardID uint32, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.last[shardID]; ok && now.Sub(last) < crossLinkReplayInterval {
+		return false
+	}
+	if r.last == nil {
+		r.last = make(map[uint32]time.Time)
+	}
+	r.last[shardID] = now
+	return true
+}
+
+// requestCrossLinkReplay asks peer, which sent crosslinks of shardID past a gap, for the
+// crosslink messages it sent covering the blocks after fromBlockNum.
+func (node *Node) requestCrossLinkReplay(peer libp2p_peer.ID, shardID uint32, fromBlockNum uint64) {
+	if !node.crossLinkReplays.allow(shardID, time.Now()) {
+		return
+	}
+	nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "replay_requested"}).Inc()
+	msg := proto_node.ConstructCrossLinkReplayRequestMessage(proto_node.CrossLinkReplayRequest{
+		ShardID:      shardID,
+		FromBlockNum: fromBlockNum,
+	})
+	node.goSpawn("crosslink_replay_request", func() {
+		if err := node.host.SendMessageToPeer(node.shutdown.context(), peer, msg); err != nil {
+			utils.Logger().Debug().Err(err).
+				Str("peer", peer.String()).
+				Uint32("shardID", shardID).
+				Msg("[ProcessingCrossLink] could not request crosslink replay")
+		}
+	})
+}
+
+// crossLinkReplayHandler sends the crosslink messages of CachedCrossLinkMessages requested
+// by a beacon node back to it. Only the requests sent directly to the node are served.
+func (node *Node) crossLinkReplayHandler(ctx context.Context, payload []byte) error {
+	if !isDirectMessage(ctx) {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "replay_not_direct"}).Inc()
+		return nil
+	}
+	var req proto_node.CrossLinkReplayRequest
+	if err := rlp.DecodeBytes(payload, &req); err != nil {
+		return errors.WithMessage(err, "cannot decode crosslink replay request")
+	}
+	if node.IsRunningBeaconChain() || req.ShardID != node.Blockchain().ShardID() {
+		return nil
+	}
+	peer := MessagePeer(ctx)
+	for _, msg := range node.CachedCrossLinkMessages(req.FromBlockNum) {
+		// the cached messages are the p2p messages broadcast
+		if err := node.host.SendMessageToPeer(ctx, peer, msg[p2pMsgPrefixSize:]); err != nil {
+			return errors.WithMessagef(err, "cannot replay crosslinks to peer %s", peer)
+		}
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "replay_served"}).Inc()
+	}
+	return nil
+}
+
+// SetLatestSentCrosslink overrides the latest crosslink block number the node has sent
+// to the beacon chain, to recover from a wrong value making it rebroadcast a backlog.
+// The block number cannot be ahead of the chain head.
+func (node *Node) SetLatestSentCrosslink(shardID uint32, blockNum uint64) error {
+	if node.IsRunningBeaconChain() {
+		return errors.New("beacon chain does not send crosslinks")
+	}
+	if shardID != node.Blockchain().ShardID() {
+		return errors.Errorf("node runs shard %d, not %d", node.Blockchain().ShardID(), shardID)
+	}
+	if head := node.Blockchain().CurrentHeader().Number().Uint64(); blockNum > head {
+		return errors.Errorf("block number %d is ahead of chain head %d", blockNum, head)
+	}
+	prev := node.crosslinks.LatestSentCrosslinkBlockNumber()
+	node.crosslinks.SetLatestSentCrosslinkBlockNumber(blockNum)
+	utils.Logger().Warn().
+		Uint32("shardID", shardID).
+		Uint64("previous", prev).
+		Uint64("blockNum", blockNum).
+		Msg("[SetLatestSentCrosslink] latest sent crosslink block number manually overridden")
+	return nil
+}
+
+// CrosslinkCatchupProgress is the progress of sending a crosslink backlog to the beacon chain.
+type CrosslinkCatchupProgress struct {
+	Active       bool
+	StartBlock   uint64
+	TargetBlock  uint64
+	CurrentBlock uint64
+	Percent      float64
+}
+
+// crosslinkCatchup tracks the catch-up with a backlog larger than one broadcast can send.
+type crosslinkCatchup struct {
+	mu       sync.Mutex
+	progress CrosslinkCatchupProgress
+}
+
+// update records a broadcast of the crosslinks from sentFrom to sentTo while the chain head is at head.
+func (c *crosslinkCatchup) update(sentFrom, sentTo, head uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	behind := head > sentTo && head-sentTo > crossLinkBatchSize*2
+	p := &c.progress
+	if !p.Active {
+		if !behind {
+			return
+		}
+		*p = CrosslinkCatchupProgress{Active: true, StartBlock: sentFrom - 1}
+	}
+	p.CurrentBlock = sentTo
+	p.TargetBlock = head
+	p.Active = behind
+	if !p.Active {
+		p.CurrentBlock = head
+	}
+	p.Percent = 100
+	if p.TargetBlock > p.StartBlock && p.CurrentBlock < p.TargetBlock {
+		p.Percent = float64(p.CurrentBlock-p.StartBlock) * 100 / float64(p.TargetBlock-p.StartBlock)
+	}
+}
+
+// CrosslinkCatchupProgress returns the progress of the current or last crosslink catch-up,
+// the zero value if the node never fell behind by more than a broadcast can send.
+func (node *Node) CrosslinkCatchupProgress() CrosslinkCatchupProgress {
+	node.crosslinkCatchup.mu.Lock()
+	defer node.crosslinkCatchup.mu.Unlock()
+
+	return node.crosslinkCatchup.progress
+}
+
+// CrosslinkRecipients are the recipients of a crosslink broadcast. The host does not report
+// the peers a send reached, so these are the peers of the group known when sending, which
+// flood publishing sends to.
+type CrosslinkRecipients struct {
+	Group         nodeconfig.GroupID
+	Peers         []libp2p_peer.ID
+	FirstBlockNum uint64
+	LastBlockNum  uint64
+	SentAt        time.Time
+}
+
+// crosslinkRecipients keeps the recipients of the last crosslink broadcast.
+type crosslinkRecipients struct {
+	mu   sync.Mutex
+	last CrosslinkRecipients
+}
+
+// record keeps the recipients of a broadcast of the crosslinks from firstBlockNum to lastBlockNum to group.
+func (r *crosslinkRecipients) record(
+	host p2p.Host, group nodeconfig.GroupID, firstBlockNum, lastBlockNum uint64, sentAt time.Time,
+) {
+	peers := host.ListPeer(string(group))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.last = CrosslinkRecipients{
+		Group:         group,
+		Peers:         peers,
+		FirstBlockNum: firstBlockNum,
+		LastBlockNum:  lastBlockNum,
+		SentAt:        sentAt,
+	}
+}
+
+// LastCrosslinkRecipients returns the recipients of the last crosslink broadcast, the zero
+// value if none was recorded. Recording is enabled by the RecordCrossLinkRecipients setting.
+func (node *Node) LastCrosslinkRecipients() CrosslinkRecipients {
+	node.lastCrosslinkRecipients.mu.Lock()
+	defer node.lastCrosslinkRecipients.mu.Unlock()
+
+	return node.lastCrosslinkRecipients.last
+}
+
+// BroadcastCrossLinkFromShardsToBeacon is called by consensus leader to
+// send the new header as cross link to beacon chain.
+func (node *Node) BroadcastCrossLinkFromShardsToBeacon() { // leader of 1-3 shards
+	percent := samplePercent(node.NodeConfig.Handler.CrossLinkSamplePercent, defaultCrossLinkSamplePercent)
+	node.broadcastCrossLink(node.takesPartInBroadcast(node.broadcastRole().IsCurrentlyLeader(), percent))
+}
+
+// TriggerCrossLinkBroadcast broadcasts the pending crosslinks to the beacon chain right
+// away instead of on the next periodic broadcast, as when the node just became leader.
+// It is subject to the same checks as the periodic broadcast but for the leader one,
+// and is safe to call while a periodic broadcast runs.
+func (node *Node) TriggerCrossLinkBroadcast() {
+	node.broadcastCrossLink(true)
+}
+
+// crossLinkBroadcastOutcomes are the crosslink broadcast outcome labels of the skip reasons.
+var crossLinkBroadcastOutcomes = map[string]string{
+	skipCrosslinkWarmingUp:     "skipped_warming_up",
+	skipCrosslinkNotSampled:    "skipped_not_leader",
+	skipCrosslinkNotCrossLink:  "skipped_not_crosslink_epoch",
+	skipCrosslinkNoCrosslinks:  "skipped_no_headers",
+	skipCrosslinkHeadersFailed: "skipped_headers_failed",
+}
+
+// countCrossLinkBroadcast counts a crosslink broadcast outcome of the node's shard.
+func (node *Node) countCrossLinkBroadcast(outcome string) {
+	nodeCrossLinkBroadcastCounterVec.With(prometheus.Labels{
+		"shard":   strconv.FormatUint(uint64(node.NodeConfig.ShardID), 10),
+		"outcome": outcome,
+	}).Inc()
+}
+
+// broadcastCrossLink broadcasts the crosslinks of the current block to the beacon chain,
+// sampled tells whether a non-leader node was picked to broadcast.
+func (node *Node) broadcastCrossLink(sampled bool) {
+	node.crossLinkBroadcastMu.Lock()
+	defer node.crossLinkBroadcastMu.Unlock()
+
+	curBlock := node.Blockchain().CurrentBlock()
+	skipReasons, forced := node.shouldBroadcastCrosslink(curBlock, time.Now(), sampled)
+	if len(skipReasons) > 0 {
+		for _, reason := range skipReasons {
+			if outcome, ok := crossLinkBroadcastOutcomes[reason]; ok {
+				node.countCrossLinkBroadcast(outcome)
+			}
+		}
+		if slices.Contains(skipReasons, skipCrosslinkWarmingUp) {
+			utils.Logger().Info().Msg("[BroadcastCrossLink] warming up, crosslink state not known yet")
+		}
+		return
+	}
+
+	utils.Logger().Info().Msgf(
+		"Construct and Broadcasting new crosslink to beacon chain groupID %s",
+		nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID),
+	)
+
+	headers, beaconGroup, err := node.selectCrosslinkBroadcast(curBlock)
+	if err != nil {
+		node.countCrossLinkBroadcast(crossLinkBroadcastOutcomes[skipCrosslinkHeadersFailed])
+		utils.Logger().Error().Err(err).Msg("[BroadcastCrossLink] failed to get crosslinks")
+		return
+	}
+
+	if len(headers) == 0 {
+		node.countCrossLinkBroadcast(crossLinkBroadcastOutcomes[skipCrosslinkNoCrosslinks])
+		utils.Logger().Info().Msg("[BroadcastCrossLink] no crosslinks to broadcast")
+		return
+	}
+
+	for _, h := range headers {
+		utils.Logger().Info().Msgf("[BroadcastCrossLink] header shard %d blockNum %d", h.ShardID(), h.Number().Uint64())
+	}
+
+	// the headers are sent in chunks fitting the message size limit, the crosslinks sent
+	// before a failed chunk are kept as sent
+	var (
+		sent   int
+		sentAt time.Time
+	)
+	chunks := crossLinkChunks(node.Blockchain(), headers, node.crossLinkMaxMessageSize())
+	for _, chunk := range chunks {
+		if err = node.sendCrossLinkMessage(beaconGroup, chunk.msg); err != nil {
+			break
+		}
+		sentAt = time.Now()
+		node.crosslinks.AddSentMessage(crosslinks.SentMessage{
+			FirstBlockNum: chunk.headers[0].Number().Uint64(),
+			LastBlockNum:  chunk.headers[len(chunk.headers)-1].Number().Uint64(),
+			Payload:       chunk.msg,
+			SentAt:        sentAt,
+		})
+		sent += len(chunk.headers)
+	}
+	switch {
+	case err != nil && sent == 0:
+		node.countCrossLinkBroadcast("send_failed")
+		utils.Logger().Error().Err(err).Msgf("[BroadcastCrossLink] failed to broadcast message")
+	case err != nil:
+		node.countCrossLinkBroadcast("partially_sent")
+		utils.Logger().Error().Err(err).
+			Int("sentHeaders", sent).
+			Int("headers", len(headers)).
+			Msg("[BroadcastCrossLink] failed to broadcast all the chunks")
+	default:
+		node.countCrossLinkBroadcast("sent")
+	}
+	if sent > 0 {
+		headers = headers[:sent]
+		nodeCrossLinkBroadcastHeadersHistogramVec.With(prometheus.Labels{
+			"shard": strconv.FormatUint(uint64(node.NodeConfig.ShardID), 10),
+		}).Observe(float64(len(headers)))
+		firstBlockNum, lastBlockNum := headers[0].Number().Uint64(), headers[len(headers)-1].Number().Uint64()
+		node.crosslinks.SetLatestSentCrosslinkBlockNumber(lastBlockNum)
+		node.crosslinkCatchup.update(firstBlockNum, lastBlockNum, curBlock.NumberU64())
+		if node.NodeConfig.Handler.RecordCrossLinkRecipients {
+			node.lastCrosslinkRecipients.record(node.host, beaconGroup, firstBlockNum, lastBlockNum, sentAt)
+			utils.Logger().Debug().
+				Str("group", string(beaconGroup)).
+				Int("peers", len(node.LastCrosslinkRecipients().Peers)).
+				Msg("[BroadcastCrossLink] recorded crosslink recipients")
+		}
+		if forced {
+			nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "starvation_forced_broadcast"}).Inc()
+			utils.Logger().Info().Uint64("lastBlockNum", lastBlockNum).
+				Msg("[BroadcastCrossLink] forced broadcast after starvation threshold")
+		}
+	}
+}
+
+const (
+	// defaultCrossLinkSendRetries is the default number of retries of a failed crosslink message.
+	defaultCrossLinkSendRetries = 2
+	// defaultCrossLinkSendBackoff is the default delay before the first retry of a crosslink message.
+	defaultCrossLinkSendBackoff = 200 * time.Millisecond
+)
+
+// sendCrossLinkMessage sends the crosslink message msg to group, retrying a failed send
+// with exponential backoff so that a transient host error doesn't hold the crosslinks
+// back until the next broadcast. Sends refused by the circuit breaker are not retried.
+func (node *Node) sendCrossLinkMessage(group nodeconfig.GroupID, msg []byte) error {
+	retries := node.NodeConfig.Handler.CrossLinkSendRetries
+	if retries == 0 {
+		retries = defaultCrossLinkSendRetries
+	}
+	backoff := node.NodeConfig.Handler.CrossLinkSendBackoff
+	if backoff <= 0 {
+		backoff = defaultCrossLinkSendBackoff
+	}
+	return node.sendWithRetries([]nodeconfig.GroupID{group}, msg, retries, backoff, func(attempt int, err error) {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "broadcast_retry"}).Inc()
+		utils.Logger().Warn().Err(err).
+			Int("attempt", attempt).
+			Msg("[BroadcastCrossLink] retrying failed crosslink message")
+	})
+}
+
+// defaultCrossLinkMaxMessageSize is the default size limit of a crosslink message, leaving
+// room under the p2p message size limit for the pubsub envelope.
+const defaultCrossLinkMaxMessageSize = p2p.MaxMessageSize - 4096
+
+// crossLinkMaxMessageSize returns the size limit of a crosslink message.
+func (node *Node) crossLinkMaxMessageSize() int {
+	if n := node.NodeConfig.Handler.CrossLinkMaxMessageSize; n > 0 {
+		return n
+	}
+	return defaultCrossLinkMaxMessageSize
+}
+
+// crossLinkChunk is a crosslink message of some of the headers of a broadcast.
+type crossLinkChunk struct {
+	headers []*block.Header
+	msg     []byte
+}
+
+// crossLinkChunks splits the crosslinks of headers into consecutive messages of at most
+// maxSize bytes. A header whose crosslink alone exceeds maxSize is sent on its own.
+// The message sizes are computed from the encoded size of each crosslink, so that each
+// message is encoded once.
+func crossLinkChunks(bc engine.ChainReader, headers []*block.Header, maxSize int) []crossLinkChunk {
+	// the message size without the crosslinks list
+	base := uint64(len(p2p.ConstructMessage(proto_node.ConstructCrossLinkMessage(bc, nil)))) - rlp.ListSize(0)
+	sizes := make([]uint64, len(headers))
+	for i, header := range headers {
+		if cl := proto_node.CrossLinkOf(bc, header); cl != nil {
+			data, _ := rlp.EncodeToBytes(cl)
+			sizes[i] = uint64(len(data))
+		}
+	}
+	var chunks []crossLinkChunk
+	start := 0
+	for start < len(headers) {
+		content := sizes[start]
+		end := start + 1
+		for ; end < len(headers); end++ {
+			if base+rlp.ListSize(content+sizes[end]) > uint64(maxSize) {
+				break
+			}
+			content += sizes[end]
+		}
+		chunks = append(chunks, crossLinkChunk{
+			headers: headers[start:end],
+			msg:     p2p.ConstructMessage(proto_node.ConstructCrossLinkMessage(bc, headers[start:end])),
+		})
+		start = end
+	}
+	return chunks
+}
+
+// BroadcastSingleCrosslink broadcasts to the beacon chain the crosslink of the given block only,
+// to recover a single crosslink missing on the beacon chain.
+func (node *Node) BroadcastSingleCrosslink(shardID uint32, blockNum uint64) error {
+	if node.IsRunningBeaconChain() {
+		return errors.New("beacon chain does not send crosslinks")
+	}
+	if shardID != node.Blockchain().ShardID() {
+		return errors.Errorf("node runs shard %d, not %d", node.Blockchain().ShardID(), shardID)
+	}
+	header := node.Blockchain().GetHeaderByNumber(blockNum)
+	if header == nil {
+		return errors.Errorf("block %d not found", blockNum)
+	}
+	// the first block and blocks before the crosslink epoch have no crosslink
+	if blockNum <= 1 || !node.Blockchain().Config().IsCrossLink(header.Epoch()) {
+		return errors.Errorf("block %d is not crosslink eligible", blockNum)
+	}
+
+	utils.Logger().Info().
+		Uint32("shardID", shardID).
+		Uint64("blockNum", blockNum).
+		Msg("[BroadcastSingleCrosslink] broadcasting crosslink of a single block")
+	msg := p2p.ConstructMessage(
+		proto_node.ConstructCrossLinkMessage(node.Consensus.Blockchain(), []*block.Header{header}))
+	return node.sendToGroups(
+		[]nodeconfig.GroupID{nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID)},
+		msg,
+	)
+}
+
+// Reasons for not broadcasting crosslinks to the beacon chain.
+const (
+	skipCrosslinkBeaconChain   = "running beacon chain"
+	skipCrosslinkWarmingUp     = "warming up"
+	skipCrosslinkNotSampled    = "not leader and not sampled"
+	skipCrosslinkNoBlock       = "no current block"
+	skipCrosslinkNotCrossLink  = "not crosslink epoch"
+	skipCrosslinkNoCrosslinks  = "no crosslinks to broadcast"
+	skipCrosslinkHeadersFailed = "failed to get crosslinks"
+)
+
+// shouldBroadcastCrosslink returns the reasons for not broadcasting crosslinks of curBlock
+// now, and whether the broadcast is forced because the node has not broadcast for too long.
+// sampled tells whether a non-leader node was picked to broadcast.
+func (node *Node) shouldBroadcastCrosslink(curBlock *types.Block, now time.Time, sampled bool) ([]string, bool) {
+	var reasons []string
+	role := node.broadcastRole()
+	if role.IsRunningBeaconChain() {
+		reasons = append(reasons, skipCrosslinkBeaconChain)
+	}
+	if node.crossLinkWarmingUp(now) {
+		reasons = append(reasons, skipCrosslinkWarmingUp)
+	}
+	forced := false
+	if !(role.IsCurrentlyLeader() || sampled) {
+		if node.crossLinkBroadcastStarved(now) {
+			forced = true
+		} else {
+			reasons = append(reasons, skipCrosslinkNotSampled)
+		}
+	}
+	if curBlock == nil {
+		reasons = append(reasons, skipCrosslinkNoBlock)
+	} else if !node.Blockchain().Config().IsCrossLink(curBlock.Epoch()) {
+		// no need to broadcast crosslink if it's not crosslink epoch
+		reasons = append(reasons, skipCrosslinkNotCrossLink)
+	}
+	return reasons, forced
+}
+
+// selectCrosslinkBroadcast returns the headers of the crosslinks to broadcast for curBlock
+// and the group they are broadcast to.
+func (node *Node) selectCrosslinkBroadcast(curBlock *types.Block) ([]*block.Header, nodeconfig.GroupID, error) {
+	ctx, cancel := node.crossLinkHeaderFetchContext()
+	defer cancel()
+	headers, err := getCrosslinkHeadersForShards(
+		ctx, node.Blockchain(), curBlock, node.crosslinks, node.NodeConfig.Handler,
+	)
+	return headers, nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID), err
+}
+
+// CrosslinkBroadcastReport describes the crosslink broadcast the node would make now.
+type CrosslinkBroadcastReport struct {
+	Headers     []*block.Header
+	Group       nodeconfig.GroupID
+	BatchSize   int
+	Forced      bool
+	SkipReasons []string
+}
+
+// ValidateCrosslinkBroadcast is a dry run of BroadcastCrossLinkFromShardsToBeacon: it runs
+// the crosslink broadcast gating and selection and reports what would be broadcast to the
+// beacon chain and to which group, without sending anything nor updating the crosslink state.
+// Non-leaders are reported as not sampled, the headers are selected regardless.
+func (node *Node) ValidateCrosslinkBroadcast() CrosslinkBroadcastReport {
+	curBlock := node.Blockchain().CurrentBlock()
+	skipReasons, forced := node.shouldBroadcastCrosslink(curBlock, time.Now(), false)
+	report := CrosslinkBroadcastReport{Forced: forced, SkipReasons: skipReasons}
+	if curBlock == nil || node.broadcastRole().IsRunningBeaconChain() {
+		return report
+	}
+
+	headers, group, err := node.selectCrosslinkBroadcast(curBlock)
+	report.Group = group
+	if err != nil {
+		report.SkipReasons = append(report.SkipReasons, skipCrosslinkHeadersFailed)
+		return report
+	}
+	if len(headers) == 0 {
+		report.SkipReasons = append(report.SkipReasons, skipCrosslinkNoCrosslinks)
+	}
+	report.Headers = headers
+	report.BatchSize = len(headers)
+	tipNum, ok := crossLinkTipNum(curBlock.NumberU64(), node.NodeConfig.Handler.CrossLinkConfirmationDepth)
+	if signalBlock, signaled := crosslinkSignalBlockNum(node.crosslinks, curBlock.ShardID()); ok && signaled {
+		_, report.BatchSize = crosslinkBatchRange(
+			tipNum, node.crosslinks.LatestSentCrosslinkBlockNumber(), signalBlock,
+			node.NodeConfig.Handler,
+		)
+	}
+	return report
+}
+
+// crossLinkWarmingUp returns true within the configured warm-up period after startup
+// unless a heartbeat or an acknowledgement from the beacon chain was received.
+func (node *Node) crossLinkWarmingUp(now time.Time) bool {
+	warmUp := node.NodeConfig.Handler.CrossLinkWarmUp
+	if warmUp <= 0 || now.Sub(time.Unix(node.unixTimeAtNodeStart, 0)) >= warmUp {
+		return false
+	}
+	return node.crosslinks.LastKnownCrosslinkHeartbeatSignal() == nil &&
+		node.crosslinks.LatestAcceptedCrosslinkBlockNumber() == 0
+}
+
+// crossLinkBroadcastStarved returns true if the node has not broadcast a crosslink,
+// or has not since it started, for longer than the configured starvation threshold.
+func (node *Node) crossLinkBroadcastStarved(now time.Time) bool {
+	threshold := node.NodeConfig.Handler.CrossLinkStarvationThreshold
+	if threshold <= 0 {
+		return false
+	}
+	last := node.crosslinks.LastSentAt()
+	if last.IsZero() {
+		last = time.Unix(node.unixTimeAtNodeStart, 0)
+	}
+	return now.Sub(last) >= threshold
+}
+
+// groupMessage is a message for a multicast group.
+type groupMessage struct {
+	group nodeconfig.GroupID
+	msg   []byte
+}
+
+// heartbeatMessages returns the heartbeat messages signed by privToSign of the shards
+// which have a crosslink on the beacon chain, each for the group of its shard.
+func (node *Node) heartbeatMessages(beacon core.BlockChain, shardIDs []uint32, privToSign *bls.PrivateKeyWrapper) []groupMessage {
+	var msgs []groupMessage
+	for _, shardID := range shardIDs {
+		// the last crosslinks of the shards are kept by the beacon chain
+		lastLink, err := beacon.ReadShardLastCrossLink(shardID)
+		if (err == nil && lastLink == nil) || errors.Is(err, core.ErrCrosslinkNotFound) {
+			nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "heartbeat_no_crosslink"}).Inc()
+			utils.Logger().Debug().
+				Uint32("shardID", shardID).
+				Msg("[BroadcastCrossLinkSignal] shard has no crosslink yet")
+			continue
+		} else if err != nil {
+			utils.Logger().Error().Err(err).Uint32("shardID", shardID).Msg("[BroadcastCrossLinkSignal] failed to get crosslinks")
+			continue
+		}
+		hb := types.CrosslinkHeartbeat{
+			ShardID:                  lastLink.ShardID(),
+			LatestContinuousBlockNum: lastLink.BlockNum(),
+			Epoch:                    lastLink.Epoch().Uint64(),
+			PublicKey:                privToSign.Pub.Bytes[:],
+			Signature:                nil,
+		}
+
+		rs, err := rlp.EncodeToBytes(hb)
+		if err != nil {
+			utils.Logger().Error().Err(err).Msg("[BroadcastCrossLinkSignal] failed to encode signal")
+			continue
+		}
+		hb.Signature = privToSign.Pri.SignHash(rs).Serialize()
+		msgs = append(msgs, groupMessage{
+			group: nodeconfig.NewGroupIDByShardID(nodeconfig.ShardID(shardID)),
+			msg:   p2p.ConstructMessage(proto_node.ConstructCrossLinkHeartBeatMessage(hb)),
+		})
+	}
+	return msgs
+}
+
+// sendHeartbeats sends each of the heartbeat messages msgs to its group. Each heartbeat
+// is signed for its shard, so they can't be merged into a single message.
+func (node *Node) sendHeartbeats(msgs []groupMessage) {
+	for _, m := range msgs {
+		if err := node.sendToGroups([]nodeconfig.GroupID{m.group}, m.msg); err != nil {
+			utils.Logger().Warn().Err(err).Str("group", string(m.group)).
+				Msg("[BroadcastCrossLinkSignal] failed to send heartbeat")
+		}
+	}
+}
+
+// BroadcastCrosslinkHeartbeatSignalFromBeaconToShards is called by consensus leader or 1% validators to
+// send last cross link to shard chains.
+func (node *Node) BroadcastCrosslinkHeartbeatSignalFromBeaconToShards() { // leader of 0 shard
+	if !node.takesPartInHeartbeat() {
+		return
+	}
+	node.broadcastHeartbeats(node.Beaconchain())
+}
+
+// takesPartInHeartbeat returns true if the node broadcasts heartbeats in the current round,
+// as the beacon chain leader or as a sampled beacon chain validator.
+func (node *Node) takesPartInHeartbeat() bool {
+	role := node.broadcastRole()
+	if !role.IsRunningBeaconChain() {
+		return false
+	}
+	percent := samplePercent(node.NodeConfig.Handler.HeartbeatSamplePercent, defaultHeartbeatSamplePercent)
+	return node.takesPartInBroadcast(role.IsCurrentlyLeader(), percent)
+}
+
+// broadcastHeartbeats sends the heartbeats of the last crosslinks on the beacon chain to the shards.
+func (node *Node) broadcastHeartbeats(beacon core.BlockChain) {
+	curBlock := beacon.CurrentBlock()
+	if curBlock == nil {
+		return
+	}
+
+	if !beacon.Config().IsCrossLink(curBlock.Epoch()) {
+		// no need to broadcast crosslink if it's beacon chain, or it's not crosslink epoch
+		return
+	}
+
+	privKeys := node.Consensus.GetPrivateKeys()
+	if len(privKeys) == 0 {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "heartbeat_no_private_key"}).Inc()
+		utils.Logger().Debug().Msg("[BroadcastCrossLinkSignal] no private keys to sign heartbeat")
+		return
+	}
+	var privToSign *bls.PrivateKeyWrapper
+	for _, priv := range privKeys {
+		if node.Consensus.IsValidatorInCommittee(priv.Pub.Bytes) {
+			privToSign = &priv
+			break
+		}
+	}
+
+	if privToSign == nil {
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "heartbeat_no_committee_key"}).Inc()
+		utils.Logger().Debug().
+			Int("numKeys", len(privKeys)).
+			Msg("[BroadcastCrossLinkSignal] none of the private keys is in the beacon committee")
+		return
+	}
+	utils.Logger().Debug().
+		Str("signer", privToSign.Pub.Bytes.Hex()).
+		Msg("[BroadcastCrossLinkSignal] signing heartbeat")
+	instance := shard.Schedule.InstanceForEpoch(curBlock.Epoch())
+	shardIDs, next := heartbeatShards(
+		instance.NumShards(), atomic.LoadUint32(&node.heartbeatShardCursor), node.NodeConfig.Handler.HeartbeatShardsPerRound,
+	)
+	atomic.StoreUint32(&node.heartbeatShardCursor, next)
+	node.sendHeartbeats(node.heartbeatMessages(beacon, shardIDs, privToSign))
+
+	if node.NodeConfig.Handler.CrossLinkAcks {
+		node.broadcastCrossLinkAcks(beacon, curBlock)
+	}
+}
+
+// heartbeatShards returns the non-beacon shards a crosslink heartbeat broadcast covers,
+// starting from cursor, and the cursor of the next broadcast. A non-positive perRound
+// covers all shards.
+func heartbeatShards(numShards uint32, cursor uint32, perRound int) ([]uint32, uint32) {
+	if numShards <= 1 {
+		return nil, 0
+	}
+	total := numShards - 1
+	if perRound <= 0 || uint32(perRound) >= total {
+		perRound = int(total)
+	}
+	cursor %= total
+	shardIDs := make([]uint32, 0, perRound)
+	for i := 0; i < perRound; i++ {
+		shardIDs = append(shardIDs, 1+(cursor+uint32(i))%total)
+	}
+	return shardIDs, (cursor + uint32(perRound)) % total
+}
+
+// broadcastCrossLinkAcks sends to each shard an acknowledgement of the crosslinks
+// included in the given committed beacon block, proven by its commit signature.
+func (node *Node) broadcastCrossLinkAcks(beacon core.BlockChain, beaconBlock *types.Block) {
+	crossLinks := types.CrossLinks{}
+	if err := rlp.DecodeBytes(beaconBlock.Header().CrossLinks(), &crossLinks); err != nil || len(crossLinks) == 0 {
+		return
+	}
+	commitSig, err := beacon.ReadCommitSig(beaconBlock.NumberU64())
+	if err != nil {
+		utils.Logger().Warn().Err(err).
+			Uint64("blockNum", beaconBlock.NumberU64()).
+			Msg("[BroadcastCrossLinkAck] commit signature not available")
+		return
+	}
+
+	acked := map[uint32]uint64{}
+	for _, cl := range crossLinks {
+		if cl.BlockNum() > acked[cl.ShardID()] {
+			acked[cl.ShardID()] = cl.BlockNum()
+		}
+	}
+
+	for shardID, blockNum := range acked {
+		ack := types.CrosslinkAck{
+			ShardID:      shardID,
+			BlockNum:     blockNum,
+			BeaconHeader: beaconBlock.Header(),
+			CommitSig:    commitSig,
+		}
+		if err := node.sendToGroups(
+			[]nodeconfig.GroupID{nodeconfig.NewGroupIDByShardID(nodeconfig.ShardID(shardID))},
+			p2p.ConstructMessage(proto_node.ConstructCrossLinkAckMessage(ack)),
+		); err != nil {
+			utils.Logger().Warn().Err(err).Uint32("shardID", shardID).Msg("[BroadcastCrossLinkAck] failed to send ack")
+		}
+	}
+}
+
+// crossLinkHeaderFetchContext returns the context bounding the crosslink header reads.
+func (node *Node) crossLinkHeaderFetchContext() (context.Context, context.CancelFunc) {
+	if timeout := node.NodeConfig.Handler.CrossLinkHeaderFetchTimeout; timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+var (
+	errCrossLinkChainConfig = errors.New("shard chain config not available")
+	errCrossLinkHeaderRead  = errors.New("cannot read crosslink header")
+)
+
+// getCrosslinkHeadersForShards get headers required for crosslink creation.
+// Blocks with less than the configured confirmations on top of them are left out,
+// as well as blocks older than the configured maximum age. No headers and no error
+// means there is nothing to crosslink, an error that the shard chain could not be read.
+func getCrosslinkHeadersForShards(
+	ctx context.Context, shardChain core.BlockChain, curBlock *types.Block,
+	crosslinks *crosslinks.Crosslinks, conf nodeconfig.HandlerConfig,
+) ([]*block.Header, error) {
+	var headers []*block.Header
+	depth := conf.CrossLinkConfirmationDepth
+	tipNum, ok := crossLinkTipNum(curBlock.NumberU64(), depth)
+	if !ok {
+		return nil, nil
+	}
+	if shardChain.Config() == nil {
+		return nil, errCrossLinkChainConfig
+	}
+	oldest := crossLinkOldestBlockNum(curBlock.NumberU64(), conf.CrossLinkMaxHeaderAge)
+	latestBlockNum, ok := crosslinkSignalBlockNum(crosslinks, curBlock.ShardID())
+	if !ok {
+		utils.Logger().Debug().Msg("[BroadcastCrossLink] no known crosslink heartbeat signal")
+		header := shardChain.GetHeaderByNumber(tipNum - 2)
+		if header != nil && header.Number().Uint64() >= oldest && shardChain.Config().IsCrossLink(header.Epoch()) {
+			headers = append(headers, header)
+		}
+		header = shardChain.GetHeaderByNumber(tipNum - 1)
+		if header != nil && header.Number().Uint64() >= oldest && shardChain.Config().IsCrossLink(header.Epoch()) {
+			headers = append(headers, header)
+		}
+		if depth == 0 {
+			return append(headers, curBlock.Header()), nil
+		}
+		if header = shardChain.GetHeaderByNumber(tipNum); header == nil {
+			return nil, errors.WithMessagef(errCrossLinkHeaderRead, "block %d of shard %d", tipNum, curBlock.ShardID())
+		} else if header.Number().Uint64() >= oldest {
+			headers = append(headers, header)
+		}
+		return headers, nil
+	}
+	latestBlockNum, batchSize := crosslinkBatchRange(
+		tipNum, crosslinks.LatestSentCrosslinkBlockNumber(), latestBlockNum, conf,
+	)
+	first := latestBlockNum + 1
+	if first < oldest {
+		// the beacon chain rejects the crosslinks of the blocks in between, skip to the
+		// oldest block still accepted
+		nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "header_too_old"}).Add(float64(oldest - first))
+		utils.Logger().Debug().
+			Uint64("from", first).
+			Uint64("to", oldest-1).
+			Msg("[BroadcastCrossLink] skipping crosslinks of blocks over the maximum age")
+		first = oldest
+	}
+
+	headers = fetchCrossLinkHeaders(
+		ctx, shardChain, first, tipNum, batchSize, conf.CrossLinkHeaderFetchWorkers,
+	)
+	// an empty selection is healthy if the blocks are not eligible for a crosslink,
+	// not if the blocks can't be read
+	if len(headers) == 0 && first <= tipNum && ctx.Err() == nil && shardChain.GetHeaderByNumber(first) == nil {
+		return nil, errors.WithMessagef(errCrossLinkHeaderRead, "block %d of shard %d", first, curBlock.ShardID())
+	}
+	return headers, nil
+}
+
+// crossLinkOldestBlockNum returns the number of the oldest block whose crosslink is sent
+// at block curBlockNum, given the maximum age in blocks of a crosslink. Zero means no limit.
+func crossLinkOldestBlockNum(curBlockNum, maxAge uint64) uint64 {
+	if maxAge == 0 || maxAge >= curBlockNum {
+		return 0
+	}
+	return curBlockNum - maxAge
+}
+
+// defaultCrossLinkHeaderFetchWorkers is the default number of crosslink headers fetched concurrently.
+const defaultCrossLinkHeaderFetchWorkers = 4
+
+// fetchCrossLinkHeaders returns in order the headers of the blocks from first to last which
+// can be crosslinked, up to batchSize of them. The headers are fetched by up to workers
+// goroutines, the number still missing at a time, so that few are fetched needlessly.
+func fetchCrossLinkHeaders(
+	ctx context.Context, shardChain core.BlockChain, first, last uint64, batchSize, workers int,
+) []*block.Header {
+	if workers <= 0 {
+		workers = defaultCrossLinkHeaderFetchWorkers
+	}
+	var headers []*block.Header
+	for start := first; start <= last && len(headers) < batchSize; {
+		n := uint64(batchSize - len(headers))
+		if n > last-start+1 {
+			n = last - start + 1
+		}
+		window := make([]*block.Header, n)
+		fetched := make([]bool, n)
+		fetchHeaderWindow(ctx, shardChain, start, window, fetched, workers)
+		for i, header := range window {
+			if !fetched[i] {
+				nodeCrossLinkMessageCounterVec.With(prometheus.Labels{"type": "header_fetch_timeout"}).Inc()
+				utils.Logger().Warn().
+					Int("headers", len(headers)).
+					Uint64("blockNum", start+uint64(i)).
+					Msg("[BroadcastCrossLink] timed out fetching crosslink headers")
+				return headers
+			}
+			if header != nil && shardChain.Config().IsCrossLink(header.Epoch()) {
+				headers = append(headers, header)
+			}
+		}
+		start += n
+	}
+	return headers
+}
+
+// fetchHeaderWindow fetches the headers of the blocks from start on into window, marking
+// those fetched. It returns once ctx is done with the headers fetched so far, without
+// waiting for the fetches still in flight. The workers are not counted by goSpawn, they
+// are bounded by workers and do not outlive their last fetch.
+func fetchHeaderWindow(
+	ctx context.Context, shardChain core.BlockChain, start uint64, window []*block.Header, fetched []bool, workers int,
+) {
+	type result struct {
+		i      int
+		header *block.Header
+	}
+	// buffered so that the fetches left in flight never block
+	results := make(chan result, len(window))
+	next := make(chan int, len(window))
+	for i := range window {
+		next <- i
+	}
+	close(next)
+	for w := 0; w < workers && w < len(window); w++ {
+		go func() {
+			for i := range next {
+				if ctx.Err() != nil {
+					return
+				}
+				results <- result{i, shardChain.GetHeaderByNumber(start + uint64(i))}
+			}
+		}()
+	}
+	for range window {
+		select {
+		case <-ctx.Done():
+			return
+		case r := <-results:
+			window[r.i], fetched[r.i] = r.header, true
+		}
+	}
+}
+
+// crosslinkSignalBlockNum returns the latest block number of shardID known to be crosslinked
+// on the beacon chain, from the shard's heartbeat signal or acknowledgements, and false if
+// none is known.
+func crosslinkSignalBlockNum(crosslinks *crosslinks.Crosslinks, shardID uint32) (uint64, bool) {
+	signal := crosslinks.LastKnownShardCrosslinkHeartbeatSignal(shardID)
+	accepted := crosslinks.LatestAcceptedCrosslinkBlockNumber()
+	if signal == nil && accepted == 0 {
+		return 0, false
+	}
+	var latestBlockNum uint64
+	if signal != nil {
+		latestBlockNum = signal.LatestContinuousBlockNum
+	}
+	// crosslinks acknowledged by the beacon chain need not be sent again
+	if accepted > latestBlockNum {
+		latestBlockNum = accepted
+	}
+	return latestBlockNum, true
+}
+
+// crossLinkTipNum returns the newest block number eligible for a crosslink at the given
+// current block number, that is with depth confirmations on top of it, and false if no
+// block has that many confirmations yet.
+func crossLinkTipNum(curBlockNum, depth uint64) (uint64, bool) {
+	if depth > curBlockNum {
+		return 0, false
+	}
+	return curBlockNum - depth, true
+}
+
+// crosslinkBatchRange returns the block number after which crosslinks are selected
+// and the number of crosslinks to select, given the newest eligible block number, the latest
+// sent crosslink block number and the latest block number known to the beacon chain.
+// The batch is empty when no eligible block is newer than the latest known one, and its
+// size only grows with the backlog in the adaptive mode. The tunables not set
+// in conf, as in the zero config, take the defaults of nodeconfig.DefaultHandlerConfig.
+func crosslinkBatchRange(tipNum, lastSent, signalBlock uint64, conf nodeconfig.HandlerConfig) (uint64, int) {
+	size, capMultiplier := nodeconfig.DefaultCrossLinkBatchSize, nodeconfig.DefaultCrossLinkBatchCapMultiplier
+	sentWindow, growthDivisor := nodeconfig.DefaultCrossLinkSentWindowMultiplier, nodeconfig.DefaultCrossLinkBatchGrowthDivisor
+	if conf.CrossLinkBatchSize > 0 {
+		size = conf.CrossLinkBatchSize
+	}
+	if conf.CrossLinkBatchCapMultiplier > 0 {
+		capMultiplier = conf.CrossLinkBatchCapMultiplier
+	}
+	if conf.CrossLinkSentWindowMultiplier > 0 {
+		sentWindow = conf.CrossLinkSentWindowMultiplier
+	}
+	if conf.CrossLinkBatchGrowthDivisor > 0 {
+		growthDivisor = conf.CrossLinkBatchGrowthDivisor
+	}
+
+	latestBlockNum := signalBlock
+	if lastSent > latestBlockNum && lastSent <= latestBlockNum+uint64(size*sentWindow) {
+		latestBlockNum = lastSent
+	}
+	if latestBlockNum >= tipNum {
+		// nothing eligible the beacon chain does not know yet
+		return latestBlockNum, 0
+	}
+
+	batchSize := size
+	if conf.CrossLinkBatchMode == nodeconfig.CrossLinkBatchSteady {
+		return latestBlockNum, batchSize
+	}
+	diff := tipNum - latestBlockNum
+
+	// Increase batch size by 1 for every growthDivisor blocks behind
+	batchSize += int(diff) / growthDivisor
+
+	// Cap at a sane size to avoid overload network
+	if batchSize > size*capMultiplier {
+		batchSize = size * capMultiplier
+	}
+	return latestBlockNum, batchSize
+}
+
+// CrosslinkBatchSimulation is the result of a simulated crosslink batch selection.
+type CrosslinkBatchSimulation struct {
+	BlockNums []uint64
+	BatchSize int
+}
+
+// SimulateCrosslinkBatch returns the block numbers which would be selected for a crosslink
+// broadcast in the given state, assuming every block with the configured confirmations is
+// eligible for a crosslink. It does not read the chain.
+func (node *Node) SimulateCrosslinkBatch(curBlockNum uint64, lastSent uint64, signalBlock uint64) CrosslinkBatchSimulation {
+	tipNum, ok := crossLinkTipNum(curBlockNum, node.NodeConfig.Handler.CrossLinkConfirmationDepth)
+	if !ok {
+		return CrosslinkBatchSimulation{}
+	}
+	latestBlockNum, batchSize := crosslinkBatchRange(tipNum, lastSent, signalBlock, node.NodeConfig.Handler)
+	res := CrosslinkBatchSimulation{BatchSize: batchSize}
+	first := max(latestBlockNum+1, crossLinkOldestBlockNum(curBlockNum, node.NodeConfig.Handler.CrossLinkMaxHeaderAge))
+	for blockNum := first; blockNum <= tipNum && len(res.BlockNums) < batchSize; blockNum++ {
+		res.BlockNums = append(res.BlockNums, blockNum)
+	}
+	return res
+}
@@ -0,0 +1,579 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	ffi_bls "github.com/harmony-one/bls/ffi/go/bls"
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	"github.com/harmony-one/harmony/block"
+	blockfactory "github.com/harmony-one/harmony/block/factory"
+	"github.com/harmony-one/harmony/core/types"
+	"github.com/harmony-one/harmony/crypto/bls"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/registry"
+	"github.com/harmony-one/harmony/internal/utils/crosslinks"
+	"github.com/harmony-one/harmony/p2p"
+	"github.com/harmony-one/harmony/shard"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestCrossLink(shardID uint32, num int64) *types.CrossLink {
+	parent := blockfactory.NewTestHeader().With().ShardID(shardID).Number(big.NewInt(num)).Header()
+	header := blockfactory.NewTestHeader().With().ShardID(shardID).Number(big.NewInt(num + 1)).
+		ParentHash(parent.Hash()).Header()
+	return types.NewCrossLink(header, parent)
+}
+
+func TestIsFutureCrossLink(t *testing.T) {
+	lastLink := newTestCrossLink(1, 100)
+
+	if isFutureCrossLink(*newTestCrossLink(1, 110), lastLink, 20) {
+		t.Error("crosslink within tolerance rejected")
+	}
+	if isFutureCrossLink(*newTestCrossLink(1, 120), lastLink, 20) {
+		t.Error("crosslink at tolerance rejected")
+	}
+	if !isFutureCrossLink(*newTestCrossLink(1, 1000000), lastLink, 20) {
+		t.Error("far future crosslink accepted")
+	}
+	if isFutureCrossLink(*newTestCrossLink(1, 1000000), nil, 20) {
+		t.Error("crosslink rejected without a known last crosslink")
+	}
+}
+
+func TestCrosslinkCatchupProgress(t *testing.T) {
+	node := &Node{}
+	node.crosslinkCatchup.update(99, 100, 101)
+	if p := node.CrosslinkCatchupProgress(); p.Active {
+		t.Fatalf("catch-up started while not behind: %+v", p)
+	}
+
+	node.crosslinkCatchup.update(1, 6, 101)
+	p := node.CrosslinkCatchupProgress()
+	if !p.Active || p.StartBlock != 0 || p.CurrentBlock != 6 || p.TargetBlock != 101 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+
+	node.crosslinkCatchup.update(7, 52, 102)
+	if p := node.CrosslinkCatchupProgress(); !p.Active || p.Percent < 50 || p.Percent > 51 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+
+	node.crosslinkCatchup.update(53, 100, 103)
+	if p := node.CrosslinkCatchupProgress(); p.Active || p.Percent != 100 {
+		t.Fatalf("catch-up not completed: %+v", p)
+	}
+}
+
+func TestCrossLinkRateLimiter(t *testing.T) {
+	var l crossLinkRateLimiter[string]
+	now := time.Unix(1000, 0)
+
+	if !l.allow("a", 3, 1, 3, now) {
+		t.Fatal("burst of crosslinks rejected")
+	}
+	if l.allow("a", 1, 1, 3, now) {
+		t.Error("crosslink above the rate accepted")
+	}
+	if !l.allow("b", 1, 1, 3, now) {
+		t.Error("crosslink of another peer rejected")
+	}
+	if !l.allow("a", 1, 1, 3, now.Add(time.Second)) {
+		t.Error("crosslink rejected after the rate allows it")
+	}
+	if !l.allow("c", 10, 1, 3, now) {
+		t.Error("message larger than the burst never accepted")
+	}
+}
+
+func TestRateLimitCrossLinksPerPeer(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.CrossLinkRateLimit = 1
+	node.NodeConfig.Handler.CrossLinkRateBurst = 2
+	crosslinks := []types.CrossLink{*newTestCrossLink(1, 10), *newTestCrossLink(1, 11)}
+
+	if kept := node.rateLimitCrossLinks("spammer", crosslinks); len(kept) != 2 {
+		t.Fatalf("expected the burst accepted, got %d crosslinks", len(kept))
+	}
+	if kept := node.rateLimitCrossLinks("spammer", crosslinks); len(kept) != 0 {
+		t.Errorf("expected the crosslinks above the rate dropped, got %d", len(kept))
+	}
+	// crosslinks claiming the same shard from another peer are not starved by the spammer
+	if kept := node.rateLimitCrossLinks("leader", crosslinks); len(kept) != 2 {
+		t.Errorf("expected the crosslinks of another peer accepted, got %d", len(kept))
+	}
+	if kept := node.rateLimitCrossLinks("", crosslinks); len(kept) != 2 {
+		t.Errorf("expected the own crosslinks not limited, got %d", len(kept))
+	}
+}
+
+func TestAllowVerifiedCrossLinkPerShard(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.CrossLinkRateLimit = 1
+	node.NodeConfig.Handler.CrossLinkRateBurst = 2
+
+	// the shard limit applies across the peers relaying the crosslinks of the shard
+	if !node.allowVerifiedCrossLink("a", 1) || !node.allowVerifiedCrossLink("b", 1) {
+		t.Fatal("expected the burst of shard 1 accepted")
+	}
+	if node.allowVerifiedCrossLink("c", 1) {
+		t.Error("expected the crosslink of shard 1 above the rate dropped")
+	}
+	if !node.allowVerifiedCrossLink("a", 2) {
+		t.Error("expected the crosslink of another shard accepted")
+	}
+	if !node.allowVerifiedCrossLink("", 1) {
+		t.Error("expected the own crosslinks not limited")
+	}
+}
+
+func TestDecodeCrossLinkMessage(t *testing.T) {
+	empty, err := rlp.EncodeToBytes([]types.CrossLink{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decodeCrossLinkMessage(empty); err != errEmptyCrossLinkMessage {
+		t.Errorf("expected empty crosslink message error, got %v", err)
+	}
+
+	payload, err := rlp.EncodeToBytes([]types.CrossLink{*newTestCrossLink(1, 10)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crosslinks, err := decodeCrossLinkMessage(payload)
+	if err != nil || len(crosslinks) != 1 {
+		t.Errorf("expected 1 crosslink, got %d, %v", len(crosslinks), err)
+	}
+
+	if _, err := decodeCrossLinkMessage([]byte{0xff}); err == nil {
+		t.Error("expected decode error for garbage")
+	}
+}
+
+func TestCrossLinkContinuity(t *testing.T) {
+	last := newTestCrossLink(1, 10)
+	sequence := &crossLinkSequence{
+		next:    make(map[uint32]uint64),
+		pending: []types.CrossLink{*newTestCrossLink(1, 11)},
+		last: func(shardID uint32) (*types.CrossLink, error) {
+			if shardID != 1 {
+				return nil, errors.New("no crosslink")
+			}
+			return last, nil
+		},
+	}
+	if _, ok := sequence.expected(2); ok {
+		t.Error("expected no sequence for a shard without crosslinks")
+	}
+	next, ok := sequence.expected(1)
+	if !ok || next != 12 {
+		t.Fatalf("expected next crosslink 12, got %d", next)
+	}
+
+	if err := checkCrossLinkContinuity(*newTestCrossLink(1, 12), next); err != nil {
+		t.Errorf("expected crosslink 12 to be accepted, got %v", err)
+	}
+	if err := checkCrossLinkContinuity(*newTestCrossLink(1, 14), next); err != errCrossLinkGap {
+		t.Errorf("expected gap, got %v", err)
+	}
+	if err := checkCrossLinkContinuity(*newTestCrossLink(1, 11), next); err != errCrossLinkOverlap {
+		t.Errorf("expected overlap, got %v", err)
+	}
+
+	sequence.accept(*newTestCrossLink(1, 12))
+	if next, _ := sequence.expected(1); next != 13 {
+		t.Errorf("expected next crosslink 13, got %d", next)
+	}
+}
+
+func TestCheckHeartbeatShard(t *testing.T) {
+	tests := []struct {
+		hbShard uint32
+		err     error
+	}{
+		{1, nil},
+		{2, errHeartbeatShard},
+		{0, errHeartbeatShard},
+	}
+	for i, test := range tests {
+		hb := types.CrosslinkHeartbeat{ShardID: test.hbShard}
+		if err := checkHeartbeatShard(hb, 1, 4); err != test.err {
+			t.Errorf("test %d: expected %v, got %v", i, test.err, err)
+		}
+	}
+	if err := checkHeartbeatShard(types.CrosslinkHeartbeat{ShardID: 5}, 5, 4); err != errHeartbeatShard {
+		t.Errorf("expected heartbeat for a shard out of range to be rejected, got %v", err)
+	}
+}
+
+func TestIsReplayedCrossLinkMessage(t *testing.T) {
+	lastLinks := map[uint32]*types.CrossLink{
+		1: newTestCrossLink(1, 100),
+		2: newTestCrossLink(2, 50),
+	}
+	last := func(shardID uint32) (*types.CrossLink, error) {
+		if cl, ok := lastLinks[shardID]; ok {
+			return cl, nil
+		}
+		return nil, errors.New("no crosslink")
+	}
+
+	replayed := []types.CrossLink{*newTestCrossLink(1, 99), *newTestCrossLink(1, 100), *newTestCrossLink(2, 50)}
+	if !isReplayedCrossLinkMessage(replayed, last) {
+		t.Error("expected already accepted crosslinks to be detected as replay")
+	}
+	fresh := append(replayed, *newTestCrossLink(2, 51))
+	if isReplayedCrossLinkMessage(fresh, last) {
+		t.Error("expected message with a new crosslink not to be a replay")
+	}
+	if isReplayedCrossLinkMessage([]types.CrossLink{*newTestCrossLink(3, 1)}, last) {
+		t.Error("expected crosslink of a shard without crosslinks not to be a replay")
+	}
+}
+
+func TestLastCrosslinkRecipients(t *testing.T) {
+	node := &Node{}
+	if r := node.LastCrosslinkRecipients(); r.Group != "" || len(r.Peers) != 0 {
+		t.Fatalf("expected no recipients, got %+v", r)
+	}
+
+	host := &groupPeersHost{peers: map[string][]libp2p_peer.ID{"beacon": {"a", "b"}}}
+	sentAt := time.Unix(1000, 0)
+	node.lastCrosslinkRecipients.record(host, "beacon", 10, 12, sentAt)
+
+	r := node.LastCrosslinkRecipients()
+	if r.Group != "beacon" || len(r.Peers) != 2 || r.FirstBlockNum != 10 || r.LastBlockNum != 12 || !r.SentAt.Equal(sentAt) {
+		t.Fatalf("unexpected recipients %+v", r)
+	}
+}
+
+func TestCrossLinkQuarantine(t *testing.T) {
+	var q crossLinkQuarantine
+	start := time.Unix(1000, 0)
+	const peer = libp2p_peer.ID("bad")
+
+	if q.recordInvalid(peer, start, 3, time.Minute, time.Hour) ||
+		q.recordInvalid(peer, start.Add(10*time.Second), 3, time.Minute, time.Hour) {
+		t.Fatal("peer quarantined below the threshold")
+	}
+	// the first failure is out of the window by now
+	if q.recordInvalid(peer, start.Add(70*time.Second), 3, time.Minute, time.Hour) {
+		t.Fatal("peer quarantined for failures outside the window")
+	}
+	if !q.recordInvalid(peer, start.Add(80*time.Second), 3, time.Minute, time.Hour) {
+		t.Fatal("peer not quarantined at the threshold")
+	}
+
+	now := start.Add(2 * time.Minute)
+	if !q.quarantined(peer, now) || q.quarantined("good", now) {
+		t.Error("unexpected quarantine state")
+	}
+	if list := q.list(now); len(list) != 1 {
+		t.Errorf("expected 1 quarantined peer, got %v", list)
+	}
+	if q.quarantined(peer, start.Add(80*time.Second+time.Hour)) {
+		t.Error("peer still quarantined after the cooldown")
+	}
+}
+
+func TestCheckEpochBlock(t *testing.T) {
+	newEpochBlock := func(shardID uint32, epoch int64, state *shard.State) *types.Block {
+		h := blockfactory.NewTestHeader().With().ShardID(shardID).Epoch(big.NewInt(epoch))
+		if state != nil {
+			data, err := shard.EncodeWrapper(*state, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h = h.ShardState(data)
+		}
+		return types.NewBlockWithHeader(h.Header())
+	}
+	valid := &shard.State{Epoch: big.NewInt(6)}
+
+	if err := checkEpochBlock(newEpochBlock(0, 5, valid), big.NewInt(4)); err != nil {
+		t.Fatalf("valid epoch block rejected: %v", err)
+	}
+	tests := []struct {
+		name  string
+		block *types.Block
+		want  error
+	}{
+		{"shard", newEpochBlock(1, 5, valid), errEpochBlockShard},
+		{"not last", newEpochBlock(0, 5, nil), errEpochBlockNotLast},
+		{"stale", newEpochBlock(0, 3, &shard.State{Epoch: big.NewInt(4)}), errEpochBlockStale},
+		// The signature may be valid, but the shard state must not be written for the wrong epoch.
+		{"shard state epoch", newEpochBlock(0, 5, &shard.State{Epoch: big.NewInt(7)}), errEpochBlockShardState},
+	}
+	for _, test := range tests {
+		if err := checkEpochBlock(test.block, big.NewInt(4)); err != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+
+	garbage := types.NewBlockWithHeader(blockfactory.NewTestHeader().With().
+		Epoch(big.NewInt(5)).ShardState([]byte{0x01, 0x02}).Header())
+	if err := checkEpochBlock(garbage, big.NewInt(4)); err == nil {
+		t.Error("epoch block with undecodable shard state accepted")
+	}
+}
+
+func TestCheckCrossLinkAck(t *testing.T) {
+	cl := newTestCrossLink(1, 99)
+	data, err := rlp.EncodeToBytes(types.CrossLinks{*cl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	beaconHeader := blockfactory.NewTestHeader().With().CrossLinks(data).Header()
+	ack := types.CrosslinkAck{ShardID: 1, BlockNum: cl.BlockNum(), BeaconHeader: beaconHeader}
+
+	if err := checkCrossLinkAck(ack, 100); err != nil {
+		t.Fatalf("valid crosslink ack rejected: %v", err)
+	}
+	ahead, missing, noBlock, other := ack, ack, ack, ack
+	ahead.BlockNum = 1 << 40
+	missing.BlockNum = 90
+	noBlock.BeaconHeader = nil
+	other.ShardID = 2
+	tests := []struct {
+		name string
+		ack  types.CrosslinkAck
+		want error
+	}{
+		{"ahead of the shard chain", ahead, errCrossLinkAckAhead},
+		{"block not in the beacon block", missing, errCrossLinkAckNotIncluded},
+		{"no beacon block", noBlock, errCrossLinkAckNoBlock},
+		{"crosslink of another shard", other, errCrossLinkAckNotIncluded},
+	}
+	for _, test := range tests {
+		if err := checkCrossLinkAck(test.ack, 100); err != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+}
+
+// fixedEpochSequence expects the epoch blocks of one epoch.
+type fixedEpochSequence int64
+
+func (s fixedEpochSequence) NextEpoch() *big.Int {
+	return big.NewInt(int64(s))
+}
+
+// headChain is a header chain whose current header is head.
+type headChain struct {
+	headerChain
+	head *block.Header
+}
+
+func (c headChain) CurrentHeader() *block.Header {
+	return c.head
+}
+
+func TestCheckEpochSequence(t *testing.T) {
+	head := blockfactory.NewTestHeader().With().Epoch(big.NewInt(4)).Header()
+	next := epochChainSequence{chain: headChain{head: head}}.NextEpoch()
+	if next.Cmp(big.NewInt(5)) != 0 {
+		t.Fatalf("expected epoch 5 after the epoch chain head, got %v", next)
+	}
+
+	tests := []struct {
+		name  string
+		epoch int64
+		want  error
+	}{
+		{"in order", 5, nil},
+		{"duplicate", 4, nil},
+		{"out of order", 3, errEpochBlockOutOfOrder},
+		{"next but one", 6, errEpochBlockFuture},
+		{"far future", 1 << 40, errEpochBlockFuture},
+	}
+	for _, test := range tests {
+		if err := checkEpochSequence(big.NewInt(test.epoch), next); err != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+}
+
+func TestProcessEpochBlockMessageFutureEpoch(t *testing.T) {
+	node := &Node{
+		NodeConfig:    &nodeconfig.ConfigType{ShardID: 1},
+		epochSequence: fixedEpochSequence(5),
+	}
+	data, err := shard.EncodeWrapper(shard.State{Epoch: big.NewInt(101)}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := rlp.EncodeToBytes(types.NewBlockWithHeader(blockfactory.NewTestHeader().With().
+		Epoch(big.NewInt(100)).ShardState(data).Header()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := `hmy_p2p_node_msg{type="epoch_block_out_of_sequence"}`
+	before := node.MetricsSnapshot()[key]
+	if err := node.processEpochBlockMessage(payload); !errors.Is(err, errEpochBlockFuture) {
+		t.Errorf("expected a far future epoch block to be rejected, got %v", err)
+	}
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected %s to increment, got %v -> %v", key, before, after)
+	}
+}
+
+// committeeReader serves the shard states of some epochs.
+type committeeReader map[uint64]*shard.State
+
+func (r committeeReader) ReadShardState(epoch *big.Int) (*shard.State, error) {
+	state, ok := r[epoch.Uint64()]
+	if !ok {
+		return nil, errors.New("no shard state")
+	}
+	return state, nil
+}
+
+// newBeaconState returns a shard state whose beacon committee is made of keys.
+func newBeaconState(keys ...*ffi_bls.SecretKey) *shard.State {
+	committee := shard.Committee{ShardID: shard.BeaconChainShardID}
+	for _, key := range keys {
+		committee.Slots = append(committee.Slots, shard.Slot{
+			BLSPublicKey: *bls.FromLibBLSPublicKeyUnsafe(key.GetPublicKey()),
+		})
+	}
+	return &shard.State{Shards: []shard.Committee{committee}}
+}
+
+// newSignedHeartbeat returns a heartbeat for shard 1 and epoch signed by key.
+func newSignedHeartbeat(t *testing.T, key *ffi_bls.SecretKey, epoch uint64) types.CrosslinkHeartbeat {
+	pub := bls.FromLibBLSPublicKeyUnsafe(key.GetPublicKey())
+	hb := types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90, Epoch: epoch, PublicKey: pub[:]}
+	signed, err := rlp.EncodeToBytes(hb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb.Signature = key.SignHash(signed).Serialize()
+	return hb
+}
+
+func TestVerifyHeartbeatSignature(t *testing.T) {
+	member, outsider := bls.RandPrivateKey(), bls.RandPrivateKey()
+	committees := committeeReader{2: newBeaconState(member)}
+	epoch := big.NewInt(2)
+
+	hb := newSignedHeartbeat(t, member, 2)
+	if err := verifyHeartbeatSignature(committees, epoch, &hb); err != nil {
+		t.Errorf("valid heartbeat rejected: %v", err)
+	}
+
+	forged := newSignedHeartbeat(t, member, 2)
+	forged.LatestContinuousBlockNum = 1000
+	if err := verifyHeartbeatSignature(committees, epoch, &forged); !errors.Is(err, errBeaconSignatureInvalid) {
+		t.Errorf("expected a forged heartbeat to fail the signature check, got %v", err)
+	}
+
+	stolenKey := newSignedHeartbeat(t, outsider, 2)
+	stolenKey.PublicKey = hb.PublicKey
+	if err := verifyHeartbeatSignature(committees, epoch, &stolenKey); !errors.Is(err, errBeaconSignatureInvalid) {
+		t.Errorf("expected a heartbeat signed by another key to fail the signature check, got %v", err)
+	}
+
+	outside := newSignedHeartbeat(t, outsider, 2)
+	if err := verifyHeartbeatSignature(committees, epoch, &outside); !errors.Is(err, errNotBeaconCommittee) {
+		t.Errorf("expected a heartbeat of a non committee member to be rejected, got %v", err)
+	}
+}
+
+func TestVerifyHeartbeatCommitteeEpoch(t *testing.T) {
+	retired, member := bls.RandPrivateKey(), bls.RandPrivateKey()
+	committees := committeeReader{
+		1: newBeaconState(retired),
+		2: newBeaconState(retired),
+		3: newBeaconState(member),
+	}
+	tests := []struct {
+		key   *ffi_bls.SecretKey
+		epoch uint64
+		err   error
+	}{
+		{member, 3, nil},
+		{retired, 3, errNotBeaconCommittee},
+		// the last crosslink may be from the previous epoch
+		{retired, 2, nil},
+		{member, 2, errNotBeaconCommittee},
+		{retired, 1, errHeartbeatEpochStale},
+	}
+	for i, test := range tests {
+		hb := newSignedHeartbeat(t, test.key, test.epoch)
+		err := verifyHeartbeatSignature(committees, big.NewInt(3), &hb)
+		if (test.err == nil && err != nil) || (test.err != nil && !errors.Is(err, test.err)) {
+			t.Errorf("test %d: expected %v, got %v", i, test.err, err)
+		}
+	}
+
+	future := newSignedHeartbeat(t, member, 4)
+	if err := verifyHeartbeatSignature(committees, big.NewInt(3), &future); err == nil {
+		t.Error("heartbeat of an epoch without known committee accepted")
+	}
+}
+
+func TestCrossLinkReplayHandler(t *testing.T) {
+	host := &recordingHost{}
+	node := &Node{
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		registry:   registry.New().SetBlockchain(headerChain{shardID: 1}),
+		crosslinks: crosslinks.New(),
+		host:       host,
+	}
+	now := time.Now()
+	for i, payload := range [][]byte{{1}, {2}} {
+		node.crosslinks.AddSentMessage(crosslinks.SentMessage{
+			FirstBlockNum: uint64(10*i + 1),
+			LastBlockNum:  uint64(10*i + 10),
+			Payload:       p2p.ConstructMessage(payload),
+			SentAt:        now,
+		})
+	}
+	req := proto_node.ConstructCrossLinkReplayRequestMessage(proto_node.CrossLinkReplayRequest{
+		ShardID:      1,
+		FromBlockNum: 10,
+	})[p2pNodeMsgPrefixSize+1:]
+	ctx := withMessagePeer(context.Background(), "beacon")
+
+	if err := node.crossLinkReplayHandler(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(host.sentMessages()); n != 0 {
+		t.Fatalf("expected gossiped request to be ignored, got %d replies", n)
+	}
+
+	if err := node.crossLinkReplayHandler(withDirectMessage(ctx), req); err != nil {
+		t.Fatal(err)
+	}
+	sent := host.sentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 replayed message, got %d", len(sent))
+	}
+	if sent[0].peer != "beacon" || !bytes.Equal(sent[0].msg, []byte{2}) {
+		t.Errorf("unexpected replayed message %x to %s", sent[0].msg, sent[0].peer)
+	}
+}
+
+func TestCrossLinkReplayRequestsThrottle(t *testing.T) {
+	var r crossLinkReplayRequests
+	now := time.Unix(1000, 0)
+	if !r.allow(1, now) {
+		t.Fatal("first replay request denied")
+	}
+	if r.allow(1, now.Add(crossLinkReplayInterval/2)) {
+		t.Error("replay request allowed within interval")
+	}
+	if !r.allow(2, now) {
+		t.Error("replay request of another shard denied")
+	}
+	if !r.allow(1, now.Add(crossLinkReplayInterval)) {
+		t.Error("replay request denied after interval")
+	}
+}
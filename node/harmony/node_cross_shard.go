@@ -1,11 +1,100 @@
 package node
 
 import (
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/harmony-one/harmony/core"
 	"github.com/harmony-one/harmony/core/types"
 	"github.com/harmony-one/harmony/internal/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// maxBufferedReceipts is the maximum number of receipts waiting for their source block.
+	maxBufferedReceipts = 1024
+	// maxBufferedReceiptAge is how long a receipt waits for its source block before it is dropped.
+	maxBufferedReceiptAge = 10 * time.Minute
+	// chainHeadChanSize is the size of the channel of the chain head events releasing receipts.
+	chainHeadChanSize = 16
 )
 
+// receiptPool takes the cross shard receipts to include in the next blocks.
+type receiptPool interface {
+	AddPendingReceipts(*types.CXReceiptsProof)
+}
+
+type bufferedReceipt struct {
+	cxp     *types.CXReceiptsProof
+	addedAt time.Time
+}
+
+// receiptBuffer keeps cross shard receipts which arrived before their source block is known.
+type receiptBuffer struct {
+	mu    sync.Mutex
+	items map[utils.CXKey]bufferedReceipt
+}
+
+// add buffers the receipt, returns false if it is already buffered or the buffer is full.
+func (b *receiptBuffer) add(cxp *types.CXReceiptsProof, now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.items == nil {
+		b.items = make(map[utils.CXKey]bufferedReceipt)
+	}
+	b.expire(now)
+	key := utils.GetPendingCXKey(cxp.Header.ShardID(), cxp.Header.Number().Uint64())
+	if _, ok := b.items[key]; ok || len(b.items) >= maxBufferedReceipts {
+		return false
+	}
+	b.items[key] = bufferedReceipt{cxp: cxp, addedAt: now}
+	return true
+}
+
+// release removes and returns the buffered receipts whose source block is known,
+// ordered by source shard and block number.
+func (b *receiptBuffer) release(now time.Time, known func(*types.CXReceiptsProof) bool) []*types.CXReceiptsProof {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now)
+	var ready []*types.CXReceiptsProof
+	for key, item := range b.items {
+		if known(item.cxp) {
+			ready = append(ready, item.cxp)
+			delete(b.items, key)
+		}
+	}
+	sort.SliceStable(ready, func(i, j int) bool {
+		if ready[i].Header.ShardID() != ready[j].Header.ShardID() {
+			return ready[i].Header.ShardID() < ready[j].Header.ShardID()
+		}
+		return ready[i].Header.Number().Cmp(ready[j].Header.Number()) < 0
+	})
+	return ready
+}
+
+// size returns the number of buffered receipts.
+func (b *receiptBuffer) size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.items)
+}
+
+// expire drops the receipts buffered for too long. Caller must hold mu.
+func (b *receiptBuffer) expire(now time.Time) {
+	for key, item := range b.items {
+		if now.Sub(item.addedAt) > maxBufferedReceiptAge {
+			delete(b.items, key)
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "receipt_expired"}).Inc()
+		}
+	}
+}
+
 // ProcessReceiptMessage store the receipts and merkle proof in local data store
 func (node *Node) ProcessReceiptMessage(msgPayload []byte) {
 	cxp := types.CXReceiptsProof{}
@@ -14,8 +103,65 @@ func (node *Node) ProcessReceiptMessage(msgPayload []byte) {
 			Msg("[ProcessReceiptMessage] Unable to Decode message Payload")
 		return
 	}
+	if cxp.Header == nil {
+		utils.Logger().Info().Msg("[ProcessReceiptMessage] CXReceiptsProof without header")
+		return
+	}
+	now := time.Now()
+	if !node.receiptSourceKnown(&cxp) {
+		if node.bufferedReceipts.add(&cxp, now) {
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "receipt_buffered"}).Inc()
+		}
+		utils.Logger().Debug().
+			Uint32("shardID", cxp.Header.ShardID()).
+			Uint64("blockNum", cxp.Header.Number().Uint64()).
+			Msg("[ProcessReceiptMessage] Source block not known yet, buffering receipt")
+		return
+	}
 	utils.Logger().Debug().Interface("cxp", cxp).
 		Msg("[ProcessReceiptMessage] Add CXReceiptsProof to pending Receipts")
 	// TODO: integrate with txpool
 	node.AddPendingReceipts(&cxp)
+	node.releaseBufferedReceipts(now)
+}
+
+// releaseBufferedReceipts adds the buffered receipts whose source block became known to pending receipts.
+func (node *Node) releaseBufferedReceipts(now time.Time) {
+	for _, cxp := range node.bufferedReceipts.release(now, node.receiptSourceKnown) {
+		node.AddPendingReceipts(cxp)
+	}
+}
+
+// releaseReceiptsOnChainHead releases the buffered receipts whose source block became known
+// on each new head of the chain, as the chain may learn the source committees without any
+// further receipt arriving, until the node shuts down.
+func (node *Node) releaseReceiptsOnChainHead() {
+	heads := make(chan core.ChainHeadEvent, chainHeadChanSize)
+	sub := node.Blockchain().SubscribeChainHeadEvent(heads)
+	if sub == nil {
+		return
+	}
+	shutdown := node.shutdown.context()
+	node.goroutines.track(func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-heads:
+				if node.bufferedReceipts.size() > 0 {
+					node.releaseBufferedReceipts(time.Now())
+				}
+			case <-sub.Err():
+				return
+			case <-shutdown.Done():
+				return
+			}
+		}
+	})
+}
+
+// receiptSourceKnown returns true if the committee of the receipt's source block is known,
+// so that the receipt proof can be verified.
+func (node *Node) receiptSourceKnown(cxp *types.CXReceiptsProof) bool {
+	_, err := node.Blockchain().ReadShardState(cxp.Header.Epoch())
+	return err == nil
 }
@@ -0,0 +1,158 @@
+package node
+
+import (
+	"errors"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/rlp"
+	blockfactory "github.com/harmony-one/harmony/block/factory"
+	"github.com/harmony-one/harmony/core"
+	"github.com/harmony-one/harmony/core/types"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/registry"
+	"github.com/harmony-one/harmony/shard"
+)
+
+func newTestReceiptsProof(shardID uint32, num int64) *types.CXReceiptsProof {
+	return &types.CXReceiptsProof{
+		Header: blockfactory.NewTestHeader().With().ShardID(shardID).Number(big.NewInt(num)).Header(),
+	}
+}
+
+func TestReceiptBufferOutOfOrder(t *testing.T) {
+	var buf receiptBuffer
+	now := time.Unix(1000, 0)
+
+	// receipts of later blocks arrive first, before their source blocks are known
+	for _, num := range []int64{7, 5, 6} {
+		if !buf.add(newTestReceiptsProof(1, num), now) {
+			t.Fatalf("receipt of block %d not buffered", num)
+		}
+	}
+	if buf.add(newTestReceiptsProof(1, 6), now) {
+		t.Error("duplicate receipt buffered")
+	}
+
+	knownUpTo := int64(0)
+	known := func(cxp *types.CXReceiptsProof) bool {
+		return cxp.Header.Number().Int64() <= knownUpTo
+	}
+	if got := buf.release(now, known); len(got) != 0 {
+		t.Fatalf("released %d receipts before source blocks are known", len(got))
+	}
+
+	knownUpTo = 6
+	got := buf.release(now, known)
+	if len(got) != 2 || got[0].Header.Number().Int64() != 5 || got[1].Header.Number().Int64() != 6 {
+		t.Fatalf("unexpected released receipts %v", got)
+	}
+	if buf.size() != 1 {
+		t.Errorf("expected 1 buffered receipt, got %d", buf.size())
+	}
+
+	knownUpTo = 7
+	if got := buf.release(now.Add(maxBufferedReceiptAge+time.Second), known); len(got) != 0 {
+		t.Errorf("released expired receipt")
+	}
+	if buf.size() != 0 {
+		t.Errorf("expected empty buffer, got %d", buf.size())
+	}
+}
+
+func TestReceiptBufferBound(t *testing.T) {
+	var buf receiptBuffer
+	now := time.Unix(1000, 0)
+	for i := 0; i < maxBufferedReceipts; i++ {
+		if !buf.add(newTestReceiptsProof(1, int64(i+1)), now) {
+			t.Fatalf("receipt %d not buffered", i)
+		}
+	}
+	if buf.add(newTestReceiptsProof(2, 1), now) {
+		t.Error("receipt buffered beyond the bound")
+	}
+}
+
+// receiptChain is a header chain knowing the shard states up to an epoch, announcing its
+// new heads.
+type receiptChain struct {
+	headerChain
+	known *atomic.Int64
+	heads *event.Feed
+}
+
+func (c receiptChain) ReadShardState(epoch *big.Int) (*shard.State, error) {
+	if epoch.Int64() > c.known.Load() {
+		return nil, errors.New("no shard state")
+	}
+	return &shard.State{}, nil
+}
+
+func (c receiptChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.heads.Subscribe(ch)
+}
+
+// recordingReceiptPool records the block numbers of the pending receipts it takes.
+type recordingReceiptPool struct {
+	mu   sync.Mutex
+	nums []int64
+}
+
+func (p *recordingReceiptPool) AddPendingReceipts(cxp *types.CXReceiptsProof) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nums = append(p.nums, cxp.Header.Number().Int64())
+}
+
+func (p *recordingReceiptPool) taken() []int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int64(nil), p.nums...)
+}
+
+func TestProcessReceiptMessageReleasedOnChainHead(t *testing.T) {
+	chain := receiptChain{headerChain: headerChain{shardID: 0}, known: new(atomic.Int64), heads: new(event.Feed)}
+	chain.known.Store(1)
+	pool := &recordingReceiptPool{}
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}, registry: registry.New().SetBlockchain(chain), receiptPool: pool}
+	node.releaseReceiptsOnChainHead()
+	t.Cleanup(func() {
+		node.shutdown.trigger()
+		waitForGoroutines(t, node)
+	})
+
+	// the receipts of epoch 2 arrive out of order, before the chain knows their committees
+	for _, num := range []int64{7, 5, 6} {
+		cxp := &types.CXReceiptsProof{
+			MerkleProof: &types.CXMerkleProof{},
+			Header:      blockfactory.NewTestHeader().With().ShardID(1).Epoch(big.NewInt(2)).Number(big.NewInt(num)).Header(),
+		}
+		payload, err := rlp.EncodeToBytes(cxp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		node.ProcessReceiptMessage(payload)
+	}
+	if taken := pool.taken(); len(taken) != 0 || node.bufferedReceipts.size() != 3 {
+		t.Fatalf("expected the 3 receipts buffered, got %d buffered and %v taken", node.bufferedReceipts.size(), taken)
+	}
+
+	// no further receipt arrives, the new head alone releases them
+	chain.known.Store(2)
+	chain.heads.Send(core.ChainHeadEvent{})
+	deadline := time.Now().Add(time.Second)
+	for len(pool.taken()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if taken := pool.taken(); !slices.Equal(taken, []int64{5, 6, 7}) {
+		t.Errorf("expected the receipts of blocks 5, 6 and 7 released in order, got %v", taken)
+	}
+	if n := node.bufferedReceipts.size(); n != 0 {
+		t.Errorf("expected no receipt left buffered, got %d", n)
+	}
+}
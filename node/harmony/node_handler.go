@@ -4,361 +4,957 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/rlp"
-	"github.com/harmony-one/harmony/crypto/bls"
-	"github.com/harmony-one/harmony/internal/utils/crosslinks"
 
 	"github.com/harmony-one/harmony/api/proto"
 	proto_node "github.com/harmony-one/harmony/api/proto/node"
 	"github.com/harmony-one/harmony/block"
+	"github.com/harmony-one/harmony/consensus"
 	"github.com/harmony-one/harmony/core"
 	"github.com/harmony-one/harmony/core/types"
 	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
 	"github.com/harmony-one/harmony/internal/utils"
 	"github.com/harmony-one/harmony/p2p"
+	rpc_common "github.com/harmony-one/harmony/rpc/harmony/common"
 	"github.com/harmony-one/harmony/shard"
 	"github.com/harmony-one/harmony/staking/slash"
-	staking "github.com/harmony-one/harmony/staking/types"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/semaphore"
 )
 
 const p2pMsgPrefixSize = 5
 const p2pNodeMsgPrefixSize = proto.MessageTypeBytes + proto.MessageCategoryBytes
 
-// some messages have uninteresting fields in header, slash, receipt and crosslink are
-// such messages. This function assumes that input bytes are a slice which already
-// past those not relevant header bytes.
-func (node *Node) processSkippedMsgTypeByteValue(
-	cat proto_node.BlockMessageType, content []byte,
-) {
-	switch cat {
-	case proto_node.SlashCandidate:
-		node.processSlashCandidateMessage(content)
-	case proto_node.Receipt:
-		node.ProcessReceiptMessage(content)
-	case proto_node.CrossLink:
-		node.ProcessCrossLinkMessage(content)
-	case proto_node.CrosslinkHeartbeat:
-		node.ProcessCrossLinkHeartbeatMessage(content)
-	case proto_node.Epoch:
-		node.ProcessEpochBlockMessage(content)
-	default:
-		utils.Logger().Error().
-			Int("message-iota-value", int(cat)).
-			Msg("Invariant usage of processSkippedMsgTypeByteValue violated")
-	}
-}
-
 // HandleNodeMessage parses the message and dispatch the actions.
+// peerID is the peer which published the message, empty if not known.
 func (node *Node) HandleNodeMessage(
 	ctx context.Context,
+	peerID libp2p_peer.ID,
 	msgPayload []byte,
 	actionType proto_node.MessageType,
 ) error {
+	if peerID != "" && peerID == node.host.GetID() && !node.NodeConfig.Handler.AcceptSelfMessages {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "self_loopback"}).Inc()
+		return nil
+	}
+	if len(msgPayload) == 0 {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "empty_payload"}).Inc()
+		return errors.Errorf("empty payload for actionType %v", actionType)
+	}
+	countNodeMessage(actionType, msgPayload)
+	ctx, span := node.startSpan(ctx, "node.message."+actionType.String(),
+		attribute.Int("payload_size", len(msgPayload)),
+		attribute.Int64("shard_id", int64(node.NodeConfig.ShardID)),
+	)
+	defer span.End()
+	key, payload := nodeMessageKey{action: actionType}, msgPayload
+	if actionType == proto_node.Block {
+		// skip first byte which is blockMsgType
+		key.blockType, payload = proto_node.BlockMessageType(msgPayload[0]), msgPayload[1:]
+	}
+	handler, ok := node.messageHandlers.get(node, key)
+	if !ok {
+		if actionType == proto_node.Block && !key.blockType.Known() {
+			return unknownBlockMessageType(peerID, key.blockType)
+		}
+		utils.Logger().Debug().
+			Int("actionType", int(key.action)).
+			Int("blockMsgType", int(key.blockType)).
+			Msg("[HandleNodeMessage] no handler for message")
+		return nil
+	}
+	release, ok := node.acquireMessageHandling(ctx, actionType)
+	if !ok {
+		return nil
+	}
+	defer release()
+	return handler(withMessagePeer(ctx, peerID), payload)
+}
+
+// messageClass is a class of node messages whose handling is limited together, so that
+// a flood of messages of one class can't starve the others.
+type messageClass int
+
+const (
+	txMessages messageClass = iota
+	blockMessages
+	otherMessages
+	numMessageClasses
+)
+
+// nodeMessageClass returns the class of the node messages of actionType.
+func nodeMessageClass(actionType proto_node.MessageType) messageClass {
 	switch actionType {
-	case proto_node.Transaction:
-		node.transactionMessageHandler(msgPayload)
-	case proto_node.Staking:
-		node.stakingMessageHandler(msgPayload)
+	case proto_node.Transaction, proto_node.Staking:
+		return txMessages
 	case proto_node.Block:
-		switch blockMsgType := proto_node.BlockMessageType(msgPayload[0]); blockMsgType {
-		case proto_node.Sync:
-			blocks := []*types.Block{}
-			if err := rlp.DecodeBytes(msgPayload[1:], &blocks); err != nil {
-				utils.Logger().Error().
-					Err(err).
-					Msg("block sync")
-			} else {
-				// for non-beaconchain node, subscribe to beacon block broadcast
-				if node.Blockchain().ShardID() != shard.BeaconChainShardID {
-					for _, block := range blocks {
-						if block.ShardID() == 0 {
-							if block.IsLastBlockInEpoch() {
-								go func(blk *types.Block) {
-									node.BeaconBlockChannel <- blk
-								}(block)
-							}
-						}
-					}
-				}
-			}
-		case
-			proto_node.SlashCandidate,
-			proto_node.Receipt,
-			proto_node.CrossLink,
-			proto_node.CrosslinkHeartbeat,
-			proto_node.Epoch:
-			// skip first byte which is blockMsgType
-			node.processSkippedMsgTypeByteValue(blockMsgType, msgPayload[1:])
-		}
+		return blockMessages
 	default:
-		utils.Logger().Error().
-			Str("Unknown actionType", string(actionType))
+		return otherMessages
 	}
-	return nil
 }
 
-func (node *Node) transactionMessageHandler(msgPayload []byte) {
-	txMessageType := proto_node.TransactionMessageType(msgPayload[0])
+// acquireMessageHandling takes a slot of the class of actionType for handling a node message.
+func (node *Node) acquireMessageHandling(ctx context.Context, actionType proto_node.MessageType) (func(), bool) {
+	cfg := node.NodeConfig.Handler
+	class := nodeMessageClass(actionType)
+	limit, counter := cfg.MaxConcurrentOtherMessages, "other_handling"
+	switch class {
+	case txMessages:
+		limit, counter = cfg.MaxConcurrentTxMessages, "tx_handling"
+	case blockMessages:
+		limit, counter = cfg.MaxConcurrentBlockMessages, "block_handling"
+	}
+	return node.messageHandling[class].acquire(ctx, limit, cfg.MessageHandlingWait, counter)
+}
+
+var errUnknownBlockMessageType = errors.New("unknown block message type")
+
+// unknownBlockMessageType counts and logs a block message of a type not defined by the
+// protocol received from peerID, and returns the error reporting it.
+func unknownBlockMessageType(peerID libp2p_peer.ID, blockMsgType proto_node.BlockMessageType) error {
+	nodeUnknownBlockMessageCounterVec.With(prometheus.Labels{"block_type": strconv.Itoa(int(blockMsgType))}).Inc()
+	utils.Logger().Warn().
+		Str("peer", peerID.String()).
+		Int("blockMsgType", int(blockMsgType)).
+		Msg("received block message of unknown type")
+	return errors.WithMessagef(errUnknownBlockMessageType, "type %d from peer %s", blockMsgType, peerID)
+}
 
-	switch txMessageType {
-	case proto_node.Send:
-		txs := types.Transactions{}
-		err := rlp.Decode(bytes.NewReader(msgPayload[1:]), &txs) // skip the Send messge type
-		if err != nil {
-			utils.Logger().Error().
-				Err(err).
-				Msg("Failed to deserialize transaction list")
-			return
-		}
-		addPendingTransactions(node.registry, txs)
+// handleBlocksSync handles a blocks sync message of type msgType.
+func (node *Node) handleBlocksSync(ctx context.Context, msgType proto_node.BlockMessageType, payload []byte) error {
+	release, ok := node.acquireSyncDecode(ctx)
+	if !ok {
+		return nil
 	}
+	blocks, err := decodeBlocksSync(ctx, msgType, payload, node.maxSyncBlocksPerMessage(), node.maxSyncBlocksBytes())
+	release()
+	if isOversizedRLPList(err) {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "block_sync_oversized"}).Inc()
+		utils.Logger().Warn().
+			Err(err).
+			Str("peer", MessagePeer(ctx).String()).
+			Int("payloadSize", len(payload)).
+			Msg("block sync: rejecting oversized blocks sync message")
+		return nil
+	} else if err != nil {
+		utils.Logger().Error().
+			Err(err).
+			Msg("block sync")
+		return nil
+	}
+	// for non-beaconchain node, subscribe to beacon block broadcast
+	if node.Blockchain().ShardID() != shard.BeaconChainShardID {
+		routeSyncBlocks(blocks, node.enqueueBeaconBlock)
+	} else {
+		countSyncBlocks(blocks)
+	}
+	return nil
 }
 
-func (node *Node) stakingMessageHandler(msgPayload []byte) {
-	txMessageType := proto_node.TransactionMessageType(msgPayload[0])
+// countSyncBlocks counts the blocks received by a blocks sync message.
+func countSyncBlocks(blocks []*types.Block) {
+	if len(blocks) == 0 {
+		return
+	}
+	nodeBlockSyncReceivedCounter.Add(float64(len(blocks)))
+	minNum, maxNum := blocks[0].NumberU64(), blocks[0].NumberU64()
+	for _, block := range blocks[1:] {
+		minNum, maxNum = min(minNum, block.NumberU64()), max(maxNum, block.NumberU64())
+	}
+	utils.Logger().Debug().
+		Int("blocks", len(blocks)).
+		Uint64("minBlockNum", minNum).
+		Uint64("maxBlockNum", maxNum).
+		Msg("block sync: received blocks")
+}
 
-	switch txMessageType {
-	case proto_node.Send:
-		txs := staking.StakingTransactions{}
-		err := rlp.Decode(bytes.NewReader(msgPayload[1:]), &txs) // skip the Send message type
-		if err != nil {
-			utils.Logger().Error().
+// routeSyncBlocks counts the blocks received by a blocks sync message and passes its
+// beacon epoch blocks to enqueue, returning the number of blocks enqueue queued.
+func routeSyncBlocks(blocks []*types.Block, enqueue func(*types.Block) bool) int {
+	countSyncBlocks(blocks)
+	queued := 0
+	for _, block := range blocks {
+		if err := validateBlockShard(block, block.ShardID()); err != nil {
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "block_sync_shard_mismatch"}).Inc()
+			utils.Logger().Warn().
 				Err(err).
-				Msg("Failed to deserialize staking transaction list")
-			return
+				Uint64("blockNum", block.NumberU64()).
+				Msg("block sync: rejecting block with inconsistent shard")
+			continue
+		}
+		if block.ShardID() == shard.BeaconChainShardID && block.IsLastBlockInEpoch() && enqueue(block) {
+			queued++
 		}
-		node.addPendingStakingTransactions(txs)
 	}
+	nodeBlockSyncBeaconQueuedCounter.Add(float64(queued))
+	return queued
 }
 
-// BroadcastNewBlock is called by consensus leader to sync new blocks with other clients/nodes.
-// NOTE: For now, just send to the client (basically not broadcasting)
-// TODO (lc): broadcast the new blocks to new nodes doing state sync
-func BroadcastNewBlock(host p2p.Host, newBlock *types.Block, nodeConfig *nodeconfig.ConfigType) {
-	groups := []nodeconfig.GroupID{nodeConfig.GetClientGroupID()}
-	utils.Logger().Info().
-		Msgf(
-			"broadcasting new block %d, group %s", newBlock.NumberU64(), groups[0],
-		)
-	msg := p2p.ConstructMessage(
-		proto_node.ConstructBlocksSyncMessage([]*types.Block{newBlock}),
-	)
-	if err := host.SendMessageToGroups(groups, msg); err != nil {
-		utils.Logger().Warn().Err(err).Msg("cannot broadcast new block")
+// countNodeMessage counts a node message dispatched by HandleNodeMessage and observes its
+// payload size. Block messages are also counted by block message type.
+func countNodeMessage(actionType proto_node.MessageType, msgPayload []byte) {
+	blockType := ""
+	if actionType == proto_node.Block {
+		blockType = proto_node.BlockMessageType(msgPayload[0]).String()
 	}
+	nodeMessageDispatchCounterVec.With(prometheus.Labels{
+		"action":     actionType.String(),
+		"block_type": blockType,
+	}).Inc()
+	nodeMessagePayloadSizeHistogramVec.With(prometheus.Labels{
+		"action": actionType.String(),
+	}).Observe(float64(len(msgPayload)))
 }
 
-// BroadcastSlash ..
-func (node *Node) BroadcastSlash(witness *slash.Record) {
-	if err := node.host.SendMessageToGroups(
-		[]nodeconfig.GroupID{nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID)},
-		p2p.ConstructMessage(
-			proto_node.ConstructSlashMessage(slash.Records{*witness})),
-	); err != nil {
-		utils.Logger().Err(err).
-			RawJSON("record", []byte(witness.String())).
-			Msg("could not send slash record to beaconchain")
+// beaconBlockQueueSize is the number of beacon epoch blocks from block sync messages
+// queued for the epoch chain.
+const beaconBlockQueueSize = 16
+
+var (
+	errBeaconBlockKnown     = errors.New("beacon block not newer than the epoch chain head")
+	errBeaconBlockQueueFull = errors.New("beacon block queue full")
+	errBeaconBlockParent    = errors.New("beacon block parent does not match the epoch chain head")
+	errBeaconBlockTime      = errors.New("beacon block time not after the epoch chain head or in the future")
+	errBeaconBlockNumber    = errors.New("beacon block number too far ahead for its time")
+)
+
+// maxBeaconBlockFutureTime is how far in the future the time of a beacon block from
+// block sync may be, for clock drift.
+const maxBeaconBlockFutureTime = 15 * time.Second
+
+// checkBeaconBlockSanity cheaply rejects beacon blocks which can't follow head at now: a
+// block without parent or not built on head if it is the next block, a block not after
+// head or from the future, and a block further ahead of head than one block per second
+// since head. The blocks are fully verified by the epoch chain.
+func checkBeaconBlockSanity(head *block.Header, blk *types.Block, now time.Time) error {
+	parent := blk.ParentHash()
+	if parent == (common.Hash{}) || (blk.NumberU64() == head.Number().Uint64()+1 && parent != head.Hash()) {
+		return errBeaconBlockParent
+	}
+	blkTime, headTime := blk.Time(), head.Time()
+	if blkTime.Cmp(headTime) <= 0 || blkTime.Cmp(big.NewInt(now.Add(maxBeaconBlockFutureTime).Unix())) > 0 {
+		return errBeaconBlockTime
 	}
-	utils.Logger().Info().Msg("broadcast the double sign record")
+	if elapsed := new(big.Int).Sub(blkTime, headTime); blk.NumberU64()-head.Number().Uint64() > elapsed.Uint64() {
+		return errBeaconBlockNumber
+	}
+	return nil
 }
 
-// BroadcastCrossLinkFromShardsToBeacon is called by consensus leader to
-// send the new header as cross link to beacon chain.
-func (node *Node) BroadcastCrossLinkFromShardsToBeacon() { // leader of 1-3 shards
-	if node.IsRunningBeaconChain() {
-		return
+// queueBeaconBlock queues the epoch block blk into queue without blocking. Blocks not
+// newer than the epoch chain head, failing the epoch block or sanity checks at now or
+// arriving while the queue is full are not queued, so that resent or fabricated blocks
+// can't stall the message handling. Dropped blocks are fetched again by the beacon sync.
+func queueBeaconBlock(queue chan<- *types.Block, head *block.Header, blk *types.Block, now time.Time) error {
+	if blk.NumberU64() <= head.Number().Uint64() {
+		return errBeaconBlockKnown
 	}
-	if !(node.Consensus.IsLeader() || rand.Intn(100) <= 1) {
-		return
+	if err := checkEpochBlock(blk, head.Epoch()); err != nil {
+		return err
 	}
-	curBlock := node.Blockchain().CurrentBlock()
-	if curBlock == nil {
-		return
+	if err := checkBeaconBlockSanity(head, blk, now); err != nil {
+		return err
 	}
-
-	if !node.Blockchain().Config().IsCrossLink(curBlock.Epoch()) {
-		// no need to broadcast crosslink if it's beacon chain, or it's not crosslink epoch
-		return
+	defer func() { nodeBeaconBlockQueueGauge.Set(float64(len(queue))) }()
+	select {
+	case queue <- blk:
+		return nil
+	default:
+		return errBeaconBlockQueueFull
 	}
+}
 
-	utils.Logger().Info().Msgf(
-		"Construct and Broadcasting new crosslink to beacon chain groupID %s",
-		nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID),
-	)
+// enqueueBeaconBlock queues a beacon epoch block received by block sync for the epoch chain,
+// returning true if it was queued.
+func (node *Node) enqueueBeaconBlock(blk *types.Block) bool {
+	err := queueBeaconBlock(node.BeaconBlockChannel, node.EpochChain().CurrentHeader(), blk, node.getClock().Now())
+	if err == nil {
+		return true
+	}
+	counter := "beacon_block_invalid"
+	switch err {
+	case errBeaconBlockKnown:
+		counter = "beacon_block_known"
+	case errBeaconBlockQueueFull:
+		counter = "beacon_block_dropped"
+	case errBeaconBlockParent, errBeaconBlockTime, errBeaconBlockNumber:
+		counter = "beacon_block_implausible"
+	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counter}).Inc()
+	utils.Logger().Debug().
+		Err(err).
+		Uint64("blockNum", blk.NumberU64()).
+		Msg("block sync: beacon block not queued")
+	return false
+}
 
-	headers, err := getCrosslinkHeadersForShards(node.Blockchain(), curBlock, node.crosslinks)
+// decodeBlocksSync decodes the blocks of a blocks sync message of the given type,
+// decompressing its payload first if needed. The blocks are decoded one by one, and a
+// message of more than maxBlocks blocks or with a block list larger than maxBytes is
+// rejected as a whole, with an error for which isOversizedRLPList returns true.
+func decodeBlocksSync(ctx context.Context, msgType proto_node.BlockMessageType, payload []byte, maxBlocks, maxBytes int) ([]*types.Block, error) {
+	if msgType == proto_node.SyncCompressed {
+		data, err := proto_node.DecompressBlocksSync(payload, maxBytes)
+		if errors.Is(err, proto_node.ErrBlocksSyncTooLarge) {
+			return nil, errRLPListTooLarge
+		} else if err != nil {
+			return nil, errors.Wrap(err, "cannot decompress blocks sync payload")
+		}
+		payload = data
+	}
+	blocks, err := decodeRLPList[types.Block](ctx, payload, maxBlocks, maxBytes)
 	if err != nil {
-		utils.Logger().Error().Err(err).Msg("[BroadcastCrossLink] failed to get crosslinks")
-		return
+		return nil, err
 	}
+	return blocks, nil
+}
 
-	if len(headers) == 0 {
-		utils.Logger().Info().Msg("[BroadcastCrossLink] no crosslinks to broadcast")
-		return
-	}
+// concurrencyLimiter bounds the number of messages processed at the same time, and so
+// the CPU and memory taken by their decoding.
+type concurrencyLimiter struct {
+	once sync.Once
+	sem  *semaphore.Weighted
+}
 
-	for _, h := range headers {
-		utils.Logger().Info().Msgf("[BroadcastCrossLink] header shard %d blockNum %d", h.ShardID(), h.Number().Uint64())
+// acquire takes a slot, waiting up to wait for one if all limit slots are taken. It
+// returns the function releasing the slot, and false if no slot was available. Waits and
+// drops are counted as counter_saturated and counter_dropped.
+func (l *concurrencyLimiter) acquire(ctx context.Context, limit int, wait time.Duration, counter string) (func(), bool) {
+	if limit <= 0 {
+		return func() {}, true
+	}
+	l.once.Do(func() {
+		l.sem = semaphore.NewWeighted(int64(limit))
+	})
+	release := func() { l.sem.Release(1) }
+	if l.sem.TryAcquire(1) {
+		return release, true
+	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counter + "_saturated"}).Inc()
+	if wait > 0 {
+		waitCtx, cancel := context.WithTimeout(ctx, wait)
+		defer cancel()
+		if l.sem.Acquire(waitCtx, 1) == nil {
+			return release, true
+		}
 	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counter + "_dropped"}).Inc()
+	return nil, false
+}
 
-	err = node.host.SendMessageToGroups(
-		[]nodeconfig.GroupID{nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID)},
-		p2p.ConstructMessage(
-			proto_node.ConstructCrossLinkMessage(node.Consensus.Blockchain(), headers)),
+// acquireSyncDecode takes a slot for decoding a block sync message.
+func (node *Node) acquireSyncDecode(ctx context.Context) (func(), bool) {
+	return node.syncDecodes.acquire(
+		ctx, node.NodeConfig.Handler.MaxConcurrentSyncDecodes, node.NodeConfig.Handler.SyncDecodeWait, "sync_decode",
 	)
-	if err != nil {
-		utils.Logger().Error().Err(err).Msgf("[BroadcastCrossLink] failed to broadcast message")
-	} else {
-		node.crosslinks.SetLatestSentCrosslinkBlockNumber(headers[len(headers)-1].Number().Uint64())
+}
+
+// validateBlockShard checks that the block belongs to shardID and that the shard IDs of
+// its transactions and incoming receipts are consistent with it.
+func validateBlockShard(block *types.Block, shardID uint32) error {
+	if block.ShardID() != shardID {
+		return errors.Errorf("block shard %d, expected %d", block.ShardID(), shardID)
+	}
+	for _, tx := range block.Transactions() {
+		if tx.ShardID() != shardID {
+			return errors.Errorf("transaction %s of shard %d", tx.Hash().Hex(), tx.ShardID())
+		}
+	}
+	if len(block.StakingTransactions()) > 0 && shardID != shard.BeaconChainShardID {
+		return errors.Errorf("staking transactions in shard %d", shardID)
+	}
+	for _, cxp := range block.IncomingReceipts() {
+		toShardID, err := cxp.GetToShardID()
+		if err != nil {
+			return err
+		}
+		if toShardID != shardID {
+			return errors.Errorf("incoming receipts to shard %d", toShardID)
+		}
 	}
+	return nil
 }
 
-// BroadcastCrosslinkHeartbeatSignalFromBeaconToShards is called by consensus leader or 1% validators to
-// send last cross link to shard chains.
-func (node *Node) BroadcastCrosslinkHeartbeatSignalFromBeaconToShards() { // leader of 0 shard
-	if !node.IsRunningBeaconChain() {
-		return
+const (
+	// defaultMaxSyncBlocksPerMessage is the default number of blocks of a blocks sync message which are accepted.
+	defaultMaxSyncBlocksPerMessage = 256
+	// defaultMaxSyncBlocksBytes is the default size of the block list of a blocks sync message which is accepted.
+	defaultMaxSyncBlocksBytes = proto_node.MaxBlocksSyncSize
+)
+
+// maxSyncBlocksPerMessage returns the number of blocks of a blocks sync message which are accepted.
+func (node *Node) maxSyncBlocksPerMessage() int {
+	if n := node.NodeConfig.Handler.MaxSyncBlocksPerMessage; n > 0 {
+		return n
 	}
-	if !(node.IsCurrentlyLeader() || rand.Intn(100) == 0) {
-		return
+	return defaultMaxSyncBlocksPerMessage
+}
+
+// maxSyncBlocksBytes returns the size of the block list of a blocks sync message which is accepted.
+func (node *Node) maxSyncBlocksBytes() int {
+	if n := node.NodeConfig.Handler.MaxSyncBlocksBytes; n > 0 {
+		return n
 	}
+	return defaultMaxSyncBlocksBytes
+}
 
-	curBlock := node.Beaconchain().CurrentBlock()
-	if curBlock == nil {
-		return
+// isOversizedRLPList returns true if err is from a list exceeding the decoding bounds.
+func isOversizedRLPList(err error) bool {
+	return err == errTooManyRLPItems || err == errRLPListTooLarge
+}
+
+// handleDirectMessage handles the node message msg sent directly to this node by from.
+// Only the replies to the requests of a single peer are accepted this way: the transaction
+// requests and lists, and the crosslink replay requests and crosslinks.
+func (node *Node) handleDirectMessage(from libp2p_peer.ID, msg []byte) {
+	ctx, cancel := context.WithTimeout(node.psCtx, p2p.DirectMessageTimeout)
+	defer cancel()
+	payload, actionType, err := node.validateNodeMessage(ctx, msg)
+	if err == nil && !isDirectMessageType(actionType, payload[0]) {
+		err = errors.Errorf("unexpected direct message of type %v/%d", actionType, payload[0])
+	}
+	if err == nil {
+		err = node.HandleNodeMessage(withDirectMessage(ctx), from, payload, actionType)
+	}
+	if err != nil {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "direct_rejected"}).Inc()
+		utils.Logger().Debug().Err(err).Str("peer", from.String()).Msg("direct message rejected")
 	}
+}
 
-	if !node.Blockchain().Config().IsCrossLink(curBlock.Epoch()) {
-		// no need to broadcast crosslink if it's beacon chain, or it's not crosslink epoch
-		return
+// isDirectMessageType returns whether node messages of actionType and subType are accepted
+// when sent directly to the node.
+func isDirectMessageType(actionType proto_node.MessageType, subType byte) bool {
+	switch actionType {
+	case proto_node.Transaction:
+		switch proto_node.TransactionMessageType(subType) {
+		case proto_node.Request, proto_node.Send, proto_node.SendCompressed:
+			return true
+		}
+	case proto_node.Block:
+		switch proto_node.BlockMessageType(subType) {
+		case proto_node.CrossLinkReplay, proto_node.CrossLink:
+			return true
+		}
+	case proto_node.ChainInfo:
+		return true
 	}
+	return false
+}
+
+var (
+	errTooManyRLPItems = errors.New("too many items in RLP list")
+	errRLPListTooLarge = errors.New("RLP list too large")
+)
 
-	var privToSign *bls.PrivateKeyWrapper
-	for _, priv := range node.Consensus.GetPrivateKeys() {
-		if node.Consensus.IsValidatorInCommittee(priv.Pub.Bytes) {
-			privToSign = &priv
-			break
+// decodeRLPList decodes a RLP list item by item. On a malformed item it returns
+// the items decoded before it together with the error. With a positive maxItems,
+// it stops after maxItems items and returns them with errTooManyRLPItems if the
+// list has more. With a positive maxBytes, a list larger than maxBytes is not
+// decoded and errRLPListTooLarge is returned.
+func decodeRLPList[T any](ctx context.Context, payload []byte, maxItems, maxBytes int) ([]*T, error) {
+	if maxBytes > 0 && len(payload) > maxBytes {
+		return nil, errRLPListTooLarge
+	}
+	s := rlp.NewStream(bytes.NewReader(payload), 0)
+	if _, err := s.List(); err != nil {
+		return nil, err
+	}
+	var items []*T
+	for s.MoreDataInList() {
+		if err := ctx.Err(); err != nil {
+			return items, err
+		}
+		if maxItems > 0 && len(items) >= maxItems {
+			return items, errTooManyRLPItems
+		}
+		item := new(T)
+		if err := s.Decode(item); err != nil {
+			return items, err
 		}
+		items = append(items, item)
 	}
+	return items, s.ListEnd()
+}
 
-	if privToSign == nil {
-		return
+// BroadcastNewBlock sends the new block to the new block groups, as consensus.BroadcastNewBlock
+// called by the consensus leader.
+func BroadcastNewBlock(host p2p.Host, newBlock *types.Block, nodeConfig *nodeconfig.ConfigType) error {
+	return consensus.BroadcastNewBlock(host, newBlock, nodeConfig)
+}
+
+// groupDeliveryMonitor tracks the broadcast groups without peers, where messages are
+// not delivered although sending them succeeds.
+type groupDeliveryMonitor struct {
+	mu    sync.Mutex
+	empty map[nodeconfig.GroupID]bool
+}
+
+// check returns the groups without peers, warning when a group loses or regains its peers.
+func (m *groupDeliveryMonitor) check(host p2p.Host, groups []nodeconfig.GroupID) []nodeconfig.GroupID {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.empty == nil {
+		m.empty = make(map[nodeconfig.GroupID]bool)
 	}
-	instance := shard.Schedule.InstanceForEpoch(curBlock.Epoch())
-	for shardID := uint32(1); shardID < instance.NumShards(); shardID++ {
-		lastLink, err := node.Blockchain().ReadShardLastCrossLink(shardID)
-		if err != nil {
-			utils.Logger().Error().Err(err).Msg("[BroadcastCrossLinkSignal] failed to get crosslinks")
-			continue
-		} else if lastLink == nil {
-			continue
+	var empty []nodeconfig.GroupID
+	for _, group := range groups {
+		isEmpty := len(host.ListPeer(string(group))) == 0
+		if isEmpty {
+			empty = append(empty, group)
+			nodeP2PMessageCounterVec.With(prometheus.Labels{"type": "broadcast_no_group_peers"}).Inc()
 		}
-		hb := types.CrosslinkHeartbeat{
-			ShardID:                  lastLink.ShardID(),
-			LatestContinuousBlockNum: lastLink.BlockNum(),
-			Epoch:                    lastLink.Epoch().Uint64(),
-			PublicKey:                privToSign.Pub.Bytes[:],
-			Signature:                nil,
+		if isEmpty != m.empty[group] {
+			if isEmpty {
+				utils.Logger().Warn().Str("group", string(group)).
+					Msg("broadcasting to a group without peers, messages will not be delivered")
+			} else {
+				utils.Logger().Info().Str("group", string(group)).Msg("broadcast group has peers again")
+			}
 		}
+		m.empty[group] = isEmpty
+	}
+	return empty
+}
 
-		rs, err := rlp.EncodeToBytes(hb)
-		if err != nil {
-			utils.Logger().Error().Err(err).Msg("[BroadcastCrossLinkSignal] failed to encode signal")
+// defaultBroadcastBreakerCooldown is how long a group is not sent to after its breaker opened.
+const defaultBroadcastBreakerCooldown = 30 * time.Second
+
+var errBroadcastBreakerOpen = errors.New("broadcast circuit breaker is open for all groups")
+
+// broadcastBreaker stops sending to a group after consecutive send failures, trying
+// the group again once the cooldown passed.
+type broadcastBreaker struct {
+	mu       sync.Mutex
+	failures map[nodeconfig.GroupID]int
+	until    map[nodeconfig.GroupID]time.Time
+}
+
+// allow returns the groups which can be sent to at now.
+func (b *broadcastBreaker) allow(groups []nodeconfig.GroupID, now time.Time) []nodeconfig.GroupID {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	allowed := make([]nodeconfig.GroupID, 0, len(groups))
+	for _, group := range groups {
+		if until, ok := b.until[group]; ok && now.Before(until) {
 			continue
 		}
-		hb.Signature = privToSign.Pri.SignHash(rs).Serialize()
-		bts := proto_node.ConstructCrossLinkHeartBeatMessage(hb)
-		node.host.SendMessageToGroups(
-			[]nodeconfig.GroupID{nodeconfig.NewGroupIDByShardID(nodeconfig.ShardID(shardID))},
-			p2p.ConstructMessage(bts),
-		)
-	}
-}
-
-// getCrosslinkHeadersForShards get headers required for crosslink creation.
-func getCrosslinkHeadersForShards(shardChain core.BlockChain, curBlock *types.Block, crosslinks *crosslinks.Crosslinks) ([]*block.Header, error) {
-	var headers []*block.Header
-	signal := crosslinks.LastKnownCrosslinkHeartbeatSignal()
-	var latestBlockNum uint64
-
-	if signal == nil {
-		utils.Logger().Debug().Msg("[BroadcastCrossLink] no known crosslink heartbeat signal")
-		header := shardChain.GetHeaderByNumber(curBlock.NumberU64() - 2)
-		if header != nil && shardChain.Config().IsCrossLink(header.Epoch()) {
-			headers = append(headers, header)
+		allowed = append(allowed, group)
+	}
+	return allowed
+}
+
+// record records the outcome of a send to groups, opening the breaker of the groups with
+// threshold consecutive failures for cooldown. It returns the groups whose breaker opened.
+func (b *broadcastBreaker) record(
+	groups []nodeconfig.GroupID, err error, now time.Time, threshold int, cooldown time.Duration,
+) []nodeconfig.GroupID {
+	if cooldown <= 0 {
+		cooldown = defaultBroadcastBreakerCooldown
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures == nil {
+		b.failures = make(map[nodeconfig.GroupID]int)
+		b.until = make(map[nodeconfig.GroupID]time.Time)
+	}
+	var opened []nodeconfig.GroupID
+	for _, group := range groups {
+		if err == nil {
+			delete(b.failures, group)
+			delete(b.until, group)
+			continue
 		}
-		header = shardChain.GetHeaderByNumber(curBlock.NumberU64() - 1)
-		if header != nil && shardChain.Config().IsCrossLink(header.Epoch()) {
-			headers = append(headers, header)
+		b.failures[group]++
+		if b.failures[group] >= threshold {
+			b.until[group] = now.Add(cooldown)
+			opened = append(opened, group)
 		}
-		return append(headers, curBlock.Header()), nil
 	}
-	latestBlockNum = signal.LatestContinuousBlockNum
-	latest := crosslinks.LatestSentCrosslinkBlockNumber()
-	if latest > latestBlockNum && latest <= latestBlockNum+crossLinkBatchSize*6 {
-		latestBlockNum = latest
+	return opened
+}
+
+// status returns the state of the breaker of every group which failed since its last success.
+func (b *broadcastBreaker) status(now time.Time) map[string]rpc_common.BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make(map[string]rpc_common.BreakerStatus, len(b.failures))
+	for group, failures := range b.failures {
+		until := b.until[group]
+		out[string(group)] = rpc_common.BreakerStatus{
+			Open:      now.Before(until),
+			Failures:  failures,
+			OpenUntil: until,
+		}
 	}
+	return out
+}
 
-	batchSize := crossLinkBatchSize
-	diff := curBlock.Number().Uint64() - latestBlockNum
+// reset closes the breaker of group, returning false if it had no failures.
+func (b *broadcastBreaker) reset(group nodeconfig.GroupID) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	// Increase batch size by 1 for every 5 blocks behind
-	batchSize += int(diff) / 5
+	_, ok := b.failures[group]
+	delete(b.failures, group)
+	delete(b.until, group)
+	return ok
+}
+
+// sendToGroups sends msg to groups, watching for groups without peers.
+// All sends reach the full group, as the host cannot limit the fanout of low priority
+// messages such as the crosslink heartbeats to a subset of the group peers.
+// Groups whose broadcast breaker is open are skipped.
+func (node *Node) sendToGroups(groups []nodeconfig.GroupID, msg []byte) error {
+	node.groupMonitor.check(node.host, groups)
+	threshold := node.NodeConfig.Handler.BroadcastBreakerThreshold
+	if threshold <= 0 {
+		return node.host.SendMessageToGroups(groups, msg)
+	}
 
-	// Cap at a sane size to avoid overload network
-	if batchSize > crossLinkBatchSize*2 {
-		batchSize = crossLinkBatchSize * 2
+	now := time.Now()
+	allowed := node.broadcastBreaker.allow(groups, now)
+	if len(allowed) < len(groups) {
+		nodeP2PMessageCounterVec.With(prometheus.Labels{"type": "broadcast_breaker_open"}).Inc()
+	}
+	if len(allowed) == 0 {
+		return errBroadcastBreakerOpen
 	}
+	err := node.host.SendMessageToGroups(allowed, msg)
+	opened := node.broadcastBreaker.record(
+		allowed, err, now, threshold, node.NodeConfig.Handler.BroadcastBreakerCooldown,
+	)
+	for _, group := range opened {
+		utils.Logger().Warn().Err(err).Str("group", string(group)).
+			Msg("broadcast circuit breaker opened after repeated send failures")
+	}
+	return err
+}
+
+const (
+	// defaultSlashSendRetries is the default number of retries of a failed slash record message.
+	defaultSlashSendRetries = 3
+	// defaultSlashSendBackoff is the default delay before the first retry of a slash record message.
+	defaultSlashSendBackoff = 500 * time.Millisecond
+)
+
+// BroadcastSlash verifies the slash record witness against the beacon chain and sends it
+// to the beacon chain, as BroadcastSlashBatch does.
+func (node *Node) BroadcastSlash(witness *slash.Record) error {
+	return node.BroadcastSlashBatch(slash.Records{*witness})
+}
+
+// BroadcastSlashBatch verifies the slash records against the beacon chain and sends the
+// valid ones to the beacon chain in a single message. Invalid records are not sent, so
+// that records of any source can be broadcast, and an error is returned for them. Records
+// of a double sign already sent within the dedup window are skipped. A failed send is
+// retried with exponential backoff, as a double sign which doesn't reach the beacon chain
+// goes unpunished.
+func (node *Node) BroadcastSlashBatch(records slash.Records) error {
+	return node.broadcastSlashBatch(node.Beaconchain(), records)
+}
+
+func (node *Node) broadcastSlash(beacon core.BlockChain, witness *slash.Record) error {
+	return node.broadcastSlashBatch(beacon, slash.Records{*witness})
+}
 
-	for blockNum := latestBlockNum + 1; blockNum <= curBlock.NumberU64(); blockNum++ {
-		header := shardChain.GetHeaderByNumber(blockNum)
-		if header != nil && shardChain.Config().IsCrossLink(header.Epoch()) {
-			headers = append(headers, header)
-			if len(headers) == batchSize {
-				break
+func (node *Node) broadcastSlashBatch(beacon core.BlockChain, records slash.Records) error {
+	conf := node.NodeConfig.Handler
+	now := time.Now()
+	batch := make(slash.Records, 0, len(records))
+	keys := make([]common.Hash, 0, len(records))
+	var invalid error
+	invalidCount := 0
+	for i := range records {
+		if err := node.verifySlash(beacon, &records[i]); err != nil {
+			nodeSlashBroadcastCounterVec.With(prometheus.Labels{"outcome": "invalid"}).Inc()
+			if invalid == nil {
+				invalid = err
 			}
+			invalidCount++
+			continue
+		}
+		key := slashEvidenceKey(&records[i])
+		if !node.slashesSent.claim(key, now, conf.SlashDedupSize, conf.SlashDedupTTL) {
+			nodeSlashBroadcastCounterVec.With(prometheus.Labels{"outcome": "duplicate"}).Inc()
+			utils.Logger().Debug().Str("evidence", key.Hex()).Msg("slash record already broadcast")
+			continue
+		}
+		batch = append(batch, records[i])
+		keys = append(keys, key)
+	}
+	if invalid != nil {
+		invalid = errors.WithMessagef(invalid, "%d of %d slash records", invalidCount, len(records))
+	}
+	if len(batch) == 0 {
+		return invalid
+	}
+
+	retries := conf.SlashSendRetries
+	if retries == 0 {
+		retries = defaultSlashSendRetries
+	}
+	backoff := conf.SlashSendBackoff
+	if backoff <= 0 {
+		backoff = defaultSlashSendBackoff
+	}
+	if err := node.sendWithRetries(
+		[]nodeconfig.GroupID{nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID)},
+		p2p.ConstructMessage(proto_node.ConstructSlashMessage(batch)),
+		retries, backoff,
+		func(attempt int, err error) {
+			nodeSlashBroadcastCounterVec.With(prometheus.Labels{"outcome": "retry"}).Inc()
+			utils.Logger().Warn().Err(err).
+				Int("attempt", attempt).
+				Int("records", len(batch)).
+				Msg("retrying failed slash records message")
+		},
+	); err != nil {
+		for _, key := range keys {
+			node.slashesSent.release(key)
+		}
+		nodeSlashBroadcastCounterVec.With(prometheus.Labels{"outcome": "send_failed"}).Add(float64(len(batch)))
+		return errors.WithMessage(err, "could not send slash records to beaconchain")
+	}
+	nodeSlashBroadcastCounterVec.With(prometheus.Labels{"outcome": "sent"}).Add(float64(len(batch)))
+	utils.Logger().Info().Int("records", len(batch)).Msg("broadcast the double sign records")
+	return invalid
+}
+
+// sendWithRetries sends msg to groups, retrying a failed send up to retries times with a
+// delay of backoff doubled on each retry. retried is called before each retry. Sends refused
+// by the circuit breaker are not retried, and the retries stop once the node shuts down.
+func (node *Node) sendWithRetries(
+	groups []nodeconfig.GroupID, msg []byte, retries int, backoff time.Duration, retried func(attempt int, err error),
+) error {
+	for attempt := 0; ; attempt++ {
+		err := node.sendToGroups(groups, msg)
+		if err == nil || attempt >= retries || errors.Is(err, errBroadcastBreakerOpen) {
+			return err
 		}
+		retried(attempt+1, err)
+		timer := time.NewTimer(backoff << attempt)
+		select {
+		case <-timer.C:
+		case <-node.shutdown.context().Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+const (
+	// defaultBootstrapTimeout is how long consensus bootstrap waits for enough peers.
+	defaultBootstrapTimeout = time.Minute
+	// defaultBootstrapCheckInterval is the delay before the first peer count check of
+	// consensus bootstrap.
+	defaultBootstrapCheckInterval = time.Second
+	// defaultBootstrapCheckIntervalMin is the delay between peer count checks after the
+	// number of peers grew.
+	defaultBootstrapCheckIntervalMin = time.Second
+	// defaultBootstrapCheckIntervalMax is the longest delay between peer count checks.
+	defaultBootstrapCheckIntervalMax = 10 * time.Second
+	// defaultBootstrapStableChecks is the number of consecutive peer count checks which
+	// must reach the min peers, one starts consensus on the first check reaching them.
+	defaultBootstrapStableChecks = 1
+)
+
+// peerCheckBackoff computes the delays between the peer count checks of consensus bootstrap.
+// The delay doubles up to max while the number of peers does not grow, and goes back to min
+// once it does.
+type peerCheckBackoff struct {
+	initial, min, max time.Duration
+	last              time.Duration
+	lastPeers         int
+}
+
+// newPeerCheckBackoff returns the backoff for the given delays, a non positive delay uses the default.
+func newPeerCheckBackoff(initial, min, max time.Duration) *peerCheckBackoff {
+	if initial <= 0 {
+		initial = defaultBootstrapCheckInterval
+	}
+	if min <= 0 {
+		min = defaultBootstrapCheckIntervalMin
+	}
+	if max <= 0 {
+		max = defaultBootstrapCheckIntervalMax
 	}
+	if max < min {
+		max = min
+	}
+	return &peerCheckBackoff{initial: initial, min: min, max: max, last: initial}
+}
 
-	return headers, nil
+// next returns the delay before the next check, given the number of peers at the last check.
+func (b *peerCheckBackoff) next(peers int) time.Duration {
+	if peers > b.lastPeers {
+		b.last = b.min
+	} else if b.last *= 2; b.last > b.max {
+		b.last = b.max
+	}
+	b.lastPeers = peers
+	return b.last
 }
 
 // BootstrapConsensus is a goroutine to check number of peers and start the consensus
 func (node *Node) BootstrapConsensus() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	conf := node.NodeConfig.Handler
+	timeout := conf.BootstrapTimeout
+	if timeout <= 0 {
+		timeout = defaultBootstrapTimeout
+	}
+	backoff := newPeerCheckBackoff(
+		conf.BootstrapCheckInterval, conf.BootstrapCheckIntervalMin, conf.BootstrapCheckIntervalMax,
+	)
+	stableChecks := conf.BootstrapStableChecks
+	if stableChecks <= 0 {
+		stableChecks = defaultBootstrapStableChecks
+	}
+	err := node.waitForMinPeers(node.shutdown.context(), timeout, stableChecks, backoff)
+	if err != nil && !(errors.Is(err, context.DeadlineExceeded) && node.closeToMinPeers(conf.BootstrapPeerTolerance)) {
+		return err
+	}
+	node.goroutines.track(func() {
+		node.Consensus.StartChannel()
+	})
+	return nil
+}
+
+// closeToMinPeers returns whether the node is connected to at least the consensus min peers
+// less tolerance, so that consensus starts anyway once bootstrap timed out.
+func (node *Node) closeToMinPeers(tolerance int) bool {
+	if tolerance <= 0 {
+		return false
+	}
+	connectedPeers := len(node.host.Network().Peers())
+	min := node.Consensus.MinPeers
+	if connectedPeers < min-tolerance {
+		return false
+	}
+	utils.Logger().Warn().
+		Int("connectedPeers", connectedPeers).
+		Int("targetNumPeers", min).
+		Int("tolerance", tolerance).
+		Msg("[bootstrap] starting consensus short of min peers after timeout")
+	return true
+}
+
+// peerConnections describes the peers a node is connected to.
+type peerConnections struct {
+	IDs []string
+	// ByShard is the number of peers of each shard, as reported by their chain info
+	ByShard map[uint32]int
+	// UnknownShard is the number of peers which did not report their chain info
+	UnknownShard int
+}
+
+// connectedPeersInfo returns the IDs of peers and their number by shard, to tell whether
+// the node is connected to the peers of the right shard.
+func (node *Node) connectedPeersInfo(peers []libp2p_peer.ID) peerConnections {
+	info := peerConnections{IDs: make([]string, 0, len(peers)), ByShard: make(map[uint32]int)}
+	for _, peer := range peers {
+		info.IDs = append(info.IDs, peer.String())
+		if chainInfo, ok := node.PeerChainInfo(peer); ok {
+			info.ByShard[chainInfo.ShardID]++
+		} else {
+			info.UnknownShard++
+		}
+	}
+	return info
+}
+
+// waitForMinPeers waits until the node is connected to the consensus min peers for
+// stableChecks consecutive checks, checking with the delays of backoff. Once the min peers
+// are reached, the following checks are spaced by the backoff min delay. It gives up after
+// timeout or once ctx is done. The delays and the timeout are measured by the node clock.
+func (node *Node) waitForMinPeers(ctx context.Context, timeout time.Duration, stableChecks int, backoff *peerCheckBackoff) error {
+	clk := node.getClock()
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	deadline := clk.NewTimer(timeout)
+	defer deadline.Stop()
 	min := node.Consensus.MinPeers
+	// buffered so that the peer check never blocks once bootstrap gave up
 	enoughMinPeers := make(chan struct{}, 1)
-	const checkEvery = 3 * time.Second
-	go func() {
+	node.goroutines.track(func() {
+		delay := backoff.initial
+		stable := 0
 		for {
-			<-time.After(checkEvery)
+			timer := clk.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.Ch():
+			}
 			numPeersNow := node.host.GetPeerCount()
-			connectedPeers := len(node.host.Network().Peers())
+			peers := node.host.Network().Peers()
+			connectedPeers := len(peers)
 			if connectedPeers >= min {
-				utils.Logger().Info().Msg("[bootstrap] StartConsensus")
-				enoughMinPeers <- struct{}{}
-				fmt.Printf("Bootstrap consensus done. Connected %d, known %d, shard: %d\n", connectedPeers, numPeersNow, node.Consensus.ShardID)
-				return
+				if stable++; stable >= stableChecks {
+					utils.Logger().Info().Msg("[bootstrap] StartConsensus")
+					enoughMinPeers <- struct{}{}
+					fmt.Printf("Bootstrap consensus done. Connected %d, known %d, shard: %d\n", connectedPeers, numPeersNow, node.Consensus.ShardID)
+					return
+				}
+				utils.Logger().Info().
+					Int("numPeersNow", numPeersNow).
+					Int("targetNumPeers", min).
+					Int("stableChecks", stable).
+					Int("targetStableChecks", stableChecks).
+					Msg("[bootstrap] reached min peers, waiting for them to be stable")
+				delay = backoff.min
+				continue
 			}
+			stable = 0
+			if node.sendsMessageVersion2() {
+				if err := node.requestChainInfo(); err != nil {
+					utils.Logger().Debug().Err(err).Msg("[bootstrap] unable to request chain info")
+				}
+			}
+			checkIn := backoff.next(connectedPeers)
 			utils.Logger().Info().
 				Int("numPeersNow", numPeersNow).
 				Int("targetNumPeers", min).
-				Dur("next-peer-count-check-in-seconds", checkEvery).
+				Dur("next-peer-count-check-in-seconds", checkIn).
 				Msg("do not have enough min peers yet in bootstrap of consensus")
+			if e := utils.Logger().Debug(); e.Enabled() {
+				info := node.connectedPeersInfo(peers)
+				e.Strs("peers", info.IDs).
+					Interface("peersByShard", info.ByShard).
+					Int("peersOfUnknownShard", info.UnknownShard).
+					Msg("[bootstrap] connected peers")
+			}
+			delay = checkIn
 		}
-	}()
+	})
 
 	select {
+	case <-deadline.Ch():
+		utils.Logger().Warn().
+			Int("targetNumPeers", min).
+			Dur("timeout", timeout).
+			Msg("[bootstrap] timed out waiting for min peers")
+		return context.DeadlineExceeded
 	case <-ctx.Done():
+		utils.Logger().Info().Msg("[bootstrap] cancelled while waiting for min peers")
 		return ctx.Err()
 	case <-enoughMinPeers:
-		go func() {
-			node.Consensus.StartChannel()
-		}()
+		utils.Logger().Info().Int("targetNumPeers", min).Msg("[bootstrap] reached min peers")
 		return nil
 	}
 }
@@ -1,10 +1,25 @@
 package node
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
 	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	"github.com/harmony-one/harmony/block"
+	blockfactory "github.com/harmony-one/harmony/block/factory"
+	"github.com/harmony-one/harmony/common/clock"
 	"github.com/harmony-one/harmony/consensus"
 	"github.com/harmony-one/harmony/consensus/quorum"
 	"github.com/harmony-one/harmony/core"
@@ -12,13 +27,20 @@ import (
 	"github.com/harmony-one/harmony/crypto/bls"
 	"github.com/harmony-one/harmony/internal/chain"
 	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/params"
 	"github.com/harmony-one/harmony/internal/registry"
 	"github.com/harmony-one/harmony/internal/shardchain"
 	"github.com/harmony-one/harmony/internal/utils"
+	"github.com/harmony-one/harmony/internal/utils/crosslinks"
 	"github.com/harmony-one/harmony/multibls"
 	"github.com/harmony-one/harmony/p2p"
 	"github.com/harmony-one/harmony/shard"
 	staking "github.com/harmony-one/harmony/staking/types"
+	libp2p_network "github.com/libp2p/go-libp2p/core/network"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
 )
 
 func TestAddNewBlock(t *testing.T) {
@@ -219,3 +241,2507 @@ func TestVerifyVRF(t *testing.T) {
 		t.Error("New vrf is not verified successfully:", err)
 	}
 }
+
+func TestDecodeRLPListPartial(t *testing.T) {
+	tx1 := types.NewTransaction(1, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	tx2 := types.NewTransaction(2, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	enc1, _ := rlp.EncodeToBytes(tx1)
+	enc2, _ := rlp.EncodeToBytes(tx2)
+	garbage, _ := rlp.EncodeToBytes(uint64(7))
+
+	payload, err := rlp.EncodeToBytes([]rlp.RawValue{enc1, enc2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, err := decodeRLPList[types.Transaction](context.Background(), payload, 0, 0)
+	if err != nil || len(txs) != 2 {
+		t.Fatalf("expected 2 transactions without error, got %d, %v", len(txs), err)
+	}
+
+	payload, err = rlp.EncodeToBytes([]rlp.RawValue{enc1, enc2, garbage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs, err = decodeRLPList[types.Transaction](context.Background(), payload, 0, 0)
+	if err == nil {
+		t.Fatal("expected decode error for malformed item")
+	}
+	if len(txs) != 2 || txs[0].Hash() != tx1.Hash() || txs[1].Hash() != tx2.Hash() {
+		t.Fatalf("expected the 2 valid transactions before the malformed one, got %d", len(txs))
+	}
+}
+
+func TestDecodeRLPListMaxItems(t *testing.T) {
+	var items []rlp.RawValue
+	for i := uint64(0); i < 5; i++ {
+		enc, _ := rlp.EncodeToBytes(types.NewTransaction(i, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil))
+		items = append(items, enc)
+	}
+	payload, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txs, err := decodeRLPList[types.Transaction](context.Background(), payload, 3, 0)
+	if err != errTooManyRLPItems || len(txs) != 3 {
+		t.Fatalf("expected 3 transactions and a too many items error, got %d, %v", len(txs), err)
+	}
+	txs, err = decodeRLPList[types.Transaction](context.Background(), payload, 5, 0)
+	if err != nil || len(txs) != 5 {
+		t.Fatalf("expected 5 transactions without error, got %d, %v", len(txs), err)
+	}
+	if txs, err = decodeRLPList[types.Transaction](context.Background(), payload, 0, len(payload)-1); err != errRLPListTooLarge || len(txs) != 0 {
+		t.Fatalf("expected a too large error without transactions, got %d, %v", len(txs), err)
+	}
+}
+
+func TestTransactionMessageOversized(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.MaxTxsPerMessage = 2
+
+	var items []rlp.RawValue
+	for i := uint64(0); i < 3; i++ {
+		enc, _ := rlp.EncodeToBytes(types.NewTransaction(i, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil))
+		items = append(items, enc)
+	}
+	list, err := rlp.EncodeToBytes(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := withMessagePeer(context.Background(), "peer")
+	payload := append([]byte{byte(proto_node.Send)}, list...)
+	if err := node.transactionMessageHandler(ctx, payload); !errors.Is(err, errTooManyRLPItems) {
+		t.Errorf("expected the list with too many transactions rejected, got %v", err)
+	}
+
+	// a list larger than the bound is rejected before decoding
+	node.NodeConfig.Handler.MaxTxsPerMessage = 0
+	node.NodeConfig.Handler.MaxTxListBytes = 64
+	payload = append([]byte{byte(proto_node.Send), 0xfb, 0xff, 0xff, 0xff, 0xff}, make([]byte, 64)...)
+	if err := node.transactionMessageHandler(ctx, payload); !errors.Is(err, errRLPListTooLarge) {
+		t.Errorf("expected the oversized list rejected, got %v", err)
+	}
+}
+
+// recordingHost is a p2p.Host recording the messages sent to groups and peers.
+type recordingHost struct {
+	p2p.Host
+	mu    sync.Mutex
+	sent  []sentMessage
+	calls int
+	err   error
+}
+
+type sentMessage struct {
+	groups []nodeconfig.GroupID
+	peer   libp2p_peer.ID
+	msg    []byte
+}
+
+func (h *recordingHost) ListPeer(string) []libp2p_peer.ID {
+	return nil
+}
+
+func (h *recordingHost) SendMessageToGroups(groups []nodeconfig.GroupID, msg []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sent = append(h.sent, sentMessage{groups: groups, msg: msg})
+	h.calls++
+	return h.err
+}
+
+func (h *recordingHost) SendMessageToPeer(_ context.Context, id libp2p_peer.ID, msg []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sent = append(h.sent, sentMessage{peer: id, msg: msg})
+	h.calls++
+	return h.err
+}
+
+func (h *recordingHost) sendCalls() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.calls
+}
+
+func (h *recordingHost) sentMessages() []sentMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]sentMessage{}, h.sent...)
+}
+
+// decodeSyncBlocks decodes the blocks of a p2p block sync message.
+func decodeSyncBlocks(t *testing.T, msg []byte) []*types.Block {
+	var blocks []*types.Block
+	if err := rlp.DecodeBytes(msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize+1:], &blocks); err != nil {
+		t.Fatalf("cannot decode block sync message: %v", err)
+	}
+	return blocks
+}
+
+func newTestBlock(shardID uint32, num int64) *types.Block {
+	return types.NewBlockWithHeader(
+		blockfactory.NewTestHeader().With().ShardID(shardID).Number(big.NewInt(num)).Header(),
+	)
+}
+
+func TestCheckSyncBlocksHeight(t *testing.T) {
+	burst := func(nums ...int64) []*types.Block {
+		blocks := make([]*types.Block, len(nums))
+		for i, num := range nums {
+			blocks[i] = newTestBlock(0, num)
+		}
+		return blocks
+	}
+	const head = 100
+	for _, test := range []struct {
+		name   string
+		blocks []*types.Block
+		want   error
+	}{
+		{"burst crossing the head", burst(97, 98, 99, 100, 101), nil},
+		{"burst up to the head", burst(99, 100), errIgnoreBeaconMsg},
+		{"burst behind the head", burst(96, 97, 98), errBeaconBlockTooOld},
+		{"next block", burst(101), nil},
+		{"old block", burst(98), errBeaconBlockTooOld},
+	} {
+		if err := checkSyncBlocksHeight(test.blocks, head); err != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+		}
+	}
+}
+
+// newTestBlockWithTxs returns a block of n signed transfers and contract calls, as in
+// a busy mainnet block.
+func newTestBlockWithTxs(tb testing.TB, n int) *types.Block {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1666600000))
+	txs := make([]*types.Transaction, n)
+	receipts := make([]*types.Receipt, n)
+	for i := range txs {
+		var data []byte
+		if i%4 == 0 {
+			// an ERC20 transfer call
+			data = append(common.FromHex("a9059cbb"), common.LeftPadBytes(big.NewInt(int64(i)).Bytes(), 64)...)
+		}
+		to := common.BigToAddress(big.NewInt(int64(i % 16)))
+		tx := types.NewTransaction(uint64(i), to, 0, big.NewInt(1e18), 60000, big.NewInt(100e9), data)
+		if txs[i], err = types.SignTx(tx, signer, key); err != nil {
+			tb.Fatal(err)
+		}
+		receipts[i] = &types.Receipt{}
+	}
+	header := blockfactory.NewTestHeader().With().Number(big.NewInt(1)).Header()
+	return types.NewBlock(header, txs, receipts, nil, nil, nil)
+}
+
+// openVersion2 returns the node message wrapped in the version 2 envelope msg.
+func openVersion2(tb testing.TB, msg []byte) []byte {
+	version, inner, err := proto_node.OpenEnvelope(msg)
+	if err != nil || version != proto_node.MessageVersion2 {
+		tb.Fatalf("expected a version 2 envelope, got version %d, %v", version, err)
+	}
+	return inner
+}
+
+func TestBlocksSyncCompressed(t *testing.T) {
+	block := newTestBlockWithTxs(t, 20)
+
+	plain := proto_node.ConstructBlocksSyncMessageCompressed([]*types.Block{block}, 0)
+	if plain[p2pNodeMsgPrefixSize] != byte(proto_node.Sync) {
+		t.Fatalf("expected a plain sync message with compression disabled, got type %d", plain[p2pNodeMsgPrefixSize])
+	}
+	small := proto_node.ConstructBlocksSyncMessageCompressed([]*types.Block{block}, len(plain)*2)
+	if small[p2pNodeMsgPrefixSize] != byte(proto_node.Sync) {
+		t.Fatalf("expected a plain sync message below the threshold, got type %d", small[p2pNodeMsgPrefixSize])
+	}
+
+	compressed := openVersion2(t, proto_node.ConstructBlocksSyncMessageCompressed([]*types.Block{block}, 1))
+	if compressed[p2pNodeMsgPrefixSize] != byte(proto_node.SyncCompressed) {
+		t.Fatalf("expected a compressed sync message, got type %d", compressed[p2pNodeMsgPrefixSize])
+	}
+	blocks, err := decodeBlocksSync(context.Background(), proto_node.SyncCompressed, compressed[p2pNodeMsgPrefixSize+1:], 0, 0)
+	if err != nil || len(blocks) != 1 || blocks[0].Hash() != block.Hash() {
+		t.Fatalf("expected the block back, got %d, %v", len(blocks), err)
+	}
+	if _, err := decodeBlocksSync(context.Background(), proto_node.SyncCompressed, plain[p2pNodeMsgPrefixSize+1:], 0, 0); err == nil {
+		t.Error("uncompressed payload decoded as compressed")
+	}
+}
+
+func TestBlocksSyncOversized(t *testing.T) {
+	blocks := make([]*types.Block, 5)
+	for i := range blocks {
+		blocks[i] = newTestBlock(0, int64(i+1))
+	}
+	plain := proto_node.ConstructBlocksSyncMessageCompressed(blocks, 0)[p2pNodeMsgPrefixSize+1:]
+	compressed := openVersion2(t, proto_node.ConstructBlocksSyncMessageCompressed(blocks, 1))[p2pNodeMsgPrefixSize+1:]
+
+	tests := []struct {
+		name      string
+		msgType   proto_node.BlockMessageType
+		payload   []byte
+		maxBlocks int
+		maxBytes  int
+		wantErr   error
+	}{
+		{"too many blocks", proto_node.Sync, plain, 3, 0, errTooManyRLPItems},
+		{"too many compressed blocks", proto_node.SyncCompressed, compressed, 3, 0, errTooManyRLPItems},
+		{"too large", proto_node.Sync, plain, 0, len(plain) - 1, errRLPListTooLarge},
+		{"too large decompressed", proto_node.SyncCompressed, compressed, 0, len(plain) - 1, errRLPListTooLarge},
+		{"within limits", proto_node.Sync, plain, 5, len(plain), nil},
+	}
+	for _, test := range tests {
+		decoded, err := decodeBlocksSync(context.Background(), test.msgType, test.payload, test.maxBlocks, test.maxBytes)
+		if err != test.wantErr {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+		if test.wantErr != nil && decoded != nil {
+			t.Errorf("%s: expected the whole message rejected, got %d blocks", test.name, len(decoded))
+		} else if test.wantErr == nil && len(decoded) != len(blocks) {
+			t.Errorf("%s: expected %d blocks, got %d", test.name, len(blocks), len(decoded))
+		}
+	}
+
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{Handler: nodeconfig.HandlerConfig{MaxSyncBlocksPerMessage: 3}}}
+	key := `hmy_p2p_node_msg{type="block_sync_oversized"}`
+	before := node.MetricsSnapshot()[key]
+	if err := node.handleBlocksSync(context.Background(), proto_node.Sync, plain); err != nil {
+		t.Fatal(err)
+	}
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected the oversized message to be counted, got %v -> %v", before, after)
+	}
+}
+
+// BenchmarkBlocksSyncCompression compares building and decoding a busy block broadcast
+// with and without compression, and reports the size of the message sent.
+func BenchmarkBlocksSyncCompression(b *testing.B) {
+	blocks := []*types.Block{newTestBlockWithTxs(b, 500)}
+	for _, bench := range []struct {
+		name      string
+		threshold int
+	}{
+		{"plain", 0},
+		{"compressed", 1},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			var size int
+			for i := 0; i < b.N; i++ {
+				msg := proto_node.ConstructBlocksSyncMessageCompressed(blocks, bench.threshold)
+				size = len(msg)
+				_, msg, _ = proto_node.OpenEnvelope(msg)
+				msgType := proto_node.BlockMessageType(msg[p2pNodeMsgPrefixSize])
+				if _, err := decodeBlocksSync(context.Background(), msgType, msg[p2pNodeMsgPrefixSize+1:], 0, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size), "msg-bytes")
+		})
+	}
+}
+
+func TestTransactionListCompressed(t *testing.T) {
+	txs := newTestBlockWithTxs(t, 20).Transactions()
+
+	plain := proto_node.ConstructTransactionListMessageCompressed(txs, 0)
+	if plain[p2pNodeMsgPrefixSize] != byte(proto_node.Send) {
+		t.Fatalf("expected a plain transaction list with compression disabled, got type %d", plain[p2pNodeMsgPrefixSize])
+	}
+	small := proto_node.ConstructTransactionListMessageCompressed(txs, len(plain)*2)
+	if small[p2pNodeMsgPrefixSize] != byte(proto_node.Send) {
+		t.Fatalf("expected a plain transaction list below the threshold, got type %d", small[p2pNodeMsgPrefixSize])
+	}
+
+	compressed := openVersion2(t, proto_node.ConstructTransactionListMessageCompressed(txs, 1))
+	if compressed[p2pNodeMsgPrefixSize] != byte(proto_node.SendCompressed) {
+		t.Fatalf("expected a compressed transaction list, got type %d", compressed[p2pNodeMsgPrefixSize])
+	}
+	for _, msg := range [][]byte{plain, compressed} {
+		msgType := proto_node.TransactionMessageType(msg[p2pNodeMsgPrefixSize])
+		decoded, err := decodeTxList(context.Background(), msgType, msg[p2pNodeMsgPrefixSize+1:], 0, defaultMaxTxListBytes)
+		if err != nil || len(decoded) != len(txs) {
+			t.Fatalf("type %d: expected %d transactions back, got %d, %v", msgType, len(txs), len(decoded), err)
+		}
+		for i, tx := range decoded {
+			if tx.Hash() != txs[i].Hash() {
+				t.Fatalf("type %d: transaction %d changed", msgType, i)
+			}
+		}
+	}
+	if _, err := decodeTxList(context.Background(), proto_node.SendCompressed, plain[p2pNodeMsgPrefixSize+1:], 0, defaultMaxTxListBytes); err == nil {
+		t.Error("uncompressed payload decoded as compressed")
+	}
+	_, err := decodeTxList(context.Background(), proto_node.SendCompressed, compressed[p2pNodeMsgPrefixSize+1:], 0, len(plain)-p2pNodeMsgPrefixSize-2)
+	if !isOversizedRLPList(err) {
+		t.Errorf("expected a transaction list too large decompressed to be rejected, got %v", err)
+	}
+}
+
+func TestTxGossipCompressThreshold(t *testing.T) {
+	head := blockfactory.NewTestHeader().With().ShardID(1).Epoch(big.NewInt(2)).Header()
+	node := &Node{
+		NodeConfig: &nodeconfig.ConfigType{},
+		registry:   registry.New().SetBlockchain(upgradeChain{headChain{headerChain{shardID: 1}, head}, big.NewInt(3)}),
+	}
+	node.NodeConfig.Handler.TxGossipCompressThreshold = 100
+	if n := node.txGossipCompressThreshold(); n != 0 {
+		t.Errorf("expected compression off before the message version 2 epoch, got threshold %d", n)
+	}
+	node.registry.SetBlockchain(upgradeChain{headChain{headerChain{shardID: 1}, head}, big.NewInt(2)})
+	if n := node.txGossipCompressThreshold(); n != 100 {
+		t.Errorf("expected the configured threshold, got %d", n)
+	}
+	node.NodeConfig.Handler.TxGossipCompressThreshold = 0
+	if n := node.txGossipCompressThreshold(); n != defaultTxGossipCompressThreshold {
+		t.Errorf("expected the default threshold, got %d", n)
+	}
+	node.NodeConfig.Handler.TxGossipCompressThreshold = -1
+	if n := node.txGossipCompressThreshold(); n != 0 {
+		t.Errorf("expected a negative threshold to disable compression, got %d", n)
+	}
+}
+
+// upgradeChain is a head chain sending the node messages of version 2 from epoch.
+type upgradeChain struct {
+	headChain
+	epoch *big.Int
+}
+
+func (c upgradeChain) Config() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.MessageVersion2Epoch = c.epoch
+	return &config
+}
+
+// BenchmarkTransactionListCompression reports the size of a 500 transaction gossip
+// message with and without compression.
+func BenchmarkTransactionListCompression(b *testing.B) {
+	txs := newTestBlockWithTxs(b, 500).Transactions()
+	plain := len(proto_node.ConstructTransactionListMessageCompressed(txs, 0))
+	b.ResetTimer()
+
+	var compressed int
+	for i := 0; i < b.N; i++ {
+		compressed = len(proto_node.ConstructTransactionListMessageCompressed(txs, 1))
+	}
+	b.ReportMetric(float64(plain), "plain-bytes")
+	b.ReportMetric(float64(compressed), "compressed-bytes")
+	b.ReportMetric(float64(compressed)/float64(plain), "ratio")
+}
+
+func TestBroadcastNewBlockGroups(t *testing.T) {
+	host := &recordingHost{}
+	conf := &nodeconfig.ConfigType{}
+	conf.SetClientGroupID("client")
+
+	BroadcastNewBlock(host, newTestBlock(1, 1), conf)
+	sent := host.sentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(sent))
+	}
+	syncGroup := nodeconfig.SyncGroupIDForShard(1)
+	if g := sent[0].groups; len(g) != 2 || g[0] != "client" || g[1] != syncGroup {
+		t.Errorf("expected the block sent to [client %s], got %v", syncGroup, g)
+	}
+
+	conf.Handler.NewBlockSkipSyncGroup = true
+	BroadcastNewBlock(host, newTestBlock(1, 2), conf)
+	sent = host.sentMessages()
+	if g := sent[len(sent)-1].groups; len(g) != 1 || g[0] != "client" {
+		t.Errorf("expected the block sent to [client], got %v", g)
+	}
+}
+
+func TestBroadcastNewBlockConfiguredGroups(t *testing.T) {
+	host := &recordingHost{}
+	conf := &nodeconfig.ConfigType{}
+	conf.SetClientGroupID("client")
+	conf.Handler.NewBlockSkipSyncGroup = true
+	conf.Handler.NewBlockExtraGroups = []nodeconfig.GroupID{"explorer", "bridge"}
+
+	if err := BroadcastNewBlock(host, newTestBlock(1, 1), conf); err != nil {
+		t.Fatal(err)
+	}
+	sent := host.sentMessages()
+	if len(sent) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(sent))
+	}
+	if g := sent[0].groups; !slices.Equal(g, []nodeconfig.GroupID{"client", "explorer", "bridge"}) {
+		t.Errorf("expected the block sent to [client explorer bridge], got %v", g)
+	}
+	if blocks := decodeSyncBlocks(t, sent[0].msg); len(blocks) != 1 || blocks[0].NumberU64() != 1 {
+		t.Errorf("expected block 1 in the message, got %d blocks", len(blocks))
+	}
+
+	// without client group and extra groups there is nowhere to send the block to
+	conf = &nodeconfig.ConfigType{}
+	conf.Handler.NewBlockSkipSyncGroup = true
+	if err := BroadcastNewBlock(host, newTestBlock(1, 2), conf); !errors.Is(err, nodeconfig.ErrNoNewBlockGroups) {
+		t.Errorf("expected no new block groups error, got %v", err)
+	}
+	if n := len(host.sentMessages()); n != 1 {
+		t.Errorf("expected no message without groups, got %d", n-1)
+	}
+}
+
+func TestBroadcastNewBlockError(t *testing.T) {
+	host := &recordingHost{err: errors.New("send failed")}
+	conf := &nodeconfig.ConfigType{}
+
+	if err := BroadcastNewBlock(host, newTestBlock(0, 1), conf); !errors.Is(err, host.err) {
+		t.Fatalf("expected the host error, got %v", err)
+	}
+	host.err = nil
+	if err := BroadcastNewBlock(host, newTestBlock(0, 2), conf); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestBroadcastNewBlockDisabled(t *testing.T) {
+	host := &recordingHost{}
+	conf := &nodeconfig.ConfigType{}
+
+	conf.SetBlockBroadcastEnabled(false)
+	BroadcastNewBlock(host, newTestBlock(0, 1), conf)
+	if n := len(host.sentMessages()); n != 0 {
+		t.Fatalf("expected no message while block broadcast is disabled, got %d", n)
+	}
+
+	conf.SetBlockBroadcastEnabled(true)
+	BroadcastNewBlock(host, newTestBlock(0, 2), conf)
+	if n := len(host.sentMessages()); n != 1 {
+		t.Fatalf("expected 1 message once block broadcast is enabled, got %d", n)
+	}
+}
+
+func TestCrossLinkBroadcastStarved(t *testing.T) {
+	start := time.Unix(1000, 0)
+	node := &Node{
+		NodeConfig:          &nodeconfig.ConfigType{},
+		crosslinks:          crosslinks.New(),
+		unixTimeAtNodeStart: start.Unix(),
+	}
+	if node.crossLinkBroadcastStarved(start.Add(time.Hour)) {
+		t.Error("starvation detected with threshold disabled")
+	}
+
+	node.NodeConfig.Handler.CrossLinkStarvationThreshold = time.Minute
+	if node.crossLinkBroadcastStarved(start.Add(30 * time.Second)) {
+		t.Error("starvation detected before threshold since start")
+	}
+	if !node.crossLinkBroadcastStarved(start.Add(time.Minute)) {
+		t.Error("starvation not detected after threshold since start")
+	}
+
+	node.crosslinks.AddSentMessage(crosslinks.SentMessage{LastBlockNum: 1, SentAt: start.Add(2 * time.Minute)})
+	if node.crossLinkBroadcastStarved(start.Add(150 * time.Second)) {
+		t.Error("starvation detected right after a broadcast")
+	}
+	if !node.crossLinkBroadcastStarved(start.Add(3 * time.Minute)) {
+		t.Error("starvation not detected after threshold since last broadcast")
+	}
+}
+
+func TestDropInvalidSignatures(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := types.SignTx(
+		types.NewTransaction(1, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil),
+		types.NewEIP155Signer(big.NewInt(2)), key,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned := types.NewTransaction(2, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+
+	var sampler broadcastSampler
+	txs := dropInvalidSignatures(&sampler, []*types.Transaction{signed, unsigned}, 0, "tx_invalid_signature")
+	if len(txs) != 2 {
+		t.Fatalf("expected no transaction dropped when disabled, got %d", len(txs))
+	}
+	txs = dropInvalidSignatures(&sampler, []*types.Transaction{unsigned, signed}, 100, "tx_invalid_signature")
+	if len(txs) != 1 || txs[0].Hash() != signed.Hash() {
+		t.Fatalf("expected only the signed transaction, got %d", len(txs))
+	}
+
+	// the transactions checked are drawn from the sampler
+	sampler.setSource(&fixedSource{value: 0})
+	txs = dropInvalidSignatures(&sampler, []*types.Transaction{unsigned, signed}, 1, "tx_invalid_signature")
+	if len(txs) != 1 || txs[0].Hash() != signed.Hash() {
+		t.Fatalf("expected the sampled unsigned transaction dropped, got %d", len(txs))
+	}
+	sampler.setSource(&fixedSource{value: 99})
+	txs = dropInvalidSignatures(&sampler, []*types.Transaction{unsigned, signed}, 50, "tx_invalid_signature")
+	if len(txs) != 2 {
+		t.Fatalf("expected no transaction checked when not sampled, got %d", len(txs))
+	}
+}
+
+func TestSimulateCrosslinkBatch(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	tests := []struct {
+		cur, lastSent, signal uint64
+		batchSize             int
+		first, last           uint64
+		count                 int
+	}{
+		{cur: 91, lastSent: 0, signal: 90, batchSize: 3, first: 91, last: 91, count: 1},
+		{cur: 100, lastSent: 0, signal: 90, batchSize: 5, first: 91, last: 95, count: 5},
+		{cur: 100, lastSent: 92, signal: 90, batchSize: 4, first: 93, last: 96, count: 4},
+		{cur: 100, lastSent: 200, signal: 90, batchSize: 5, first: 91, last: 95, count: 5},
+		{cur: 200, lastSent: 0, signal: 90, batchSize: 6, first: 91, last: 96, count: 6},
+	}
+	for i, test := range tests {
+		res := node.SimulateCrosslinkBatch(test.cur, test.lastSent, test.signal)
+		if res.BatchSize != test.batchSize {
+			t.Errorf("test %d: batch size %d, expected %d", i, res.BatchSize, test.batchSize)
+		}
+		if len(res.BlockNums) != test.count {
+			t.Errorf("test %d: selected %d blocks, expected %d", i, len(res.BlockNums), test.count)
+			continue
+		}
+		if res.BlockNums[0] != test.first || res.BlockNums[len(res.BlockNums)-1] != test.last {
+			t.Errorf("test %d: selected %v, expected %d..%d", i, res.BlockNums, test.first, test.last)
+		}
+	}
+}
+
+func TestHeartbeatShards(t *testing.T) {
+	shardIDs, next := heartbeatShards(4, 0, 0)
+	if len(shardIDs) != 3 || shardIDs[0] != 1 || shardIDs[2] != 3 || next != 0 {
+		t.Fatalf("expected all shards, got %v next %d", shardIDs, next)
+	}
+
+	var covered []uint32
+	cursor := uint32(0)
+	for i := 0; i < 3; i++ {
+		shardIDs, cursor = heartbeatShards(4, cursor, 2)
+		if len(shardIDs) != 2 {
+			t.Fatalf("round %d: expected 2 shards, got %v", i, shardIDs)
+		}
+		covered = append(covered, shardIDs...)
+	}
+	expected := []uint32{1, 2, 3, 1, 2, 3}
+	for i := range expected {
+		if covered[i] != expected[i] {
+			t.Fatalf("expected round-robin %v, got %v", expected, covered)
+		}
+	}
+
+	if shardIDs, _ := heartbeatShards(1, 0, 2); len(shardIDs) != 0 {
+		t.Errorf("expected no shards on a beacon-only network, got %v", shardIDs)
+	}
+}
+
+func TestCrossLinkWarmingUp(t *testing.T) {
+	start := time.Unix(1000, 0)
+	node := &Node{
+		NodeConfig:          &nodeconfig.ConfigType{},
+		crosslinks:          crosslinks.New(),
+		unixTimeAtNodeStart: start.Unix(),
+	}
+	if node.crossLinkWarmingUp(start) {
+		t.Error("warming up with warm-up disabled")
+	}
+
+	node.NodeConfig.Handler.CrossLinkWarmUp = time.Minute
+	if !node.crossLinkWarmingUp(start.Add(30 * time.Second)) {
+		t.Error("not warming up within the warm-up period")
+	}
+	if node.crossLinkWarmingUp(start.Add(time.Minute)) {
+		t.Error("warming up after the warm-up period")
+	}
+
+	node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{LatestContinuousBlockNum: 10})
+	if node.crossLinkWarmingUp(start.Add(30 * time.Second)) {
+		t.Error("warming up after receiving a heartbeat")
+	}
+}
+
+func TestDedupByHash(t *testing.T) {
+	tx1 := types.NewTransaction(1, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	tx2 := types.NewTransaction(2, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	tx1Copy := types.NewTransaction(1, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+
+	txs := dedupByHash([]*types.Transaction{tx1, tx2, tx1Copy, tx2, tx1}, "tx_duplicate_in_batch")
+	if len(txs) != 2 || txs[0].Hash() != tx1.Hash() || txs[1].Hash() != tx2.Hash() {
+		t.Fatalf("expected the 2 distinct transactions in order, got %d", len(txs))
+	}
+}
+
+func TestSeenTxCache(t *testing.T) {
+	newTx := func(nonce uint64) *types.Transaction {
+		return types.NewTransaction(nonce, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	}
+	var c seenTxCache
+
+	// what reaches the pool for each batch
+	pooled := c.filter(types.Transactions{newTx(1), newTx(2), newTx(3)}, 0)
+	if len(pooled) != 3 {
+		t.Fatalf("expected the first batch to reach the pool, got %d", len(pooled))
+	}
+	if pooled = c.filter(types.Transactions{newTx(1), newTx(2), newTx(3)}, 0); len(pooled) != 0 {
+		t.Fatalf("expected the repeated batch to be dropped, got %d", len(pooled))
+	}
+	pooled = c.filter(types.Transactions{newTx(5), newTx(2), newTx(4)}, 0)
+	if len(pooled) != 2 || pooled[0].Nonce() != 5 || pooled[1].Nonce() != 4 {
+		t.Fatalf("expected the unseen transactions in order, got %d", len(pooled))
+	}
+
+	c.forget(types.Transactions{newTx(2)})
+	if pooled = c.filter(types.Transactions{newTx(1), newTx(2)}, 0); len(pooled) != 1 || pooled[0].Nonce() != 2 {
+		t.Fatalf("expected the forgotten transaction to reach the pool again, got %d", len(pooled))
+	}
+
+	var disabled seenTxCache
+	disabled.filter(types.Transactions{newTx(1)}, -1)
+	if pooled = disabled.filter(types.Transactions{newTx(1)}, -1); len(pooled) != 1 {
+		t.Error("transaction dropped with the cache disabled")
+	}
+}
+
+func TestAddGossipedTransactionsForgetsUnpooled(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	tx := types.NewTransaction(1, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	txs := node.seenTxs.filter(types.Transactions{tx}, 0)
+
+	// the batch never reaches the pool, a later copy must not be taken for a duplicate
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	node.addGossipedTransactions(ctx, txs, 0)
+	if node.seenTxs.contains(tx.Hash()) {
+		t.Error("expected the transaction not offered to the pool to be forgotten")
+	}
+}
+
+func TestValidateBlockShard(t *testing.T) {
+	header := blockfactory.NewTestHeader().With().ShardID(1).Number(big.NewInt(10)).Header()
+	ownTx := types.NewTransaction(1, common.Address{}, 1, big.NewInt(1), 21000, big.NewInt(1), nil)
+	spoofedTx := types.NewTransaction(2, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+
+	valid := types.NewBlock(header, []*types.Transaction{ownTx}, []*types.Receipt{{}}, nil, nil, nil)
+	if err := validateBlockShard(valid, 1); err != nil {
+		t.Errorf("consistent block rejected: %v", err)
+	}
+	if err := validateBlockShard(valid, 2); err == nil {
+		t.Error("block of another shard accepted")
+	}
+
+	spoofed := types.NewBlock(header, []*types.Transaction{ownTx, spoofedTx}, []*types.Receipt{{}, {}}, nil, nil, nil)
+	if err := validateBlockShard(spoofed, 1); err == nil {
+		t.Error("block with a transaction of another shard accepted")
+	}
+}
+
+// headerChain is a blockchain serving test headers by number.
+type headerChain struct {
+	core.Stub
+	shardID uint32
+}
+
+func (c headerChain) GetHeaderByNumber(number uint64) *block.Header {
+	return blockfactory.NewTestHeader().With().ShardID(c.shardID).Number(new(big.Int).SetUint64(number)).
+		Epoch(big.NewInt(1)).Header()
+}
+
+func (c headerChain) Config() *params.ChainConfig {
+	return params.TestChainConfig
+}
+
+func TestGetCrosslinkHeadersTimeout(t *testing.T) {
+	bc := headerChain{shardID: 1}
+	cls := crosslinks.New()
+	cls.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+	curBlock := newTestBlock(1, 100)
+
+	headers, err := getCrosslinkHeadersForShards(context.Background(), bc, curBlock, cls, nodeconfig.HandlerConfig{})
+	if err != nil || len(headers) == 0 {
+		t.Fatalf("expected headers, got %d, %v", len(headers), err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	headers, err = getCrosslinkHeadersForShards(ctx, bc, curBlock, cls, nodeconfig.HandlerConfig{})
+	if err != nil || len(headers) != 0 {
+		t.Fatalf("expected no headers after the deadline, got %d, %v", len(headers), err)
+	}
+}
+
+func TestGetCrosslinkHeadersShardSignal(t *testing.T) {
+	cls := crosslinks.New()
+	cls.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+	cls.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 2, LatestContinuousBlockNum: 50})
+
+	for shardID, first := range map[uint32]uint64{1: 91, 2: 51} {
+		headers, err := getCrosslinkHeadersForShards(
+			context.Background(), headerChain{shardID: shardID}, newTestBlock(shardID, 100), cls,
+			nodeconfig.HandlerConfig{CrossLinkBatchMode: nodeconfig.CrossLinkBatchSteady},
+		)
+		if err != nil || len(headers) == 0 {
+			t.Fatalf("shard %d: expected headers, got %d, %v", shardID, len(headers), err)
+		}
+		if num := headers[0].Number().Uint64(); num != first {
+			t.Errorf("shard %d: expected first header %d, got %d", shardID, first, num)
+		}
+	}
+}
+
+func TestGetCrosslinkHeadersConfirmationDepth(t *testing.T) {
+	bc := headerChain{shardID: 1}
+	curBlock := newTestBlock(1, 100)
+	signaled := crosslinks.New()
+	signaled.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+
+	for _, depth := range []uint64{0, 1, 5, 9} {
+		headers, err := getCrosslinkHeadersForShards(
+			context.Background(), bc, curBlock, signaled, nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: depth},
+		)
+		if err != nil || len(headers) == 0 {
+			t.Fatalf("depth %d: expected headers, got %d, %v", depth, len(headers), err)
+		}
+		if last := headers[len(headers)-1].Number().Uint64(); last > 100-depth {
+			t.Errorf("depth %d: header %d has too few confirmations", depth, last)
+		}
+
+		headers, err = getCrosslinkHeadersForShards(
+			context.Background(), bc, curBlock, crosslinks.New(), nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: depth},
+		)
+		if err != nil || len(headers) != 3 {
+			t.Fatalf("depth %d: expected 3 headers without signal, got %d, %v", depth, len(headers), err)
+		}
+		for i, header := range headers {
+			if want := 100 - depth - 2 + uint64(i); header.Number().Uint64() != want {
+				t.Errorf("depth %d: expected header %d, got %d", depth, want, header.Number().Uint64())
+			}
+		}
+	}
+
+	headers, err := getCrosslinkHeadersForShards(
+		context.Background(), bc, curBlock, signaled, nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: 10},
+	)
+	if err != nil || len(headers) != 0 {
+		t.Fatalf("expected no headers at the signaled block, got %d, %v", len(headers), err)
+	}
+	for _, depth := range []uint64{20, 50, 100} {
+		headers, err = getCrosslinkHeadersForShards(
+			context.Background(), bc, curBlock, signaled, nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: depth},
+		)
+		if err != nil || len(headers) != 0 {
+			t.Fatalf("depth %d: expected no headers below the signaled block, got %d, %v", depth, len(headers), err)
+		}
+	}
+	headers, err = getCrosslinkHeadersForShards(
+		context.Background(), bc, curBlock, signaled, nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: 101},
+	)
+	if err != nil || len(headers) != 0 {
+		t.Fatalf("expected no headers beyond the chain, got %d, %v", len(headers), err)
+	}
+}
+
+// gappedChain is a headerChain missing some headers, taking delay to serve a header.
+type gappedChain struct {
+	headerChain
+	missing map[uint64]bool
+	delay   time.Duration
+}
+
+func (c gappedChain) GetHeaderByNumber(number uint64) *block.Header {
+	time.Sleep(c.delay)
+	if c.missing[number] {
+		return nil
+	}
+	return c.headerChain.GetHeaderByNumber(number)
+}
+
+func TestFetchCrossLinkHeadersOrder(t *testing.T) {
+	bc := gappedChain{headerChain: headerChain{shardID: 1}, missing: map[uint64]bool{3: true, 10: true, 11: true, 40: true}}
+
+	for _, batchSize := range []int{5, 30, 200} {
+		sequential := fetchCrossLinkHeaders(context.Background(), bc, 1, 200, batchSize, 1)
+		parallel := fetchCrossLinkHeaders(context.Background(), bc, 1, 200, batchSize, 8)
+		if len(sequential) != batchSize && len(sequential) != 200-len(bc.missing) {
+			t.Fatalf("batch %d: unexpected number of headers %d", batchSize, len(sequential))
+		}
+		if len(parallel) != len(sequential) {
+			t.Fatalf("batch %d: expected %d headers, got %d", batchSize, len(sequential), len(parallel))
+		}
+		prev := uint64(0)
+		for i := range parallel {
+			num := parallel[i].Number().Uint64()
+			if num != sequential[i].Number().Uint64() {
+				t.Fatalf("batch %d: header %d is block %d, expected %d", batchSize, i, num, sequential[i].Number().Uint64())
+			}
+			if num <= prev || bc.missing[num] {
+				t.Fatalf("batch %d: unexpected block %d after %d", batchSize, num, prev)
+			}
+			prev = num
+		}
+	}
+}
+
+func TestFetchCrossLinkHeadersDeadline(t *testing.T) {
+	bc := gappedChain{headerChain: headerChain{shardID: 1}, delay: time.Second}
+	for _, workers := range []int{1, 4} {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		begin := time.Now()
+		headers := fetchCrossLinkHeaders(ctx, bc, 1, 10, 10, workers)
+		cancel()
+		if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+			t.Errorf("workers %d: expected the fetch to stop at the deadline, took %v", workers, elapsed)
+		}
+		if len(headers) != 0 {
+			t.Errorf("workers %d: expected no headers fetched in time, got %d", workers, len(headers))
+		}
+	}
+}
+
+func benchmarkFetchCrossLinkHeaders(b *testing.B, workers int) {
+	bc := gappedChain{headerChain: headerChain{shardID: 1}, delay: 50 * time.Microsecond}
+	for i := 0; i < b.N; i++ {
+		fetchCrossLinkHeaders(context.Background(), bc, 1, 200, 200, workers)
+	}
+}
+
+func BenchmarkFetchCrossLinkHeadersSequential(b *testing.B) {
+	benchmarkFetchCrossLinkHeaders(b, 1)
+}
+
+func BenchmarkFetchCrossLinkHeadersParallel(b *testing.B) {
+	benchmarkFetchCrossLinkHeaders(b, defaultCrossLinkHeaderFetchWorkers)
+}
+
+func TestSimulateCrosslinkBatchDepth(t *testing.T) {
+	tests := []struct {
+		depth, cur, signal uint64
+		first, last        uint64
+		count              int
+	}{
+		{depth: 0, cur: 100, signal: 90, first: 91, last: 95, count: 5},
+		{depth: 5, cur: 100, signal: 90, first: 91, last: 94, count: 4},
+		{depth: 8, cur: 100, signal: 90, first: 91, last: 92, count: 2},
+		{depth: 10, cur: 100, signal: 90, count: 0},
+		{depth: 20, cur: 100, signal: 90, count: 0},
+		{depth: 200, cur: 100, signal: 90, count: 0},
+	}
+	for i, test := range tests {
+		node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+		node.NodeConfig.Handler.CrossLinkConfirmationDepth = test.depth
+		res := node.SimulateCrosslinkBatch(test.cur, 0, test.signal)
+		if len(res.BlockNums) != test.count {
+			t.Errorf("test %d: selected %v, expected %d blocks", i, res.BlockNums, test.count)
+			continue
+		}
+		if test.count > 0 && (res.BlockNums[0] != test.first || res.BlockNums[test.count-1] != test.last) {
+			t.Errorf("test %d: selected %v, expected %d..%d", i, res.BlockNums, test.first, test.last)
+		}
+	}
+}
+
+func TestSimulateCrosslinkBatchSteady(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.CrossLinkBatchMode = nodeconfig.CrossLinkBatchSteady
+
+	res := node.SimulateCrosslinkBatch(200, 0, 90)
+	if res.BatchSize != crossLinkBatchSize || len(res.BlockNums) != crossLinkBatchSize || res.BlockNums[0] != 91 {
+		t.Fatalf("expected a steady batch of %d from 91, got %+v", crossLinkBatchSize, res)
+	}
+}
+
+func TestCrosslinkBatchRangeTunables(t *testing.T) {
+	conf := nodeconfig.HandlerConfig{
+		CrossLinkBatchSize:            4,
+		CrossLinkBatchCapMultiplier:   3,
+		CrossLinkSentWindowMultiplier: 2,
+		CrossLinkBatchGrowthDivisor:   2,
+	}
+	tests := []struct {
+		cur, lastSent, signal uint64
+		latest                uint64
+		batchSize             int
+	}{
+		{cur: 90, signal: 90, latest: 90, batchSize: 0},
+		{cur: 85, signal: 90, latest: 90, batchSize: 0},
+		{cur: 91, lastSent: 94, signal: 90, latest: 94, batchSize: 0},
+		{cur: 91, signal: 90, latest: 90, batchSize: 4},
+		{cur: 92, signal: 90, latest: 90, batchSize: 5},
+		{cur: 97, signal: 90, latest: 90, batchSize: 7},
+		{cur: 106, signal: 90, latest: 90, batchSize: 12},
+		{cur: 200, signal: 90, latest: 90, batchSize: 12},
+		{cur: 100, lastSent: 98, signal: 90, latest: 98, batchSize: 5},
+		{cur: 100, lastSent: 99, signal: 90, latest: 90, batchSize: 9},
+	}
+	for i, test := range tests {
+		latest, batchSize := crosslinkBatchRange(test.cur, test.lastSent, test.signal, conf)
+		if latest != test.latest || batchSize != test.batchSize {
+			t.Errorf("test %d: got %d/%d, expected %d/%d", i, latest, batchSize, test.latest, test.batchSize)
+		}
+	}
+
+	conf.CrossLinkBatchMode = nodeconfig.CrossLinkBatchSteady
+	if _, batchSize := crosslinkBatchRange(200, 0, 90, conf); batchSize != 4 {
+		t.Errorf("expected a steady batch of 4, got %d", batchSize)
+	}
+}
+
+// currentBlockChain is a header chain at a given current block.
+type currentBlockChain struct {
+	headerChain
+	current *types.Block
+}
+
+func (c currentBlockChain) CurrentBlock() *types.Block {
+	return c.current
+}
+
+func TestValidateCrosslinkBroadcastDryRun(t *testing.T) {
+	host := &recordingHost{}
+	chain := currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}
+	node := &Node{
+		host:       host,
+		Consensus:  &consensus.Consensus{},
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		registry:   registry.New().SetBlockchain(chain),
+		crosslinks: crosslinks.New(),
+	}
+	node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+
+	report := node.ValidateCrosslinkBroadcast()
+	if len(host.sentMessages()) != 0 {
+		t.Fatal("dry run sent a message")
+	}
+	if sent := node.crosslinks.LatestSentCrosslinkBlockNumber(); sent != 0 {
+		t.Fatalf("dry run updated the latest sent crosslink to %d", sent)
+	}
+	if report.Group != nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID) {
+		t.Errorf("expected the beacon group, got %s", report.Group)
+	}
+
+	headers, group, err := node.selectCrosslinkBroadcast(chain.current)
+	if err != nil || group != report.Group {
+		t.Fatalf("unexpected selection: group %s, %v", group, err)
+	}
+	if len(headers) == 0 || len(headers) != len(report.Headers) {
+		t.Fatalf("expected %d headers, got %d", len(headers), len(report.Headers))
+	}
+	for i, header := range headers {
+		if header.Hash() != report.Headers[i].Hash() {
+			t.Errorf("header %d: expected %d, got %d", i, header.Number(), report.Headers[i].Number())
+		}
+	}
+
+	// the blocks with enough confirmations are all known to the beacon chain
+	node.NodeConfig.Handler.CrossLinkConfirmationDepth = 20
+	if report = node.ValidateCrosslinkBroadcast(); len(report.Headers) != 0 || report.BatchSize != 0 {
+		t.Errorf("expected an empty broadcast at depth 20, got %d headers, batch size %d", len(report.Headers), report.BatchSize)
+	}
+}
+
+// lastCrossLinkChain is a blockchain serving the last crosslink of some shards, or an
+// error reading it.
+type lastCrossLinkChain struct {
+	core.Stub
+	links map[uint32]*types.CrossLink
+	errs  map[uint32]error
+}
+
+func (c lastCrossLinkChain) ReadShardLastCrossLink(shardID uint32) (*types.CrossLink, error) {
+	if err := c.errs[shardID]; err != nil {
+		return nil, err
+	}
+	return c.links[shardID], nil
+}
+
+func TestHeartbeatMessagesFromBeaconChain(t *testing.T) {
+	key := bls.RandPrivateKey()
+	pub := bls.FromLibBLSPublicKeyUnsafe(key.GetPublicKey())
+	signer := &bls.PrivateKeyWrapper{Pri: key, Pub: &bls.PublicKeyWrapper{Bytes: *pub, Object: key.GetPublicKey()}}
+	beacon := lastCrossLinkChain{
+		links: map[uint32]*types.CrossLink{
+			1: newTestCrossLink(1, 100),
+			3: newTestCrossLink(3, 300),
+		},
+		errs: map[uint32]error{
+			2: core.ErrCrosslinkNotFound,
+			4: errors.New("database failure"),
+		},
+	}
+	// the node's own chain has diverging crosslinks which must not be used
+	own := lastCrossLinkChain{links: map[uint32]*types.CrossLink{
+		1: newTestCrossLink(1, 50),
+		5: newTestCrossLink(5, 500),
+	}}
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}, registry: registry.New().SetBlockchain(own)}
+
+	counter := `hmy_p2p_crosslink_msg{type="heartbeat_no_crosslink"}`
+	before := node.MetricsSnapshot()[counter]
+	msgs := node.heartbeatMessages(beacon, []uint32{1, 2, 3, 4, 5}, signer)
+	if after := node.MetricsSnapshot()[counter]; after != before+2 {
+		t.Errorf("expected the shards 2 and 5 counted without crosslink, got %v -> %v", before, after)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 heartbeats, got %d", len(msgs))
+	}
+	for i, shardID := range []uint32{1, 3} {
+		if msgs[i].group != nodeconfig.NewGroupIDByShardID(nodeconfig.ShardID(shardID)) {
+			t.Errorf("heartbeat %d sent to %v", i, msgs[i].group)
+		}
+		var hb types.CrosslinkHeartbeat
+		if err := rlp.DecodeBytes(msgs[i].msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize+1:], &hb); err != nil {
+			t.Fatalf("cannot decode heartbeat: %v", err)
+		}
+		if hb.ShardID != shardID || hb.LatestContinuousBlockNum != beacon.links[shardID].BlockNum() {
+			t.Errorf("expected the beacon crosslink of shard %d, got the heartbeat %+v", shardID, hb)
+		}
+	}
+}
+
+func TestSendHeartbeats(t *testing.T) {
+	key := bls.RandPrivateKey()
+	pub := bls.FromLibBLSPublicKeyUnsafe(key.GetPublicKey())
+	signer := &bls.PrivateKeyWrapper{Pri: key, Pub: &bls.PublicKeyWrapper{Bytes: *pub, Object: key.GetPublicKey()}}
+	chain := lastCrossLinkChain{links: map[uint32]*types.CrossLink{
+		1: newTestCrossLink(1, 100),
+		2: newTestCrossLink(2, 200),
+		3: newTestCrossLink(3, 300),
+	}}
+	committees := committeeReader{}
+
+	host := &recordingHost{}
+	node := &Node{host: host, NodeConfig: &nodeconfig.ConfigType{}, registry: registry.New().SetBlockchain(chain)}
+	node.sendHeartbeats(node.heartbeatMessages(chain, []uint32{1, 2, 3, 4}, signer))
+
+	sent := host.sentMessages()
+	if len(sent) != 3 {
+		t.Fatalf("expected 3 heartbeats, got %d", len(sent))
+	}
+	for i, m := range sent {
+		shardID := uint32(i + 1)
+		if len(m.groups) != 1 || m.groups[0] != nodeconfig.NewGroupIDByShardID(nodeconfig.ShardID(shardID)) {
+			t.Fatalf("heartbeat %d sent to %v", i, m.groups)
+		}
+		var hb types.CrosslinkHeartbeat
+		if err := rlp.DecodeBytes(m.msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize+1:], &hb); err != nil {
+			t.Fatalf("cannot decode heartbeat: %v", err)
+		}
+		if hb.ShardID != shardID || hb.LatestContinuousBlockNum != chain.links[shardID].BlockNum() {
+			t.Errorf("group of shard %d got the heartbeat %+v", shardID, hb)
+		}
+		committees[hb.Epoch] = newBeaconState(key)
+		if err := verifyHeartbeatSignature(committees, new(big.Int).SetUint64(hb.Epoch), &hb); err != nil {
+			t.Errorf("heartbeat of shard %d not signed: %v", shardID, err)
+		}
+	}
+}
+
+// preCrossLinkChain is a header chain before the crosslink epoch.
+type preCrossLinkChain struct {
+	currentBlockChain
+}
+
+func (c preCrossLinkChain) Config() *params.ChainConfig {
+	config := *params.TestChainConfig
+	config.CrossLinkEpoch = big.NewInt(100)
+	return &config
+}
+
+func TestBroadcastCrossLinkMetrics(t *testing.T) {
+	chain := currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}
+	newNode := func(bc core.BlockChain) (*Node, *recordingHost) {
+		host := &recordingHost{}
+		node := &Node{
+			host:       host,
+			Consensus:  &consensus.Consensus{},
+			NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+			registry:   registry.New().SetBlockchain(bc),
+			crosslinks: crosslinks.New(),
+		}
+		node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+		return node, host
+	}
+	headerCount := func() uint64 {
+		var pb dto.Metric
+		if err := nodeCrossLinkBroadcastHeadersHistogramVec.WithLabelValues("1").(prometheus.Metric).Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		return pb.GetHistogram().GetSampleCount()
+	}
+
+	tests := []struct {
+		name    string
+		sampled bool
+		setup   func() *Node
+		outcome string
+	}{
+		{"not leader", false, func() *Node {
+			node, _ := newNode(chain)
+			return node
+		}, "skipped_not_leader"},
+		{"not crosslink epoch", true, func() *Node {
+			node, _ := newNode(preCrossLinkChain{chain})
+			return node
+		}, "skipped_not_crosslink_epoch"},
+		{"no headers", true, func() *Node {
+			node, _ := newNode(chain)
+			node.NodeConfig.Handler.CrossLinkConfirmationDepth = 1000
+			return node
+		}, "skipped_no_headers"},
+		{"send failure", true, func() *Node {
+			node, host := newNode(chain)
+			host.err = errors.New("send failed")
+			return node
+		}, "send_failed"},
+		{"sent", true, func() *Node {
+			node, _ := newNode(chain)
+			return node
+		}, "sent"},
+	}
+	for _, test := range tests {
+		key := `hmy_node_crosslink_broadcast{outcome="` + test.outcome + `",shard="1"}`
+		node := test.setup()
+		before, headersBefore := node.MetricsSnapshot()[key], headerCount()
+		node.broadcastCrossLink(test.sampled)
+		if after := node.MetricsSnapshot()[key]; after != before+1 {
+			t.Errorf("%s: expected %s to increment, got %v -> %v", test.name, key, before, after)
+		}
+		observed := headerCount() - headersBefore
+		if want := map[bool]uint64{true: 1, false: 0}[test.outcome == "sent"]; observed != want {
+			t.Errorf("%s: expected %d header count observations, got %d", test.name, want, observed)
+		}
+	}
+}
+
+type groupPeersHost struct {
+	p2p.Host
+	peers map[string][]libp2p_peer.ID
+}
+
+func (h *groupPeersHost) ListPeer(topic string) []libp2p_peer.ID {
+	return h.peers[topic]
+}
+
+func TestGroupDeliveryMonitor(t *testing.T) {
+	peerID := libp2p_peer.ID("peer")
+	host := &groupPeersHost{peers: map[string][]libp2p_peer.ID{"a": {peerID}}}
+	groups := []nodeconfig.GroupID{"a", "b"}
+
+	var monitor groupDeliveryMonitor
+	if empty := monitor.check(host, groups); len(empty) != 1 || empty[0] != "b" {
+		t.Fatalf("expected group b to be empty, got %v", empty)
+	}
+	host.peers["b"] = []libp2p_peer.ID{peerID}
+	if empty := monitor.check(host, groups); len(empty) != 0 {
+		t.Errorf("expected no empty groups, got %v", empty)
+	}
+	if monitor.empty["b"] {
+		t.Error("expected group b to be recorded as having peers")
+	}
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	var limiter concurrencyLimiter
+	release, ok := limiter.acquire(context.Background(), 1, 0, "sync_decode")
+	if !ok {
+		t.Fatal("expected a free decode slot")
+	}
+	if _, ok := limiter.acquire(context.Background(), 1, 0, "sync_decode"); ok {
+		t.Error("expected decode to be dropped when all slots are taken")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	release, ok = limiter.acquire(context.Background(), 1, time.Second, "sync_decode")
+	if !ok {
+		t.Fatal("expected decode slot to be taken after waiting")
+	}
+	release()
+
+	var unlimited concurrencyLimiter
+	for i := 0; i < 3; i++ {
+		if _, ok := unlimited.acquire(context.Background(), 0, 0, "sync_decode"); !ok {
+			t.Fatal("expected no limit")
+		}
+	}
+}
+
+func TestHandleNodeMessageConcurrencyLimit(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.MaxConcurrentTxMessages = 2
+	node.NodeConfig.Handler.MaxConcurrentBlockMessages = 1
+	var running atomic.Int32
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	node.RegisterMessageHandler(proto_node.Transaction, 0, func(context.Context, []byte) error {
+		running.Add(1)
+		defer running.Add(-1)
+		entered <- struct{}{}
+		<-unblock
+		return nil
+	})
+	var blocks atomic.Int32
+	node.RegisterMessageHandler(proto_node.Block, proto_node.CrosslinkHeartbeat, func(context.Context, []byte) error {
+		blocks.Add(1)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.HandleNodeMessage(context.Background(), "", []byte{0x00}, proto_node.Transaction)
+		}()
+		<-entered
+	}
+
+	key := `hmy_p2p_node_msg{type="tx_handling_dropped"}`
+	before := node.MetricsSnapshot()[key]
+	if err := node.HandleNodeMessage(context.Background(), "", []byte{0x00}, proto_node.Transaction); err != nil {
+		t.Errorf("expected the excess message to be dropped, got %v", err)
+	}
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected %s to increment, got %v -> %v", key, before, after)
+	}
+	if n := running.Load(); n != 2 {
+		t.Errorf("expected 2 transaction messages handled at once, got %d", n)
+	}
+	// the transaction flood doesn't take the slots of the block messages
+	if err := node.HandleNodeMessage(context.Background(), "", []byte{byte(proto_node.CrosslinkHeartbeat)}, proto_node.Block); err != nil || blocks.Load() != 1 {
+		t.Errorf("expected the block message to be handled, got %v", err)
+	}
+
+	close(unblock)
+	wg.Wait()
+	node.NodeConfig.Handler.MessageHandlingWait = time.Second
+	go func() { <-entered }()
+	if err := node.HandleNodeMessage(context.Background(), "", []byte{0x00}, proto_node.Transaction); err != nil {
+		t.Errorf("expected a free slot once the handlers returned, got %v", err)
+	}
+}
+
+func TestBroadcastBreaker(t *testing.T) {
+	var b broadcastBreaker
+	now := time.Unix(1000, 0)
+	groups := []nodeconfig.GroupID{"a", "b"}
+	sendErr := errors.New("send failed")
+
+	if opened := b.record(groups, sendErr, now, 2, time.Minute); len(opened) != 0 {
+		t.Fatalf("breaker opened before threshold: %v", opened)
+	}
+	b.record([]nodeconfig.GroupID{"b"}, nil, now, 2, time.Minute)
+	if opened := b.record(groups, sendErr, now, 2, time.Minute); len(opened) != 1 || opened[0] != "a" {
+		t.Fatalf("expected breaker of a to open, got %v", opened)
+	}
+	if allowed := b.allow(groups, now.Add(time.Second)); len(allowed) != 1 || allowed[0] != "b" {
+		t.Fatalf("expected only b allowed, got %v", allowed)
+	}
+	if allowed := b.allow(groups, now.Add(time.Minute)); len(allowed) != 2 {
+		t.Fatalf("expected both groups allowed after cooldown, got %v", allowed)
+	}
+
+	state := b.status(now.Add(time.Second))
+	if st := state["a"]; !st.Open || st.Failures != 2 {
+		t.Errorf("unexpected state of a: %+v", st)
+	}
+	if st := state["b"]; st.Open || st.Failures != 1 {
+		t.Errorf("unexpected state of b: %+v", st)
+	}
+
+	if !b.reset("a") {
+		t.Error("reset of a failing group reported no failures")
+	}
+	if b.reset("c") {
+		t.Error("reset of an unknown group reported failures")
+	}
+	if allowed := b.allow(groups, now.Add(time.Second)); len(allowed) != 2 {
+		t.Errorf("expected both groups allowed after reset, got %v", allowed)
+	}
+}
+
+func TestHandleNodeMessageShortPayload(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	actionTypes := []proto_node.MessageType{
+		proto_node.Transaction, proto_node.Block, proto_node.Client, proto_node.PING,
+		proto_node.ShardState, proto_node.Staking, proto_node.Envelope, proto_node.ChainInfo,
+	}
+	for _, actionType := range actionTypes {
+		for _, payload := range [][]byte{nil, {}} {
+			if err := node.HandleNodeMessage(context.Background(), "", payload, actionType); err == nil {
+				t.Errorf("actionType %v: empty payload accepted", actionType)
+			}
+		}
+	}
+
+	tests := []struct {
+		actionType proto_node.MessageType
+		payload    []byte
+		wantErr    bool
+	}{
+		{proto_node.Transaction, []byte{byte(proto_node.Send)}, true},
+		{proto_node.Staking, []byte{byte(proto_node.Send)}, true},
+		{proto_node.Transaction, []byte{byte(proto_node.Unlock)}, false},
+		{proto_node.Transaction, []byte{0x7f}, true},
+		{proto_node.Staking, []byte{0x7f, 0x01}, true},
+		{proto_node.Block, []byte{byte(proto_node.Sync)}, false},
+		{proto_node.ChainInfo, []byte{0x00}, false},
+		{proto_node.Client, []byte{0x00}, false},
+	}
+	for _, test := range tests {
+		err := node.HandleNodeMessage(context.Background(), "", test.payload, test.actionType)
+		if (err != nil) != test.wantErr {
+			t.Errorf("actionType %v, payload %x: expected error %v, got %v", test.actionType, test.payload, test.wantErr, err)
+		}
+	}
+
+	for _, handler := range []NodeMessageHandler{
+		node.transactionMessageHandler, node.stakingMessageHandler,
+	} {
+		if err := handler(context.Background(), nil); err == nil {
+			t.Error("empty transaction payload accepted")
+		}
+	}
+}
+
+func TestTxGossipRateLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := txGossipRateLimiter{now: func() time.Time { return now }}
+
+	for i := 0; i < 3; i++ {
+		if !l.allow("a", 1, 3) {
+			t.Fatalf("message %d within burst rejected", i)
+		}
+	}
+	if l.allow("a", 1, 3) {
+		t.Error("message above burst accepted")
+	}
+	if !l.allow("b", 1, 3) {
+		t.Error("message of another peer rejected")
+	}
+	now = now.Add(time.Second)
+	if !l.allow("a", 1, 3) {
+		t.Error("message rejected after the bucket refilled")
+	}
+
+	for i := 0; i < 10; i++ {
+		if !l.allow("a", -1, 3) {
+			t.Fatal("message rejected with the limit disabled")
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if !l.allow("c", 5, 0) {
+			t.Fatalf("message %d within the default burst rejected", i)
+		}
+	}
+}
+
+func TestTxGossipBusyPublisherNotThrottled(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	key := `hmy_p2p_node_msg{type="tx_rate_limited"}`
+	before := node.MetricsSnapshot()[key]
+	// a busy RPC node publishes one message per transaction
+	ctx := withMessagePeer(context.Background(), "rpc")
+	for i := 0; i < 10*defaultTxGossipRateBurst; i++ {
+		node.transactionMessageHandler(ctx, []byte{byte(proto_node.Send), 0x01})
+	}
+	if after := node.MetricsSnapshot()[key]; after != before {
+		t.Errorf("busy publisher throttled by default, %v messages dropped", after-before)
+	}
+}
+
+// peerCountHost is a p2p.Host connected to a controllable number of peers.
+type peerCountHost struct {
+	p2p.Host
+	peers atomic.Int32
+}
+
+func (h *peerCountHost) GetPeerCount() int {
+	return int(h.peers.Load())
+}
+
+func (h *peerCountHost) Network() libp2p_network.Network {
+	return peerCountNetwork{host: h}
+}
+
+type peerCountNetwork struct {
+	libp2p_network.Network
+	host *peerCountHost
+}
+
+func (n peerCountNetwork) Peers() []libp2p_peer.ID {
+	return make([]libp2p_peer.ID, n.host.peers.Load())
+}
+
+// scriptedPeersHost is a p2p.Host whose number of peers follows counts, one count per
+// check of the connected peers, the last count repeating.
+type scriptedPeersHost struct {
+	p2p.Host
+	mu     sync.Mutex
+	counts []int
+	checks int
+}
+
+func (h *scriptedPeersHost) GetPeerCount() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.counts[min(h.checks, len(h.counts)-1)]
+}
+
+func (h *scriptedPeersHost) Network() libp2p_network.Network {
+	return scriptedPeersNetwork{host: h}
+}
+
+func (h *scriptedPeersHost) peerChecks() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.checks
+}
+
+type scriptedPeersNetwork struct {
+	libp2p_network.Network
+	host *scriptedPeersHost
+}
+
+func (n scriptedPeersNetwork) Peers() []libp2p_peer.ID {
+	n.host.mu.Lock()
+	defer n.host.mu.Unlock()
+	count := n.host.counts[min(n.host.checks, len(n.host.counts)-1)]
+	n.host.checks++
+	return make([]libp2p_peer.ID, count)
+}
+
+// waitForGoroutines waits for the goroutines of node to return.
+func waitForGoroutines(t *testing.T, node *Node) {
+	deadline := time.Now().Add(time.Second)
+	for node.goroutines.active.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("peer check goroutine still running")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWaitForMinPeersCancel(t *testing.T) {
+	node := &Node{Consensus: &consensus.Consensus{MinPeers: 1}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- node.waitForMinPeers(ctx, time.Minute, 1, newPeerCheckBackoff(time.Hour, 0, 0))
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected cancellation error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("bootstrap did not return after cancellation")
+	}
+	waitForGoroutines(t, node)
+}
+
+func TestWaitForMinPeers(t *testing.T) {
+	host := &peerCountHost{}
+	node := &Node{host: host, Consensus: &consensus.Consensus{MinPeers: 2}}
+
+	fast := func() *peerCheckBackoff {
+		return newPeerCheckBackoff(5*time.Millisecond, 5*time.Millisecond, 5*time.Millisecond)
+	}
+
+	host.peers.Store(1)
+	err := node.waitForMinPeers(context.Background(), 50*time.Millisecond, 1, fast())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout with too few peers, got %v", err)
+	}
+	waitForGoroutines(t, node)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		host.peers.Store(2)
+	}()
+	if err := node.waitForMinPeers(context.Background(), time.Second, 1, fast()); err != nil {
+		t.Fatalf("expected min peers reached, got %v", err)
+	}
+	waitForGoroutines(t, node)
+}
+
+func TestWaitForMinPeersStable(t *testing.T) {
+	fast := func() *peerCheckBackoff {
+		return newPeerCheckBackoff(time.Millisecond, time.Millisecond, time.Millisecond)
+	}
+
+	// a spike over the min peers does not start consensus
+	host := &scriptedPeersHost{counts: []int{3, 1}}
+	node := &Node{host: host, Consensus: &consensus.Consensus{MinPeers: 2}}
+	err := node.waitForMinPeers(context.Background(), 50*time.Millisecond, 2, fast())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout after a peer count spike, got %v", err)
+	}
+	waitForGoroutines(t, node)
+
+	// consensus starts once the min peers are reached on consecutive checks
+	host = &scriptedPeersHost{counts: []int{3, 1, 2, 1, 2, 3}}
+	node = &Node{host: host, Consensus: &consensus.Consensus{MinPeers: 2}}
+	if err := node.waitForMinPeers(context.Background(), time.Second, 2, fast()); err != nil {
+		t.Fatalf("expected stable min peers, got %v", err)
+	}
+	waitForGoroutines(t, node)
+	if checks := host.peerChecks(); checks != 6 {
+		t.Errorf("expected consensus to start on the 6th check, got %d", checks)
+	}
+
+	// a single check starts consensus on the first check reaching the min peers
+	host = &scriptedPeersHost{counts: []int{1, 3, 1}}
+	node = &Node{host: host, Consensus: &consensus.Consensus{MinPeers: 2}}
+	if err := node.waitForMinPeers(context.Background(), time.Second, 1, fast()); err != nil {
+		t.Fatalf("expected min peers reached, got %v", err)
+	}
+	waitForGoroutines(t, node)
+	if checks := host.peerChecks(); checks != 2 {
+		t.Errorf("expected consensus to start on the 2nd check, got %d", checks)
+	}
+}
+
+// advanceUntilDone advances clk by step until done receives, without waiting for the
+// real time to pass, and returns what done received.
+func advanceUntilDone(t *testing.T, clk *clock.DeterministicClock, done <-chan error, step time.Duration) error {
+	for i := 0; i < 10000; i++ {
+		select {
+		case err := <-done:
+			return err
+		default:
+		}
+		clk.WaitForNewPendingTaskWithTimeout(10 * time.Millisecond)
+		clk.AdvanceTime(step)
+	}
+	t.Fatal("not done after advancing the clock")
+	return nil
+}
+
+func TestWaitForMinPeersClock(t *testing.T) {
+	backoff := func() *peerCheckBackoff {
+		return newPeerCheckBackoff(time.Second, time.Second, time.Second)
+	}
+	start := time.Unix(1700000000, 0)
+
+	clk := clock.NewDeterministicClock(start)
+	host := &scriptedPeersHost{counts: []int{1}}
+	node := &Node{host: host, Consensus: &consensus.Consensus{MinPeers: 2}, clock: clk}
+	done := make(chan error, 1)
+	go func() { done <- node.waitForMinPeers(context.Background(), time.Minute, 1, backoff()) }()
+	if err := advanceUntilDone(t, clk, done, time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected timeout with too few peers, got %v", err)
+	}
+	waitForGoroutines(t, node)
+	if elapsed := clk.Since(start); elapsed < time.Minute {
+		t.Errorf("expected timeout after a minute, got %v", elapsed)
+	}
+
+	clk = clock.NewDeterministicClock(start)
+	host = &scriptedPeersHost{counts: []int{1, 1, 1, 2}}
+	node = &Node{host: host, Consensus: &consensus.Consensus{MinPeers: 2}, clock: clk}
+	go func() { done <- node.waitForMinPeers(context.Background(), time.Minute, 1, backoff()) }()
+	if err := advanceUntilDone(t, clk, done, time.Second); err != nil {
+		t.Fatalf("expected min peers reached, got %v", err)
+	}
+	waitForGoroutines(t, node)
+	if checks := host.peerChecks(); checks != 4 {
+		t.Errorf("expected min peers reached on the 4th check, got %d", checks)
+	}
+	if elapsed := clk.Since(start); elapsed >= time.Minute {
+		t.Errorf("expected min peers reached before the timeout, got %v", elapsed)
+	}
+}
+
+func TestBootstrapConsensusPeerTolerance(t *testing.T) {
+	tests := []struct {
+		name      string
+		peers     int32
+		tolerance int
+		wantErr   error
+	}{
+		{"starts within tolerance", 2, 1, nil},
+		{"starts at min peers less tolerance", 1, 2, nil},
+		{"fails out of tolerance", 1, 1, context.DeadlineExceeded},
+		{"fails with tolerance disabled", 2, 0, context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		host := &peerCountHost{}
+		host.peers.Store(test.peers)
+		node := &Node{
+			host:      host,
+			Consensus: &consensus.Consensus{MinPeers: 3},
+			NodeConfig: &nodeconfig.ConfigType{Handler: nodeconfig.HandlerConfig{
+				BootstrapTimeout:          30 * time.Millisecond,
+				BootstrapCheckInterval:    5 * time.Millisecond,
+				BootstrapCheckIntervalMin: 5 * time.Millisecond,
+				BootstrapCheckIntervalMax: 5 * time.Millisecond,
+				BootstrapPeerTolerance:    test.tolerance,
+			}},
+		}
+		err := node.BootstrapConsensus()
+		if test.wantErr == nil && err != nil {
+			t.Errorf("%s: expected consensus to start, got %v", test.name, err)
+		} else if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+		waitForGoroutines(t, node)
+	}
+}
+
+func TestPeerCheckBackoff(t *testing.T) {
+	b := newPeerCheckBackoff(0, 0, 0)
+	if b.initial != time.Second {
+		t.Fatalf("expected initial delay of 1s, got %v", b.initial)
+	}
+	steps := []struct {
+		peers int
+		want  time.Duration
+	}{
+		{0, 2 * time.Second},
+		{0, 4 * time.Second},
+		{0, 8 * time.Second},
+		{0, 10 * time.Second},
+		{0, 10 * time.Second},
+		// progress resets the backoff
+		{1, time.Second},
+		{1, 2 * time.Second},
+		{3, time.Second},
+		{2, 2 * time.Second},
+	}
+	for i, step := range steps {
+		if got := b.next(step.peers); got != step.want {
+			t.Errorf("check %d with %d peers: expected %v, got %v", i, step.peers, step.want, got)
+		}
+	}
+}
+
+func TestHandleNodeMessageDispatchMetrics(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	payloadCount := func(action string) uint64 {
+		var pb dto.Metric
+		if err := nodeMessagePayloadSizeHistogramVec.WithLabelValues(action).(prometheus.Metric).Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		return pb.GetHistogram().GetSampleCount()
+	}
+
+	tests := []struct {
+		actionType proto_node.MessageType
+		payload    []byte
+		key        string
+	}{
+		{proto_node.Transaction, []byte{byte(proto_node.Unlock)},
+			`hmy_node_message_dispatch{action="transaction",block_type=""}`},
+		{proto_node.Staking, []byte{byte(proto_node.Unlock)},
+			`hmy_node_message_dispatch{action="staking",block_type=""}`},
+		{proto_node.Block, []byte{byte(proto_node.Sync)},
+			`hmy_node_message_dispatch{action="block",block_type="sync"}`},
+		{proto_node.Block, []byte{0xff},
+			`hmy_node_message_dispatch{action="block",block_type="unknown"}`},
+		{proto_node.Client, []byte{0x00},
+			`hmy_node_message_dispatch{action="client",block_type=""}`},
+	}
+	for _, test := range tests {
+		before, sizesBefore := node.MetricsSnapshot()[test.key], payloadCount(test.actionType.String())
+		node.HandleNodeMessage(context.Background(), "", test.payload, test.actionType)
+		if after := node.MetricsSnapshot()[test.key]; after != before+1 {
+			t.Errorf("expected %s to increment, got %v -> %v", test.key, before, after)
+		}
+		if sizes := payloadCount(test.actionType.String()); sizes != sizesBefore+1 {
+			t.Errorf("%v: expected a payload size observation, got %d", test.actionType, sizes-sizesBefore)
+		}
+	}
+
+	key := `hmy_node_message_dispatch{action="block",block_type="crosslink_heartbeat"}`
+	before := node.MetricsSnapshot()[key]
+	countNodeMessage(proto_node.Block, []byte{byte(proto_node.CrosslinkHeartbeat), 0x01})
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected %s to increment, got %v -> %v", key, before, after)
+	}
+}
+
+func TestTransactionMessageUnknownType(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	tests := []struct {
+		handler NodeMessageHandler
+		key     string
+	}{
+		{node.transactionMessageHandler, `hmy_p2p_node_msg{type="tx_unknown_type"}`},
+		{node.stakingMessageHandler, `hmy_p2p_node_msg{type="staking_tx_unknown_type"}`},
+	}
+	ctx := withMessagePeer(context.Background(), "peer")
+	for _, test := range tests {
+		before := node.MetricsSnapshot()[test.key]
+		err := test.handler(ctx, []byte{byte(proto_node.SendCompressed) + 1, 0xc0})
+		if !errors.Is(err, errUnknownTxMessageType) {
+			t.Errorf("%s: expected an unknown type error, got %v", test.key, err)
+		}
+		if after := node.MetricsSnapshot()[test.key]; after != before+1 {
+			t.Errorf("expected %s to increment, got %v -> %v", test.key, before, after)
+		}
+		if err := test.handler(ctx, []byte{byte(proto_node.Unlock)}); err != nil {
+			t.Errorf("%s: unlock message rejected: %v", test.key, err)
+		}
+	}
+}
+
+func TestHandleNodeMessageUnknownBlockType(t *testing.T) {
+	node := &Node{host: selfHost{id: "self"}, NodeConfig: &nodeconfig.ConfigType{}}
+	var logs bytes.Buffer
+	logger := utils.Logger()
+	saved := *logger
+	*logger = logger.Output(&logs).Level(zerolog.DebugLevel)
+	t.Cleanup(func() { *logger = saved })
+
+	key := `hmy_node_message_unknown_block_type{block_type="255"}`
+	before := node.MetricsSnapshot()[key]
+	err := node.HandleNodeMessage(context.Background(), "peer", []byte{0xff, 0x01}, proto_node.Block)
+	if !errors.Is(err, errUnknownBlockMessageType) {
+		t.Errorf("expected an unknown block message type error, got %v", err)
+	}
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected %s to increment, got %v -> %v", key, before, after)
+	}
+	if out := logs.String(); !strings.Contains(out, "received block message of unknown type") ||
+		!strings.Contains(out, `"blockMsgType":255`) || !strings.Contains(out, `"peer":"peer"`) {
+		t.Errorf("expected the unknown block message type to be logged, got %q", out)
+	}
+
+	// a known type without handler is ignored, not reported as unknown
+	node.RegisterMessageHandler(proto_node.Block, proto_node.Epoch, nil)
+	if err := node.HandleNodeMessage(context.Background(), "peer", []byte{byte(proto_node.Epoch)}, proto_node.Block); err != nil {
+		t.Errorf("expected the epoch message to be ignored, got %v", err)
+	}
+}
+
+// txMap is a pool of transactions.
+type txMap map[common.Hash]*types.Transaction
+
+func (m txMap) Get(hash common.Hash) types.PoolTransaction {
+	if tx, ok := m[hash]; ok {
+		return tx
+	}
+	return nil
+}
+
+// idHost is a recording host with the given id.
+type idHost struct {
+	*recordingHost
+	id libp2p_peer.ID
+}
+
+func (h idHost) GetID() libp2p_peer.ID {
+	return h.id
+}
+
+func TestTransactionAnnounceRequestRoundTrip(t *testing.T) {
+	announced := types.NewTransaction(0, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	known := types.NewTransaction(1, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	newNode := func(id libp2p_peer.ID, pool txMap) (*Node, *recordingHost) {
+		host := &recordingHost{}
+		chain := headChain{headerChain{shardID: 1}, blockfactory.NewTestHeader().With().ShardID(1).Header()}
+		return &Node{
+			host: idHost{host, id}, NodeConfig: &nodeconfig.ConfigType{}, txLookup: pool, psCtx: context.Background(),
+			registry: registry.New().SetBlockchain(upgradeChain{chain, big.NewInt(1)}),
+		}, host
+	}
+	holder, holderHost := newNode("holder", txMap{announced.Hash(): announced, known.Hash(): known})
+	receiver, receiverHost := newNode("receiver", txMap{known.Hash(): known})
+
+	// the transaction is sent in full before the message version 2 epoch
+	holder.NodeConfig.Handler.TxAnnounce = true
+	holder.tryBroadcast(announced)
+	published := holderHost.sentMessages()
+	if len(published) != 1 || proto_node.TransactionMessageType(published[0].msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize]) != proto_node.Send {
+		t.Fatalf("expected the transaction sent in full before the upgrade, got %+v", published)
+	}
+	head := blockfactory.NewTestHeader().With().ShardID(1).Epoch(big.NewInt(1)).Header()
+	holder.registry.SetBlockchain(upgradeChain{headChain{headerChain{shardID: 1}, head}, big.NewInt(1)})
+
+	holder.tryBroadcast(announced)
+	published = holderHost.sentMessages()[1:]
+	if len(published) != 1 || published[0].groups == nil {
+		t.Fatalf("expected the announce published to the shard group, got %+v", published)
+	}
+	version, announce, err := proto_node.OpenEnvelope(published[0].msg[p2pMsgPrefixSize:])
+	if err != nil || version != proto_node.MessageVersion2 {
+		t.Fatalf("expected a version 2 announce, got version %d, %v", version, err)
+	}
+	if msgType := proto_node.TransactionMessageType(announce[p2pNodeMsgPrefixSize]); msgType != proto_node.Announce {
+		t.Fatalf("expected a transaction announce, got type %d", msgType)
+	}
+
+	// the announce is relayed to the receiver by the holder
+	announce = proto_node.ConstructTransactionAnnounceMessage([]common.Hash{announced.Hash(), known.Hash()})
+	relayed := withRelayPeer(context.Background(), "holder")
+	err = receiver.HandleNodeMessage(relayed, "publisher", announce[p2pNodeMsgPrefixSize:], proto_node.Transaction)
+	if err != nil {
+		t.Fatalf("announce rejected: %v", err)
+	}
+	waitForGoroutines(t, receiver)
+	requests := receiverHost.sentMessages()
+	if len(requests) != 1 || requests[0].peer != "holder" {
+		t.Fatalf("expected one request sent to the relaying peer, got %+v", requests)
+	}
+	var req proto_node.TransactionRequest
+	if err := rlp.DecodeBytes(requests[0].msg[p2pNodeMsgPrefixSize+1:], &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Hashes) != 1 || req.Hashes[0] != announced.Hash() {
+		t.Errorf("expected a request of the unknown transaction, got %+v", req)
+	}
+
+	// a request published to a group is not served
+	err = holder.HandleNodeMessage(context.Background(), "receiver", requests[0].msg[p2pNodeMsgPrefixSize:], proto_node.Transaction)
+	if err != nil {
+		t.Fatalf("request rejected: %v", err)
+	}
+	if sent := holderHost.sentMessages(); len(sent) != 2 {
+		t.Errorf("expected a published request to be ignored, got %d messages", len(sent))
+	}
+	holder.handleDirectMessage("receiver", requests[0].msg)
+	responses := holderHost.sentMessages()[2:]
+	if len(responses) != 1 || responses[0].peer != "receiver" {
+		t.Fatalf("expected one response sent to the requester, got %+v", responses)
+	}
+	var txs types.Transactions
+	if err := rlp.DecodeBytes(responses[0].msg[p2pNodeMsgPrefixSize+1:], &txs); err != nil {
+		t.Fatal(err)
+	}
+	if len(txs) != 1 || txs[0].Hash() != announced.Hash() {
+		t.Errorf("expected the requested transaction to be sent, got %v", txs)
+	}
+	if msgType := proto_node.TransactionMessageType(responses[0].msg[p2pNodeMsgPrefixSize]); msgType != proto_node.Send {
+		t.Errorf("expected a transaction list response, got type %d", msgType)
+	}
+
+	// a transaction requested already is not requested again from the other relaying peers
+	err = receiver.HandleNodeMessage(withRelayPeer(context.Background(), "other"), "publisher", announce[p2pNodeMsgPrefixSize:], proto_node.Transaction)
+	if err != nil {
+		t.Fatalf("announce rejected: %v", err)
+	}
+	waitForGoroutines(t, receiver)
+	if sent := receiverHost.sentMessages(); len(sent) != 1 {
+		t.Errorf("expected no new request, got %d messages", len(sent))
+	}
+
+	// only transaction requests and lists are accepted directly
+	key := `hmy_p2p_node_msg{type="direct_rejected"}`
+	before := receiver.MetricsSnapshot()[key]
+	receiver.handleDirectMessage("holder", announce)
+	if after := receiver.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected a direct announce to be rejected, got %v -> %v", before, after)
+	}
+}
+
+func TestTxRequestRateLimit(t *testing.T) {
+	tx := types.NewTransaction(0, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	host := &recordingHost{}
+	node := &Node{
+		host:       host,
+		NodeConfig: &nodeconfig.ConfigType{Handler: nodeconfig.HandlerConfig{TxRequestRateLimit: 1, TxRequestRateBurst: 1}},
+		txLookup:   txMap{tx.Hash(): tx},
+	}
+	announceKey := `hmy_p2p_node_msg{type="tx_announce_rate_limited"}`
+	requestKey := `hmy_p2p_node_msg{type="tx_request_rate_limited"}`
+	announces, requests := node.MetricsSnapshot()[announceKey], node.MetricsSnapshot()[requestKey]
+
+	announce := proto_node.ConstructTransactionAnnounceMessage([]common.Hash{{1}})[p2pNodeMsgPrefixSize+1:]
+	for i := 0; i < 2; i++ {
+		if err := node.handleTxAnnounce(context.Background(), "relay", announce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := node.MetricsSnapshot()[announceKey]; after != announces+1 {
+		t.Errorf("expected the announce above the burst to be dropped, got %v -> %v", announces, after)
+	}
+
+	request := proto_node.ConstructTransactionRequestMessage(proto_node.TransactionRequest{Hashes: []common.Hash{tx.Hash()}})
+	for i := 0; i < 2; i++ {
+		if err := node.handleTxRequest(context.Background(), "requester", request[p2pNodeMsgPrefixSize+1:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if after := node.MetricsSnapshot()[requestKey]; after != requests+1 {
+		t.Errorf("expected the request above the burst to be dropped, got %v -> %v", requests, after)
+	}
+	waitForGoroutines(t, node)
+	served := 0
+	for _, m := range host.sentMessages() {
+		if m.peer == "requester" {
+			served++
+		}
+	}
+	if served != 1 {
+		t.Errorf("expected 1 request served, got %d", served)
+	}
+}
+
+func TestTransactionMessageCancelled(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	tx := types.NewTransaction(0, common.Address{}, 0, big.NewInt(1), 21000, big.NewInt(1), nil)
+	list, err := rlp.EncodeToBytes([]*types.Transaction{tx})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := append([]byte{byte(proto_node.Send)}, list...)
+
+	ctx, cancel := context.WithCancel(withMessagePeer(context.Background(), "peer"))
+	cancel()
+	for _, handler := range []NodeMessageHandler{
+		node.transactionMessageHandler, node.stakingMessageHandler,
+	} {
+		if err := handler(ctx, payload); !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the handler to return the context error, got %v", err)
+		}
+	}
+	if txs, err := decodeRLPList[types.Transaction](ctx, list, 0, 0); !errors.Is(err, context.Canceled) || len(txs) != 0 {
+		t.Errorf("expected decoding to stop on the cancelled context, got %d, %v", len(txs), err)
+	}
+	if errs := addPendingTransactions(ctx, nil, types.Transactions{tx}, txSourceGossip); len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("expected the pending transactions rejected on the cancelled context, got %v", errs)
+	}
+}
+
+func TestQueueBeaconBlock(t *testing.T) {
+	newEpochBlock := func(num, epoch int64) *types.Block {
+		data, err := shard.EncodeWrapper(shard.State{Epoch: big.NewInt(epoch + 1)}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return types.NewBlockWithHeader(blockfactory.NewTestHeader().With().
+			Number(big.NewInt(num)).Epoch(big.NewInt(epoch)).ShardState(data).
+			ParentHash(common.HexToHash("0x01")).Time(big.NewInt(2 * num)).Header())
+	}
+	head := blockfactory.NewTestHeader().With().Number(big.NewInt(100)).Epoch(big.NewInt(4)).Time(big.NewInt(200)).Header()
+	now := time.Unix(1000, 0)
+	queue := make(chan *types.Block, 1)
+
+	for _, num := range []int64{50, 100} {
+		if err := queueBeaconBlock(queue, head, newEpochBlock(num, 4), now); err != errBeaconBlockKnown {
+			t.Errorf("block %d: expected a known block, got %v", num, err)
+		}
+	}
+	notLast := types.NewBlockWithHeader(blockfactory.NewTestHeader().With().
+		Number(big.NewInt(150)).Epoch(big.NewInt(5)).Header())
+	if err := queueBeaconBlock(queue, head, notLast, now); err != errEpochBlockNotLast {
+		t.Errorf("expected a block in the middle of the epoch to be rejected, got %v", err)
+	}
+	if len(queue) != 0 {
+		t.Fatalf("expected no queued blocks, got %d", len(queue))
+	}
+
+	next := newEpochBlock(200, 5)
+	if err := queueBeaconBlock(queue, head, next, now); err != nil {
+		t.Fatalf("new epoch block not queued: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- queueBeaconBlock(queue, head, newEpochBlock(300, 6), now)
+	}()
+	select {
+	case err := <-done:
+		if err != errBeaconBlockQueueFull {
+			t.Errorf("expected a full queue, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queueing blocked on a full queue")
+	}
+	node := &Node{}
+	if depth := node.MetricsSnapshot()["hmy_node_beacon_block_queue_size"]; depth != 1 {
+		t.Errorf("expected a queue depth of 1, got %v", depth)
+	}
+	if queued := <-queue; queued != next {
+		t.Errorf("expected block %d queued, got %d", next.NumberU64(), queued.NumberU64())
+	}
+}
+
+func TestQueueBeaconBlockSanity(t *testing.T) {
+	data, err := shard.EncodeWrapper(shard.State{Epoch: big.NewInt(6)}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newEpochBlock := func(num, at int64, parent common.Hash) *types.Block {
+		return types.NewBlockWithHeader(blockfactory.NewTestHeader().With().
+			Number(big.NewInt(num)).Epoch(big.NewInt(5)).ShardState(data).
+			ParentHash(parent).Time(big.NewInt(at)).Header())
+	}
+	head := blockfactory.NewTestHeader().With().Number(big.NewInt(100)).Epoch(big.NewInt(4)).Time(big.NewInt(1000)).Header()
+	now := time.Unix(2000, 0)
+	parent := common.HexToHash("0x01")
+
+	tests := []struct {
+		name    string
+		block   *types.Block
+		wantErr error
+	}{
+		{"plausible block", newEpochBlock(200, 1400, parent), nil},
+		{"bogus number", newEpochBlock(1<<40, 1400, parent), errBeaconBlockNumber},
+		{"more blocks than seconds since head", newEpochBlock(200, 1050, parent), errBeaconBlockNumber},
+		{"no parent", newEpochBlock(200, 1400, common.Hash{}), errBeaconBlockParent},
+		{"next block not built on head", newEpochBlock(101, 1002, parent), errBeaconBlockParent},
+		{"time before head", newEpochBlock(200, 900, parent), errBeaconBlockTime},
+		{"time in the future", newEpochBlock(200, 2100, parent), errBeaconBlockTime},
+	}
+	for _, test := range tests {
+		queue := make(chan *types.Block, 1)
+		if err := queueBeaconBlock(queue, head, test.block, now); err != test.wantErr {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+		if queued := len(queue); (test.wantErr == nil) != (queued == 1) {
+			t.Errorf("%s: unexpected %d queued blocks", test.name, queued)
+		}
+	}
+
+	next := newEpochBlock(101, 1002, head.Hash())
+	if err := checkBeaconBlockSanity(head, next, now); err != nil {
+		t.Errorf("expected the next block built on head to be accepted, got %v", err)
+	}
+}
+
+func TestRouteSyncBlocks(t *testing.T) {
+	newEpochBlock := func(num int64) *types.Block {
+		return types.NewBlockWithHeader(blockfactory.NewTestHeader().With().
+			ShardID(shard.BeaconChainShardID).Number(big.NewInt(num)).ShardState([]byte{0x01}).Header())
+	}
+	accepted, rejected := newEpochBlock(40), newEpochBlock(50)
+	blocks := []*types.Block{
+		newTestBlock(1, 10), newTestBlock(2, 20), newTestBlock(0, 30), accepted, rejected,
+	}
+
+	node := &Node{}
+	receivedBefore := node.MetricsSnapshot()["hmy_node_block_sync_received"]
+	queuedBefore := node.MetricsSnapshot()["hmy_node_block_sync_beacon_queued"]
+	var offered []*types.Block
+	queued := routeSyncBlocks(blocks, func(blk *types.Block) bool {
+		offered = append(offered, blk)
+		return blk == accepted
+	})
+	if queued != 1 {
+		t.Errorf("expected 1 queued block, got %d", queued)
+	}
+	if len(offered) != 2 || offered[0] != accepted || offered[1] != rejected {
+		t.Errorf("expected only the beacon epoch blocks offered, got %d blocks", len(offered))
+	}
+	if got := node.MetricsSnapshot()["hmy_node_block_sync_received"] - receivedBefore; got != float64(len(blocks)) {
+		t.Errorf("expected %d received blocks counted, got %v", len(blocks), got)
+	}
+	if got := node.MetricsSnapshot()["hmy_node_block_sync_beacon_queued"] - queuedBefore; got != 1 {
+		t.Errorf("expected 1 queued block counted, got %v", got)
+	}
+}
+
+// parentHeaderChain is a currentBlockChain finding the parent headers of crosslinks.
+type parentHeaderChain struct {
+	currentBlockChain
+}
+
+func (c parentHeaderChain) GetHeaderByHash(common.Hash) *block.Header {
+	return c.GetHeaderByNumber(1)
+}
+
+// failingHost is a recordingHost failing the sends after the first ok ones.
+type failingHost struct {
+	recordingHost
+	ok int
+}
+
+func (h *failingHost) SendMessageToGroups(groups []nodeconfig.GroupID, msg []byte) error {
+	if h.sendCalls() >= h.ok {
+		return errors.New("send failed")
+	}
+	return h.recordingHost.SendMessageToGroups(groups, msg)
+}
+
+func TestCrossLinkChunks(t *testing.T) {
+	chain := parentHeaderChain{currentBlockChain{headerChain: headerChain{shardID: 1}}}
+	var headers []*block.Header
+	for num := uint64(91); num <= 95; num++ {
+		headers = append(headers, chain.GetHeaderByNumber(num))
+	}
+
+	if chunks := crossLinkChunks(chain, headers, math.MaxInt); len(chunks) != 1 || len(chunks[0].headers) != len(headers) {
+		t.Fatalf("expected a single chunk without size limit, got %d", len(chunks))
+	}
+	single := len(crossLinkChunks(chain, headers[:1], math.MaxInt)[0].msg)
+	for _, test := range []struct {
+		maxSize, chunks int
+	}{
+		{single, len(headers)},
+		{single / 2, len(headers)}, // a crosslink over the limit is sent alone
+		{2*single - 1, 3},
+	} {
+		chunks := crossLinkChunks(chain, headers, test.maxSize)
+		if len(chunks) != test.chunks {
+			t.Errorf("max size %d: expected %d chunks, got %d", test.maxSize, test.chunks, len(chunks))
+		}
+		var got []*block.Header
+		for i, chunk := range chunks {
+			if len(chunk.headers) > 1 && len(chunk.msg) > test.maxSize {
+				t.Errorf("max size %d: chunk of %d bytes", test.maxSize, len(chunk.msg))
+			}
+			got = append(got, chunk.headers...)
+			if i == len(chunks)-1 {
+				continue
+			}
+			// a chunk is as large as the limit allows
+			grown := append(slices.Clone(chunk.headers), headers[len(got)])
+			size := len(p2p.ConstructMessage(proto_node.ConstructCrossLinkMessage(chain, grown)))
+			if size <= test.maxSize {
+				t.Errorf("max size %d: chunk %d could hold %d bytes", test.maxSize, i, size)
+			}
+		}
+		if !slices.Equal(got, headers) {
+			t.Errorf("max size %d: chunks don't cover the headers in order", test.maxSize)
+		}
+	}
+}
+
+func TestBroadcastCrossLinkChunks(t *testing.T) {
+	chain := parentHeaderChain{currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}}
+	newNode := func(host p2p.Host) *Node {
+		node := &Node{
+			host:       host,
+			Consensus:  &consensus.Consensus{},
+			NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+			registry:   registry.New().SetBlockchain(chain),
+			crosslinks: crosslinks.New(),
+		}
+		node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+		return node
+	}
+
+	host := &recordingHost{}
+	node := newNode(host)
+	headers, _, err := node.selectCrosslinkBroadcast(chain.CurrentBlock())
+	if err != nil || len(headers) < 2 {
+		t.Fatalf("expected several headers, got %d, %v", len(headers), err)
+	}
+	// one crosslink per message
+	maxSize := len(crossLinkChunks(chain, headers[:1], math.MaxInt)[0].msg)
+	node.NodeConfig.Handler.CrossLinkMaxMessageSize = maxSize
+	node.broadcastCrossLink(true)
+	if host.sendCalls() != len(headers) {
+		t.Errorf("expected %d messages, got %d", len(headers), host.sendCalls())
+	}
+	for i, m := range host.sentMessages() {
+		if len(m.msg) > maxSize {
+			t.Errorf("message %d of %d bytes over the limit of %d", i, len(m.msg), maxSize)
+		}
+	}
+	if got, want := node.crosslinks.LatestSentCrosslinkBlockNumber(), headers[len(headers)-1].Number().Uint64(); got != want {
+		t.Errorf("expected the latest sent crosslink %d, got %d", want, got)
+	}
+
+	// a failure mid-way keeps the crosslinks sent before it
+	key := `hmy_node_crosslink_broadcast{outcome="partially_sent",shard="1"}`
+	failing := &failingHost{ok: 1}
+	node = newNode(failing)
+	node.NodeConfig.Handler.CrossLinkMaxMessageSize = maxSize
+	before := node.MetricsSnapshot()[key]
+	node.broadcastCrossLink(true)
+	if failing.sendCalls() != 1 {
+		t.Errorf("expected 1 message sent before the failure, got %d", failing.sendCalls())
+	}
+	if got, want := node.crosslinks.LatestSentCrosslinkBlockNumber(), headers[0].Number().Uint64(); got != want {
+		t.Errorf("expected the latest sent crosslink %d, got %d", want, got)
+	}
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected %s to increment, got %v -> %v", key, before, after)
+	}
+}
+
+// flakyHost is a recordingHost failing its first sends.
+type flakyHost struct {
+	recordingHost
+	failures int
+	attempts int
+}
+
+func (h *flakyHost) SendMessageToGroups(groups []nodeconfig.GroupID, msg []byte) error {
+	h.attempts++
+	if h.attempts <= h.failures {
+		return errors.New("transient send failure")
+	}
+	return h.recordingHost.SendMessageToGroups(groups, msg)
+}
+
+func TestBroadcastCrossLinkRetry(t *testing.T) {
+	chain := parentHeaderChain{currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}}
+	newNode := func(host p2p.Host) *Node {
+		node := &Node{
+			host:       host,
+			Consensus:  &consensus.Consensus{},
+			NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+			registry:   registry.New().SetBlockchain(chain),
+			crosslinks: crosslinks.New(),
+		}
+		node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+		node.NodeConfig.Handler.CrossLinkSendBackoff = time.Millisecond
+		return node
+	}
+	retryKey := `hmy_p2p_crosslink_msg{type="broadcast_retry"}`
+
+	// success on the second attempt
+	host := &flakyHost{failures: 1}
+	node := newNode(host)
+	headers, _, err := node.selectCrosslinkBroadcast(chain.CurrentBlock())
+	if err != nil || len(headers) == 0 {
+		t.Fatalf("expected headers, got %d, %v", len(headers), err)
+	}
+	retriesBefore := node.MetricsSnapshot()[retryKey]
+	node.broadcastCrossLink(true)
+	if host.attempts != 2 || host.sendCalls() != 1 {
+		t.Errorf("expected 1 message sent on the second attempt, got %d attempts, %d sent", host.attempts, host.sendCalls())
+	}
+	if got := node.MetricsSnapshot()[retryKey] - retriesBefore; got != 1 {
+		t.Errorf("expected 1 retry counted, got %v", got)
+	}
+	if got, want := node.crosslinks.LatestSentCrosslinkBlockNumber(), headers[len(headers)-1].Number().Uint64(); got != want {
+		t.Errorf("expected the latest sent crosslink %d, got %d", want, got)
+	}
+	if sent := node.crosslinks.SentMessagesSince(0, time.Now()); len(sent) != 1 {
+		t.Errorf("expected the message recorded once, got %d", len(sent))
+	}
+
+	// the retries are bounded
+	host = &flakyHost{failures: 10}
+	node = newNode(host)
+	node.NodeConfig.Handler.CrossLinkSendRetries = 2
+	node.broadcastCrossLink(true)
+	if host.attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", host.attempts)
+	}
+	if got := node.crosslinks.LatestSentCrosslinkBlockNumber(); got != 0 {
+		t.Errorf("expected no sent crosslink, got %d", got)
+	}
+
+	// no retry when disabled
+	host = &flakyHost{failures: 1}
+	node = newNode(host)
+	node.NodeConfig.Handler.CrossLinkSendRetries = -1
+	node.broadcastCrossLink(true)
+	if host.attempts != 1 {
+		t.Errorf("expected a single attempt, got %d", host.attempts)
+	}
+}
+
+func TestGetCrosslinkHeadersMaxAge(t *testing.T) {
+	bc := headerChain{shardID: 1}
+	curBlock := newTestBlock(1, 100)
+	cls := crosslinks.New()
+	cls.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 50})
+	firstNum := func(conf nodeconfig.HandlerConfig) uint64 {
+		headers, err := getCrosslinkHeadersForShards(context.Background(), bc, curBlock, cls, conf)
+		if err != nil || len(headers) == 0 {
+			t.Fatalf("expected headers, got %d, %v", len(headers), err)
+		}
+		return headers[0].Number().Uint64()
+	}
+
+	if got := firstNum(nodeconfig.HandlerConfig{}); got != 51 {
+		t.Errorf("expected the headers after the signal without age limit, got the first %d", got)
+	}
+	key := `hmy_p2p_crosslink_msg{type="header_too_old"}`
+	before := (&Node{}).MetricsSnapshot()[key]
+	if got := firstNum(nodeconfig.HandlerConfig{CrossLinkMaxHeaderAge: 20}); got != 80 {
+		t.Errorf("expected the headers too old excluded, got the first %d", got)
+	}
+	if got := (&Node{}).MetricsSnapshot()[key] - before; got != 29 {
+		t.Errorf("expected 29 headers counted too old, got %v", got)
+	}
+	// a limit behind the signal leaves the selection unchanged
+	if got := firstNum(nodeconfig.HandlerConfig{CrossLinkMaxHeaderAge: 60}); got != 51 {
+		t.Errorf("expected the headers after the signal, got the first %d", got)
+	}
+
+	// without signal, the headers near the tip are filtered as well
+	headers, err := getCrosslinkHeadersForShards(
+		context.Background(), bc, curBlock, crosslinks.New(), nodeconfig.HandlerConfig{CrossLinkMaxHeaderAge: 1},
+	)
+	if err != nil || len(headers) != 2 || headers[0].Number().Uint64() != 99 {
+		t.Errorf("expected the headers of blocks 99 and 100, got %d, %v", len(headers), err)
+	}
+
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.CrossLinkMaxHeaderAge = 20
+	if sim := node.SimulateCrosslinkBatch(100, 0, 50); len(sim.BlockNums) == 0 || sim.BlockNums[0] != 80 {
+		t.Errorf("expected the simulated batch to start at 80, got %v", sim.BlockNums)
+	}
+}
+
+// configlessChain is a headerChain whose config can't be read.
+type configlessChain struct {
+	headerChain
+}
+
+func (configlessChain) Config() *params.ChainConfig {
+	return nil
+}
+
+func TestGetCrosslinkHeadersReadFailure(t *testing.T) {
+	curBlock := newTestBlock(1, 100)
+	signaled := crosslinks.New()
+	signaled.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+	missing := make(map[uint64]bool)
+	for num := uint64(0); num <= 100; num++ {
+		missing[num] = true
+	}
+
+	tests := []struct {
+		name    string
+		chain   core.BlockChain
+		cls     *crosslinks.Crosslinks
+		conf    nodeconfig.HandlerConfig
+		wantErr error
+	}{
+		{"not eligible", preCrossLinkChain{currentBlockChain{headerChain: headerChain{shardID: 1}}}, signaled, nodeconfig.HandlerConfig{}, nil},
+		{"up to date", headerChain{shardID: 1}, signaled, nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: 10}, nil},
+		{"no config", configlessChain{headerChain{shardID: 1}}, signaled, nodeconfig.HandlerConfig{}, errCrossLinkChainConfig},
+		{"missing headers", gappedChain{headerChain: headerChain{shardID: 1}, missing: missing}, signaled, nodeconfig.HandlerConfig{}, errCrossLinkHeaderRead},
+		{"missing tip without signal", gappedChain{headerChain: headerChain{shardID: 1}, missing: missing}, crosslinks.New(),
+			nodeconfig.HandlerConfig{CrossLinkConfirmationDepth: 1}, errCrossLinkHeaderRead},
+	}
+	for _, test := range tests {
+		headers, err := getCrosslinkHeadersForShards(context.Background(), test.chain, curBlock, test.cls, test.conf)
+		if len(headers) != 0 {
+			t.Errorf("%s: expected no headers, got %d", test.name, len(headers))
+		}
+		if test.wantErr == nil && err != nil {
+			t.Errorf("%s: expected no error, got %v", test.name, err)
+		} else if !errors.Is(err, test.wantErr) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.wantErr, err)
+		}
+	}
+}
+
+func TestTriggerCrossLinkBroadcast(t *testing.T) {
+	chain := parentHeaderChain{currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}}
+	host := &recordingHost{}
+	node := &Node{
+		host:       host,
+		Consensus:  &consensus.Consensus{},
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		registry:   registry.New().SetBlockchain(chain),
+		crosslinks: crosslinks.New(),
+	}
+	node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+	node.NodeConfig.Handler.CrossLinkBatchSize = 2
+	node.NodeConfig.Handler.CrossLinkBatchMode = nodeconfig.CrossLinkBatchSteady
+
+	// concurrent broadcasts never send a crosslink twice
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.TriggerCrossLinkBroadcast()
+		}()
+	}
+	wg.Wait()
+
+	sent := host.sentMessages()
+	if len(sent) == 0 {
+		t.Fatal("expected a crosslink broadcast")
+	}
+	seen := make(map[uint64]bool)
+	for _, m := range sent {
+		if len(m.groups) != 1 || m.groups[0] != nodeconfig.NewGroupIDByShardID(shard.BeaconChainShardID) {
+			t.Errorf("crosslinks sent to %v", m.groups)
+		}
+		var links []types.CrossLink
+		if err := rlp.DecodeBytes(m.msg[p2pMsgPrefixSize+p2pNodeMsgPrefixSize+1:], &links); err != nil {
+			t.Fatalf("cannot decode crosslinks: %v", err)
+		}
+		for _, link := range links {
+			if seen[link.BlockNum()] {
+				t.Errorf("crosslink of block %d sent twice", link.BlockNum())
+			}
+			seen[link.BlockNum()] = true
+		}
+	}
+	if len(seen) != 8 {
+		t.Errorf("expected the crosslinks of 8 blocks sent, got %d", len(seen))
+	}
+}
+
+func TestBeaconSyncHookBackground(t *testing.T) {
+	chain := parentHeaderChain{currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}}
+	host := &recordingHost{err: errors.New("send failed")}
+	node := &Node{
+		host:       host,
+		Consensus:  &consensus.Consensus{},
+		NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+		registry:   registry.New().SetBlockchain(chain),
+		crosslinks: crosslinks.New(),
+		role:       fixedRole{leader: true},
+	}
+	node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+	node.NodeConfig.Handler.CrossLinkSendBackoff = time.Hour
+	defer node.shutdown.trigger()
+
+	begin := time.Now()
+	node.BeaconSyncHook()
+	node.BeaconSyncHook()
+	if elapsed := time.Since(begin); elapsed > 500*time.Millisecond {
+		t.Fatalf("expected the hook not to wait for the send retries, took %v", elapsed)
+	}
+	deadline := time.Now().Add(time.Second)
+	for host.sendCalls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if calls := host.sendCalls(); calls != 1 {
+		t.Errorf("expected one broadcast waiting to retry, got %d sends", calls)
+	}
+}
+
+// peersHost is a p2p.Host connected to the given peers.
+type peersHost struct {
+	p2p.Host
+	peers []libp2p_peer.ID
+}
+
+func (h *peersHost) Network() libp2p_network.Network {
+	return peersNetwork{peers: h.peers}
+}
+
+type peersNetwork struct {
+	libp2p_network.Network
+	peers []libp2p_peer.ID
+}
+
+func (n peersNetwork) Peers() []libp2p_peer.ID {
+	return n.peers
+}
+
+func TestConnectedPeersInfo(t *testing.T) {
+	host := &peersHost{peers: []libp2p_peer.ID{"a", "b", "c", "d"}}
+	node := &Node{host: host}
+	node.peerChainInfo.set("a", proto_node.ChainInfo{ShardID: 1})
+	node.peerChainInfo.set("b", proto_node.ChainInfo{ShardID: 2})
+	node.peerChainInfo.set("c", proto_node.ChainInfo{ShardID: 1})
+	node.peerChainInfo.set("e", proto_node.ChainInfo{ShardID: 3})
+
+	info := node.connectedPeersInfo(node.host.Network().Peers())
+	want := []string{
+		libp2p_peer.ID("a").String(), libp2p_peer.ID("b").String(),
+		libp2p_peer.ID("c").String(), libp2p_peer.ID("d").String(),
+	}
+	if !slices.Equal(info.IDs, want) {
+		t.Errorf("expected the peers %v, got %v", want, info.IDs)
+	}
+	if len(info.ByShard) != 2 || info.ByShard[1] != 2 || info.ByShard[2] != 1 {
+		t.Errorf("unexpected peers by shard %v", info.ByShard)
+	}
+	if info.UnknownShard != 1 {
+		t.Errorf("expected 1 peer of unknown shard, got %d", info.UnknownShard)
+	}
+}
@@ -0,0 +1,212 @@
+package node
+
+import (
+	"context"
+	"sync"
+
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	"github.com/harmony-one/harmony/p2p"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+)
+
+// NodeMessageHandler handles the payload of a node message. The payload of a block message
+// does not include its block message type. MessagePeer returns the peer which published
+// the message from ctx.
+type NodeMessageHandler func(ctx context.Context, payload []byte) error
+
+// nodeMessageKey identifies the handler of node messages, blockType is only set for block messages.
+type nodeMessageKey struct {
+	action    proto_node.MessageType
+	blockType proto_node.BlockMessageType
+}
+
+// nodeMessageHandlers maps the node messages to their handlers.
+type nodeMessageHandlers struct {
+	once     sync.Once
+	mu       sync.RWMutex
+	handlers map[nodeMessageKey]NodeMessageHandler
+}
+
+// init registers the default handlers of node on first use.
+func (h *nodeMessageHandlers) init(node *Node) {
+	h.once.Do(func() {
+		h.handlers = node.defaultMessageHandlers()
+	})
+}
+
+func (h *nodeMessageHandlers) get(node *Node, key nodeMessageKey) (NodeMessageHandler, bool) {
+	h.init(node)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	handler, ok := h.handlers[key]
+	return handler, ok
+}
+
+func (h *nodeMessageHandlers) set(node *Node, key nodeMessageKey, handler NodeMessageHandler) {
+	h.init(node)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if handler == nil {
+		delete(h.handlers, key)
+		return
+	}
+	h.handlers[key] = handler
+}
+
+// defaultMessageHandlers returns the handlers of the node messages the node understands.
+func (node *Node) defaultMessageHandlers() map[nodeMessageKey]NodeMessageHandler {
+	peerHandler := func(handle func(libp2p_peer.ID, []byte)) NodeMessageHandler {
+		return func(ctx context.Context, payload []byte) error {
+			handle(MessagePeer(ctx), payload)
+			return nil
+		}
+	}
+	payloadHandler := func(handle func([]byte)) NodeMessageHandler {
+		return func(_ context.Context, payload []byte) error {
+			handle(payload)
+			return nil
+		}
+	}
+	blocksSyncHandler := func(msgType proto_node.BlockMessageType) NodeMessageHandler {
+		return func(ctx context.Context, payload []byte) error {
+			return node.handleBlocksSync(ctx, msgType, payload)
+		}
+	}
+	block := func(blockType proto_node.BlockMessageType) nodeMessageKey {
+		return nodeMessageKey{action: proto_node.Block, blockType: blockType}
+	}
+	return map[nodeMessageKey]NodeMessageHandler{
+		{action: proto_node.Transaction}:     node.transactionMessageHandler,
+		{action: proto_node.Staking}:         node.stakingMessageHandler,
+		{action: proto_node.ChainInfo}:       node.chainInfoMessageHandler,
+		block(proto_node.Sync):               blocksSyncHandler(proto_node.Sync),
+		block(proto_node.SyncCompressed):     blocksSyncHandler(proto_node.SyncCompressed),
+		block(proto_node.SlashCandidate):     payloadHandler(node.processSlashCandidateMessage),
+		block(proto_node.Receipt):            payloadHandler(node.ProcessReceiptMessage),
+		block(proto_node.CrossLink):          peerHandler(node.processCrossLinkMessage),
+		block(proto_node.CrosslinkHeartbeat): peerHandler(node.processCrossLinkHeartbeat),
+		block(proto_node.Epoch):              payloadHandler(node.ProcessEpochBlockMessage),
+		block(proto_node.CrosslinkAck):       payloadHandler(node.ProcessCrossLinkAckMessage),
+		block(proto_node.CrossLinkReplay):    node.crossLinkReplayHandler,
+	}
+}
+
+// RegisterMessageHandler makes handler handle the node messages of actionType, and of
+// blockMsgType for block messages, replacing the current handler. A nil handler removes
+// the current one, such messages are then ignored.
+func (node *Node) RegisterMessageHandler(
+	actionType proto_node.MessageType, blockMsgType proto_node.BlockMessageType, handler NodeMessageHandler,
+) {
+	key := nodeMessageKey{action: actionType}
+	if actionType == proto_node.Block {
+		key.blockType = blockMsgType
+	}
+	node.messageHandlers.set(node, key, handler)
+}
+
+type messagePeerKey struct{}
+
+// withMessagePeer returns ctx carrying peer as the publisher of the handled node message.
+func withMessagePeer(ctx context.Context, peer libp2p_peer.ID) context.Context {
+	return context.WithValue(ctx, messagePeerKey{}, peer)
+}
+
+// MessagePeer returns the peer which published the node message handled with ctx,
+// empty if not known.
+func MessagePeer(ctx context.Context) libp2p_peer.ID {
+	peer, _ := ctx.Value(messagePeerKey{}).(libp2p_peer.ID)
+	return peer
+}
+
+type relayPeerKey struct{}
+
+// withRelayPeer returns ctx carrying peer as the peer the handled node message was received
+// from, which relayed it unless it is its publisher.
+func withRelayPeer(ctx context.Context, peer libp2p_peer.ID) context.Context {
+	return context.WithValue(ctx, relayPeerKey{}, peer)
+}
+
+// RelayPeer returns the peer the node message handled with ctx was received from. It is the
+// publisher of the messages sent directly to this node, and empty if not known.
+func RelayPeer(ctx context.Context) libp2p_peer.ID {
+	if peer, _ := ctx.Value(relayPeerKey{}).(libp2p_peer.ID); peer != "" {
+		return peer
+	}
+	if isDirectMessage(ctx) {
+		return MessagePeer(ctx)
+	}
+	return ""
+}
+
+type directMessageKey struct{}
+
+// withDirectMessage returns ctx marking the handled node message as sent directly to this
+// node, rather than published to a group.
+func withDirectMessage(ctx context.Context) context.Context {
+	return context.WithValue(ctx, directMessageKey{}, true)
+}
+
+// isDirectMessage returns whether the node message handled with ctx was sent directly to
+// this node.
+func isDirectMessage(ctx context.Context) bool {
+	direct, _ := ctx.Value(directMessageKey{}).(bool)
+	return direct
+}
+
+// messagePriority is the priority of the handling of node messages.
+type messagePriority int
+
+const (
+	// priorityMessages are the block messages, such as crosslinks and slash candidates,
+	// which the consensus depends on, and the other light messages.
+	priorityMessages messagePriority = iota
+	// bulkMessages are the transaction and staking messages, which come in floods.
+	bulkMessages
+)
+
+// nodeMessagePriority returns the priority of the node messages of actionType.
+func nodeMessagePriority(actionType proto_node.MessageType) messagePriority {
+	if nodeMessageClass(actionType) == txMessages {
+		return bulkMessages
+	}
+	return priorityMessages
+}
+
+// reservedPriorityWorkers is the number of the node message workers reserved for the
+// priority messages.
+const reservedPriorityWorkers = p2p.SetAsideOtherwise / 4
+
+// nodeMessageWorkers are the workers handling the node messages, split into a set for
+// the priority messages and a set for the bulk messages, so that a flood of bulk
+// messages can't delay the priority messages.
+type nodeMessageWorkers struct {
+	sets [2]*semaphore.Weighted
+}
+
+// newNodeMessageWorkers returns workers with priority workers for the priority messages
+// and bulk workers for the bulk messages.
+func newNodeMessageWorkers(priority, bulk int64) *nodeMessageWorkers {
+	return &nodeMessageWorkers{sets: [2]*semaphore.Weighted{
+		priorityMessages: semaphore.NewWeighted(priority),
+		bulkMessages:     semaphore.NewWeighted(bulk),
+	}}
+}
+
+// tryAcquire takes a worker of the set handling the node messages of actionType without
+// waiting. It returns the function releasing the worker, and false if all workers of
+// the set are busy.
+func (w *nodeMessageWorkers) tryAcquire(actionType proto_node.MessageType) (func(), bool) {
+	priority := nodeMessagePriority(actionType)
+	set := w.sets[priority]
+	if !set.TryAcquire(1) {
+		counter := "priority_workers_busy"
+		if priority == bulkMessages {
+			counter = "bulk_workers_busy"
+		}
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counter}).Inc()
+		return nil, false
+	}
+	return func() { set.Release(1) }, true
+}
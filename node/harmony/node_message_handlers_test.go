@@ -0,0 +1,147 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/p2p"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+)
+
+// selfHost is a host with the given id.
+type selfHost struct {
+	p2p.Host
+	id libp2p_peer.ID
+}
+
+func (h selfHost) GetID() libp2p_peer.ID {
+	return h.id
+}
+
+func TestRegisterMessageHandler(t *testing.T) {
+	node := &Node{host: selfHost{id: "self"}, NodeConfig: &nodeconfig.ConfigType{}}
+	var (
+		gotPeer    libp2p_peer.ID
+		gotPayload []byte
+	)
+	errHandled := errors.New("handled")
+	node.RegisterMessageHandler(proto_node.Block, proto_node.CrosslinkHeartbeat, func(ctx context.Context, payload []byte) error {
+		gotPeer, gotPayload = MessagePeer(ctx), payload
+		return errHandled
+	})
+
+	payload := []byte{byte(proto_node.CrosslinkHeartbeat), 0x01, 0x02}
+	if err := node.HandleNodeMessage(context.Background(), "peer", payload, proto_node.Block); err != errHandled {
+		t.Fatalf("expected the custom handler error, got %v", err)
+	}
+	if gotPeer != "peer" || string(gotPayload) != string(payload[1:]) {
+		t.Errorf("handler got peer %q payload %x", gotPeer, gotPayload)
+	}
+
+	// the other block messages keep their default handler
+	if _, ok := node.messageHandlers.get(node, nodeMessageKey{proto_node.Block, proto_node.CrossLink}); !ok {
+		t.Error("default crosslink handler missing")
+	}
+
+	// a new action type can be handled
+	var handled bool
+	node.RegisterMessageHandler(proto_node.PING, proto_node.CrossLink, func(context.Context, []byte) error {
+		handled = true
+		return nil
+	})
+	if err := node.HandleNodeMessage(context.Background(), "", []byte{0x00}, proto_node.PING); err != nil || !handled {
+		t.Errorf("expected the ping handler to be called, got %v, handled %v", err, handled)
+	}
+
+	node.RegisterMessageHandler(proto_node.Block, proto_node.CrosslinkHeartbeat, nil)
+	if err := node.HandleNodeMessage(context.Background(), "peer", payload, proto_node.Block); err != nil {
+		t.Errorf("expected the message without handler to be ignored, got %v", err)
+	}
+}
+
+func TestDefaultMessageHandlers(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	keys := []nodeMessageKey{
+		{action: proto_node.Transaction},
+		{action: proto_node.Staking},
+		{action: proto_node.ChainInfo},
+	}
+	for _, blockType := range []proto_node.BlockMessageType{
+		proto_node.Sync, proto_node.SyncCompressed, proto_node.SlashCandidate, proto_node.Receipt,
+		proto_node.CrossLink, proto_node.CrosslinkHeartbeat, proto_node.Epoch, proto_node.CrosslinkAck,
+		proto_node.CrossLinkReplay,
+	} {
+		keys = append(keys, nodeMessageKey{action: proto_node.Block, blockType: blockType})
+	}
+	for _, key := range keys {
+		if _, ok := node.messageHandlers.get(node, key); !ok {
+			t.Errorf("no default handler for %v/%v", key.action, key.blockType)
+		}
+	}
+	if _, ok := node.messageHandlers.get(node, nodeMessageKey{action: proto_node.Client}); ok {
+		t.Error("unexpected handler for client messages")
+	}
+}
+
+func TestNodeMessagePriority(t *testing.T) {
+	tests := []struct {
+		actionType proto_node.MessageType
+		want       messagePriority
+	}{
+		{proto_node.Transaction, bulkMessages},
+		{proto_node.Staking, bulkMessages},
+		{proto_node.Block, priorityMessages},
+		{proto_node.ChainInfo, priorityMessages},
+		{proto_node.Client, priorityMessages},
+	}
+	for _, test := range tests {
+		if got := nodeMessagePriority(test.actionType); got != test.want {
+			t.Errorf("%v: expected priority %v, got %v", test.actionType, test.want, got)
+		}
+	}
+}
+
+func TestNodeMessageWorkersBlocksDuringTransactionBacklog(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	var handled []proto_node.BlockMessageType
+	for _, blockType := range []proto_node.BlockMessageType{proto_node.CrossLink, proto_node.SlashCandidate} {
+		node.RegisterMessageHandler(proto_node.Block, blockType, func(context.Context, []byte) error {
+			handled = append(handled, blockType)
+			return nil
+		})
+	}
+	workers := newNodeMessageWorkers(1, 2)
+
+	// a transaction backlog takes all the bulk workers
+	for i := 0; i < 2; i++ {
+		if _, ok := workers.tryAcquire(proto_node.Transaction); !ok {
+			t.Fatalf("transaction %d: expected a free bulk worker", i)
+		}
+	}
+	key := `hmy_p2p_node_msg{type="bulk_workers_busy"}`
+	before := node.MetricsSnapshot()[key]
+	if _, ok := workers.tryAcquire(proto_node.Staking); ok {
+		t.Error("expected the staking message to wait for the busy bulk workers")
+	}
+	if after := node.MetricsSnapshot()[key]; after != before+1 {
+		t.Errorf("expected %s to increment, got %v -> %v", key, before, after)
+	}
+
+	for _, blockType := range []proto_node.BlockMessageType{proto_node.CrossLink, proto_node.SlashCandidate} {
+		release, ok := workers.tryAcquire(proto_node.Block)
+		if !ok {
+			t.Fatalf("block message %v delayed by the transaction backlog", blockType)
+		}
+		err := node.HandleNodeMessage(context.Background(), "", []byte{byte(blockType)}, proto_node.Block)
+		release()
+		if err != nil {
+			t.Errorf("block message %v: %v", blockType, err)
+		}
+	}
+	if len(handled) != 2 {
+		t.Errorf("expected both block messages handled, got %v", handled)
+	}
+}
@@ -0,0 +1,54 @@
+package node
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	"github.com/pkg/errors"
+)
+
+// ReplayEntry is a captured node message, as passed to HandleNodeMessage.
+type ReplayEntry struct {
+	ActionType uint8
+	Payload    []byte
+}
+
+// ReplayReport is the outcome of ReplayMessages.
+type ReplayReport struct {
+	Replayed int
+	Errors   []error
+}
+
+// ReplayMessages reads a sequence of RLP encoded ReplayEntry from r and feeds them
+// through HandleNodeMessage in order, pausing the configured replay interval between
+// messages. It is a tool to reproduce issues from captured traffic in tests and admin
+// sessions, it must not be exposed to the public.
+func (node *Node) ReplayMessages(r io.Reader) ReplayReport {
+	var report ReplayReport
+	s := rlp.NewStream(r, 0)
+	for i := 0; ; i++ {
+		var entry ReplayEntry
+		if err := s.Decode(&entry); err != nil {
+			if err != io.EOF {
+				report.Errors = append(report.Errors, errors.Wrapf(err, "cannot decode message %d", i))
+			}
+			return report
+		}
+		if i > 0 && node.NodeConfig.Handler.ReplayInterval > 0 {
+			time.Sleep(node.NodeConfig.Handler.ReplayInterval)
+		}
+		if len(entry.Payload) == 0 {
+			report.Errors = append(report.Errors, errors.Errorf("message %d has empty payload", i))
+			continue
+		}
+		err := node.HandleNodeMessage(context.Background(), "", entry.Payload, proto_node.MessageType(entry.ActionType))
+		if err != nil {
+			report.Errors = append(report.Errors, errors.Wrapf(err, "message %d", i))
+			continue
+		}
+		report.Replayed++
+	}
+}
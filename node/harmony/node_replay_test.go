@@ -0,0 +1,32 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+)
+
+func TestReplayMessages(t *testing.T) {
+	var buf bytes.Buffer
+	for _, entry := range []ReplayEntry{
+		{ActionType: 200, Payload: []byte{1}},
+		{ActionType: 200, Payload: nil},
+		{ActionType: 201, Payload: []byte{2, 3}},
+	} {
+		if err := rlp.Encode(&buf, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf.WriteByte(0xff) // truncated trailing entry
+
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	report := node.ReplayMessages(&buf)
+	if report.Replayed != 2 {
+		t.Errorf("expected 2 replayed messages, got %d", report.Replayed)
+	}
+	if len(report.Errors) != 2 {
+		t.Errorf("expected 2 errors, got %v", report.Errors)
+	}
+}
@@ -0,0 +1,124 @@
+package node
+
+import (
+	crand "crypto/rand"
+	"encoding/binary"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultCrossLinkSamplePercent is the default percentage of crosslink broadcast
+	// rounds a non-leader takes part in.
+	defaultCrossLinkSamplePercent = 2
+	// defaultHeartbeatSamplePercent is the default percentage of heartbeat broadcast
+	// rounds a non-leader takes part in.
+	defaultHeartbeatSamplePercent = 1
+	// defaultBroadcastSampleJitter is the default longest delay of a broadcast by a sampled non-leader.
+	defaultBroadcastSampleJitter = 500 * time.Millisecond
+)
+
+// broadcastSampler picks the broadcast rounds a non-leader takes part in. Unless a source
+// is set, it draws from a source of its own seeded from crypto/rand, so that nodes don't
+// share their picks.
+type broadcastSampler struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// setSource makes the sampler draw from src.
+func (s *broadcastSampler) setSource(src rand.Source) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rnd = rand.New(src)
+}
+
+// source returns the random source of the sampler, s.mu must be held.
+func (s *broadcastSampler) source() *rand.Rand {
+	if s.rnd == nil {
+		var seed [8]byte
+		if _, err := crand.Read(seed[:]); err != nil {
+			binary.BigEndian.PutUint64(seed[:], uint64(time.Now().UnixNano()))
+		}
+		s.rnd = rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(seed[:]))))
+	}
+	return s.rnd
+}
+
+// sample returns true with a probability of percent in 100.
+func (s *broadcastSampler) sample(percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.source().Intn(100) < percent
+}
+
+// jitter returns a random delay shorter than window.
+func (s *broadcastSampler) jitter(window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return time.Duration(s.source().Int63n(int64(window)))
+}
+
+// broadcastRole is the role of a node which decides whether it takes part in the crosslink
+// and heartbeat broadcasts.
+type broadcastRole interface {
+	// IsRunningBeaconChain returns true if the node runs the beacon chain.
+	IsRunningBeaconChain() bool
+	// IsCurrentlyLeader returns true if the node is the consensus leader of its shard.
+	IsCurrentlyLeader() bool
+}
+
+// broadcastRole returns the role of the node in the broadcasts, the node itself unless
+// another role is set, so that the broadcasts can be driven without a running consensus.
+func (node *Node) broadcastRole() broadcastRole {
+	if node.role != nil {
+		return node.role
+	}
+	return node
+}
+
+// samplePercent returns percent, or def if percent is zero. A negative percent disables sampling.
+func samplePercent(percent, def int) int {
+	if percent == 0 {
+		return def
+	}
+	return percent
+}
+
+// takesPartInBroadcast returns true if the node broadcasts in the current round, always
+// as leader, otherwise if picked by sampleBroadcast with a probability of percent in 100.
+func (node *Node) takesPartInBroadcast(leader bool, percent int) bool {
+	return leader || node.sampleBroadcast(percent)
+}
+
+// sampleBroadcast returns true if a non-leader takes part in a broadcast round, with a
+// probability of percent in 100. A sampled node waits a random delay first, to spread
+// the broadcasts of the sampled nodes instead of sending them all on the same tick.
+func (node *Node) sampleBroadcast(percent int) bool {
+	if !node.sampler.sample(percent) {
+		return false
+	}
+	window := node.NodeConfig.Handler.BroadcastSampleJitter
+	if window == 0 {
+		window = defaultBroadcastSampleJitter
+	}
+	delay := node.sampler.jitter(window)
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-node.shutdown.context().Done():
+		return false
+	}
+}
@@ -0,0 +1,242 @@
+package node
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/harmony-one/harmony/consensus"
+	"github.com/harmony-one/harmony/core"
+	"github.com/harmony-one/harmony/core/types"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"github.com/harmony-one/harmony/internal/registry"
+	"github.com/harmony-one/harmony/internal/utils/crosslinks"
+)
+
+// fixedSource is a rand.Source whose Intn(100) draws are always the same value.
+type fixedSource struct {
+	value int64
+	draws int
+}
+
+func (s *fixedSource) Int63() int64 {
+	s.draws++
+	// Intn takes the upper 31 bits of the 63 bits
+	return s.value << 32
+}
+
+func (s *fixedSource) Seed(int64) {}
+
+func TestBroadcastSamplerFrequency(t *testing.T) {
+	const rounds = 200000
+	var s broadcastSampler
+	for _, percent := range []int{defaultHeartbeatSamplePercent, defaultCrossLinkSamplePercent, 10} {
+		sampled := 0
+		for i := 0; i < rounds; i++ {
+			if s.sample(percent) {
+				sampled++
+			}
+		}
+		p := float64(percent) / 100
+		// 5 standard deviations of the binomial distribution
+		tolerance := 5 * math.Sqrt(p*(1-p)/rounds)
+		if freq := float64(sampled) / rounds; math.Abs(freq-p) > tolerance {
+			t.Errorf("percent %d: sampled %.4f of the rounds, expected %.4f ± %.4f", percent, freq, p, tolerance)
+		}
+	}
+	for _, percent := range []int{0, -1} {
+		if s.sample(percent) {
+			t.Errorf("percent %d: expected no sampling", percent)
+		}
+	}
+	if !s.sample(100) {
+		t.Error("percent 100: expected sampling")
+	}
+}
+
+func TestBroadcastSamplerJitter(t *testing.T) {
+	var s broadcastSampler
+	if d := s.jitter(0); d != 0 {
+		t.Errorf("expected no delay without window, got %v", d)
+	}
+	for i := 0; i < 1000; i++ {
+		if d := s.jitter(time.Second); d < 0 || d >= time.Second {
+			t.Fatalf("delay %v out of the window", d)
+		}
+	}
+}
+
+func TestSampleBroadcast(t *testing.T) {
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+	node.NodeConfig.Handler.BroadcastSampleJitter = -1
+	if !node.sampleBroadcast(100) {
+		t.Error("expected a sampled broadcast")
+	}
+	if node.sampleBroadcast(-1) {
+		t.Error("expected sampling disabled")
+	}
+
+	// a sampled node waiting for its delay gives up on shutdown
+	node.NodeConfig.Handler.BroadcastSampleJitter = time.Hour
+	node.shutdown.trigger()
+	done := make(chan bool)
+	go func() { done <- node.sampleBroadcast(100) }()
+	select {
+	case sampled := <-done:
+		if sampled {
+			t.Error("expected no broadcast after shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("sampled broadcast not stopped by shutdown")
+	}
+
+	if got := samplePercent(0, defaultCrossLinkSamplePercent); got != defaultCrossLinkSamplePercent {
+		t.Errorf("expected the default percent, got %d", got)
+	}
+	if got := samplePercent(5, defaultCrossLinkSamplePercent); got != 5 {
+		t.Errorf("expected the configured percent, got %d", got)
+	}
+}
+
+func TestTakesPartInBroadcast(t *testing.T) {
+	tests := []struct {
+		name   string
+		leader bool
+		value  int64
+		want   bool
+	}{
+		{"leader", true, 99, true},
+		{"sampled", false, 0, true},
+		{"not sampled", false, 1, false},
+	}
+	for _, test := range tests {
+		node := &Node{NodeConfig: &nodeconfig.ConfigType{}}
+		node.NodeConfig.Handler.BroadcastSampleJitter = -1
+		src := &fixedSource{value: test.value}
+		node.sampler.setSource(src)
+		if got := node.takesPartInBroadcast(test.leader, 1); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+		if test.leader && src.draws != 0 {
+			t.Errorf("%s: expected no draw for the leader, got %d", test.name, src.draws)
+		}
+	}
+}
+
+func TestBroadcastCrossLinkFromShardsToBeaconGate(t *testing.T) {
+	chain := currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}
+	for _, test := range []struct {
+		value   int64
+		outcome string
+	}{
+		{0, "sent"},
+		{defaultCrossLinkSamplePercent, "skipped_not_leader"},
+	} {
+		node := &Node{
+			host:       &recordingHost{},
+			Consensus:  &consensus.Consensus{},
+			NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+			registry:   registry.New().SetBlockchain(chain),
+			crosslinks: crosslinks.New(),
+		}
+		node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+		node.NodeConfig.Handler.BroadcastSampleJitter = -1
+		node.sampler.setSource(&fixedSource{value: test.value})
+
+		key := `hmy_node_crosslink_broadcast{outcome="` + test.outcome + `",shard="1"}`
+		before := node.MetricsSnapshot()[key]
+		node.BroadcastCrossLinkFromShardsToBeacon()
+		if after := node.MetricsSnapshot()[key]; after != before+1 {
+			t.Errorf("draw %d: expected %s to increment, got %v -> %v", test.value, key, before, after)
+		}
+	}
+}
+
+// fixedRole is a broadcastRole of fixed answers.
+type fixedRole struct {
+	beacon, leader bool
+}
+
+func (r fixedRole) IsRunningBeaconChain() bool { return r.beacon }
+func (r fixedRole) IsCurrentlyLeader() bool    { return r.leader }
+
+func TestTakesPartInHeartbeat(t *testing.T) {
+	tests := []struct {
+		name  string
+		role  fixedRole
+		value int64
+		want  bool
+	}{
+		{"shard chain leader", fixedRole{leader: true}, 0, false},
+		{"beacon chain leader", fixedRole{beacon: true, leader: true}, 99, true},
+		{"sampled beacon chain validator", fixedRole{beacon: true}, 0, true},
+		{"beacon chain validator", fixedRole{beacon: true}, 99, false},
+	}
+	for _, test := range tests {
+		node := &Node{NodeConfig: &nodeconfig.ConfigType{}, role: test.role}
+		node.NodeConfig.Handler.BroadcastSampleJitter = -1
+		node.sampler.setSource(&fixedSource{value: test.value})
+		if got := node.takesPartInHeartbeat(); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestShouldBroadcastCrosslinkRole(t *testing.T) {
+	chain := currentBlockChain{headerChain: headerChain{shardID: 1}, current: newTestBlock(1, 100)}
+	tests := []struct {
+		name    string
+		role    fixedRole
+		sampled bool
+		reason  string
+	}{
+		{"beacon chain", fixedRole{beacon: true, leader: true}, false, skipCrosslinkBeaconChain},
+		{"not leader", fixedRole{}, false, skipCrosslinkNotSampled},
+		{"leader", fixedRole{leader: true}, false, ""},
+		{"sampled", fixedRole{}, true, ""},
+	}
+	for _, test := range tests {
+		node := &Node{
+			NodeConfig: &nodeconfig.ConfigType{ShardID: 1},
+			registry:   registry.New().SetBlockchain(chain),
+			crosslinks: crosslinks.New(),
+			role:       test.role,
+		}
+		node.crosslinks.SetLastKnownCrosslinkHeartbeatSignal(&types.CrosslinkHeartbeat{ShardID: 1, LatestContinuousBlockNum: 90})
+		reasons, _ := node.shouldBroadcastCrosslink(chain.CurrentBlock(), time.Now(), test.sampled)
+		if test.reason == "" && len(reasons) != 0 {
+			t.Errorf("%s: expected a broadcast, got the skip reasons %v", test.name, reasons)
+		} else if test.reason != "" && (len(reasons) != 1 || reasons[0] != test.reason) {
+			t.Errorf("%s: expected the skip reason %q, got %v", test.name, test.reason, reasons)
+		}
+	}
+}
+
+func TestBroadcastHeartbeatsWithoutKeys(t *testing.T) {
+	key := `hmy_p2p_crosslink_msg{type="heartbeat_no_private_key"}`
+	beacon := currentBlockChain{headerChain: headerChain{shardID: 0}, current: newTestBlock(0, 100)}
+	for _, test := range []struct {
+		name   string
+		beacon core.BlockChain
+		counts float64
+	}{
+		{"crosslink epoch", beacon, 1},
+		{"before crosslink epoch", preCrossLinkChain{beacon}, 0},
+	} {
+		host := &recordingHost{}
+		node := &Node{
+			host:       host,
+			Consensus:  &consensus.Consensus{},
+			NodeConfig: &nodeconfig.ConfigType{},
+			role:       fixedRole{beacon: true, leader: true},
+		}
+		before := node.MetricsSnapshot()[key]
+		node.broadcastHeartbeats(test.beacon)
+		if got := node.MetricsSnapshot()[key] - before; got != test.counts {
+			t.Errorf("%s: expected %v heartbeats without keys, got %v", test.name, test.counts, got)
+		}
+		if host.sendCalls() != 0 {
+			t.Errorf("%s: expected no heartbeat sent, got %d", test.name, host.sendCalls())
+		}
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/harmony-one/harmony/internal/tikv"
 	"github.com/harmony-one/harmony/internal/utils"
 	"github.com/harmony-one/harmony/p2p"
+	sttypes "github.com/harmony-one/harmony/p2p/stream/types"
 	"github.com/harmony-one/harmony/shard"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/multiformats/go-multiaddr"
@@ -46,8 +47,17 @@ var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
 // BeaconSyncHook is the hook function called after inserted beacon in downloader
 // TODO: This is a small misc piece of consensus logic. Better put it to consensus module.
+// The broadcast runs in the background, as it may wait for the sampling jitter and for
+// send retries which must not hold the insertion of the beacon blocks back. The hook
+// does nothing while its previous broadcast still runs.
 func (node *Node) BeaconSyncHook() {
-	node.BroadcastCrossLinkFromShardsToBeacon()
+	if !node.beaconSyncBroadcasting.CompareAndSwap(false, true) {
+		return
+	}
+	node.goroutines.track(func() {
+		defer node.beaconSyncBroadcasting.Store(false)
+		node.BroadcastCrossLinkFromShardsToBeacon()
+	})
 }
 
 // GenerateRandomString generates a random string with given length
@@ -206,6 +216,7 @@ func (node *Node) doBeaconSyncing() {
 		go func(node *Node) {
 			// TODO ek – infinite loop; add shutdown/cleanup logic
 			for b := range node.BeaconBlockChannel {
+				nodeBeaconBlockQueueGauge.Set(float64(len(node.BeaconBlockChannel)))
 				if b != nil && b.IsLastBlockInEpoch() {
 					_, err := node.EpochChain().InsertChain(types.Blocks{b}, true)
 					if err != nil {
@@ -859,9 +870,13 @@ type Downloaders interface {
 	NumPeers() map[uint32]int
 	SyncStatus(shardID uint32) (bool, uint64, uint64)
 	IsActive() bool
+	SetPeerBlockNumber(shardID uint32, stid sttypes.StreamID, blockNumber uint64)
 }
 
 func (node *Node) getDownloaders() Downloaders {
+	if node.serviceManager == nil {
+		return nil
+	}
 	syncService := node.serviceManager.GetService(service.Synchronize)
 	if syncService == nil {
 		return nil
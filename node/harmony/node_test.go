@@ -25,6 +25,7 @@ import (
 	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
 	multihash "github.com/multiformats/go-multihash"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -242,3 +243,60 @@ func TestLocalSyncingPeerProvider(t *testing.T) {
 func makeLocalSyncingPeerProvider() *LocalSyncingPeerProvider {
 	return NewLocalSyncingPeerProvider(6000, 6001, 2, 3)
 }
+
+func TestMetricsSnapshot(t *testing.T) {
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "snapshot_test"}).Add(3)
+	CrossLinkPendingQueueGauge.Set(7)
+
+	snapshot := (&Node{}).MetricsSnapshot()
+	if v := snapshot[`hmy_p2p_node_msg{type="snapshot_test"}`]; v != 3 {
+		t.Errorf("expected counter value 3, got %v", v)
+	}
+	if v := snapshot["hmy_p2p_crosslink_pending_queue_size"]; v != 7 {
+		t.Errorf("expected gauge value 7, got %v", v)
+	}
+}
+
+func TestReadyWithHysteresis(t *testing.T) {
+	const minPeers = 10
+	tests := []struct {
+		wasReady bool
+		peers    int
+		margin   int
+		expected bool
+	}{
+		{false, 10, 0, true},
+		{true, 9, 0, false},
+		{false, 11, 2, false},
+		{false, 12, 2, true},
+		{true, 9, 2, true},
+		{true, 8, 2, true},
+		{true, 7, 2, false},
+	}
+	for i, test := range tests {
+		if got := readyWithHysteresis(test.wasReady, test.peers, minPeers, test.margin); got != test.expected {
+			t.Errorf("test %d: expected %v, got %v", i, test.expected, got)
+		}
+	}
+}
+
+func TestTxRequeue(t *testing.T) {
+	if isTransientPoolError([]error{nil, core.ErrNonceTooLow}) {
+		t.Error("expected nonce too low not to be transient")
+	}
+	if isTransientPoolError([]error{nil, core.ErrUnderpriced}) {
+		t.Error("expected below the minimum gas price not to be transient")
+	}
+	if !isTransientPoolError([]error{nil, errors.New("other"), core.ErrTxPoolFull}) {
+		t.Error("expected underpriced in a full pool to be transient")
+	}
+	if !isTransientPoolError([]error{core.ErrQueueCapExceeded}) {
+		t.Error("expected exceeding the queue caps to be transient")
+	}
+	if d := txRequeueDelay(0, 0); d != defaultTxRequeueBackoff {
+		t.Errorf("expected default backoff, got %v", d)
+	}
+	if d := txRequeueDelay(100*time.Millisecond, 2); d != 400*time.Millisecond {
+		t.Errorf("expected doubled backoff, got %v", d)
+	}
+}
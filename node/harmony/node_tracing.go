@@ -0,0 +1,33 @@
+package node
+
+import (
+	"context"
+
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// messageTracerName is the name of the tracer of node message handling.
+const messageTracerName = "github.com/harmony-one/harmony/node"
+
+// noopSpan is returned for the spans of a node with tracing disabled.
+var noopSpan = trace.SpanFromContext(context.Background())
+
+// newMessageTracer returns the tracer of node message handling, nil if tracing is disabled.
+func newMessageTracer(conf nodeconfig.HandlerConfig) trace.Tracer {
+	if !conf.MessageTracing {
+		return nil
+	}
+	return otel.Tracer(messageTracerName)
+}
+
+// startSpan starts a span named name as a child of the span of ctx. Without a tracer
+// it returns ctx and a span doing nothing, so that disabled tracing costs a nil check.
+func (node *Node) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if node.tracer == nil {
+		return ctx, noopSpan
+	}
+	return node.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
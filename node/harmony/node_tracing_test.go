@@ -0,0 +1,103 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordedSpan is a span kept in memory by a recordingTracer.
+type recordedSpan struct {
+	trace.Span
+	name   string
+	parent *recordedSpan
+	attrs  map[attribute.Key]attribute.Value
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...attribute.KeyValue) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordedSpan) End(...trace.SpanEndOption) {
+	s.ended = true
+}
+
+// recordingTracer is a trace.Tracer keeping the spans it starts in memory.
+type recordingTracer struct {
+	trace.Tracer
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	parent, _ := trace.SpanFromContext(ctx).(*recordedSpan)
+	s := &recordedSpan{
+		Span:   noopSpan,
+		name:   name,
+		parent: parent,
+		attrs:  make(map[attribute.Key]attribute.Value),
+	}
+	s.SetAttributes(trace.NewSpanStartConfig(opts...).Attributes()...)
+	t.spans = append(t.spans, s)
+	return trace.ContextWithSpan(ctx, s), s
+}
+
+func TestNewMessageTracer(t *testing.T) {
+	if tracer := newMessageTracer(nodeconfig.HandlerConfig{}); tracer != nil {
+		t.Error("expected no tracer with tracing disabled")
+	}
+	if tracer := newMessageTracer(nodeconfig.HandlerConfig{MessageTracing: true}); tracer == nil {
+		t.Error("expected a tracer with tracing enabled")
+	}
+
+	node := &Node{}
+	ctx := context.Background()
+	if spanCtx, span := node.startSpan(ctx, "test"); spanCtx != ctx || span.IsRecording() {
+		t.Error("expected a span doing nothing without a tracer")
+	}
+}
+
+func TestHandleNodeMessageSpans(t *testing.T) {
+	tracer := &recordingTracer{}
+	node := &Node{NodeConfig: &nodeconfig.ConfigType{ShardID: 1}, tracer: tracer}
+
+	// an empty staking transaction list, rejected by the pool of a non beacon shard
+	payload := []byte{byte(proto_node.Send), 0xc0}
+	if err := node.HandleNodeMessage(context.Background(), "", payload, proto_node.Staking); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tracer.spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(tracer.spans))
+	}
+	root, decode, insert := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	if root.name != "node.message.staking" || root.parent != nil {
+		t.Errorf("unexpected root span %q, parent %v", root.name, root.parent)
+	}
+	if got := root.attrs["payload_size"].AsInt64(); got != int64(len(payload)) {
+		t.Errorf("expected payload size %d, got %d", len(payload), got)
+	}
+	if got := root.attrs["shard_id"].AsInt64(); got != 1 {
+		t.Errorf("expected shard id 1, got %d", got)
+	}
+	if decode.name != "node.rlp_decode" || decode.parent != root {
+		t.Errorf("expected the decoding span as a child of the message span, got %q", decode.name)
+	}
+	if got := decode.attrs["txs"].AsInt64(); got != 0 {
+		t.Errorf("expected no decoded transactions, got %d", got)
+	}
+	if insert.name != "node.pool_insert" || insert.parent != root {
+		t.Errorf("expected the pool insertion span as a child of the message span, got %q", insert.name)
+	}
+	for _, s := range tracer.spans {
+		if !s.ended {
+			t.Errorf("span %q not ended", s.name)
+		}
+	}
+}
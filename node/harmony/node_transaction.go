@@ -0,0 +1,495 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/rlp"
+	proto_node "github.com/harmony-one/harmony/api/proto/node"
+	"github.com/harmony-one/harmony/core/types"
+	"github.com/harmony-one/harmony/internal/utils"
+	"github.com/harmony-one/harmony/internal/utils/lrucache"
+	staking "github.com/harmony-one/harmony/staking/types"
+	libp2p_peer "github.com/libp2p/go-libp2p/core/peer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/time/rate"
+)
+
+// decodeTxList decodes the transaction list of a transaction message of type msgType,
+// decompressing it first for a compressed list. A compressed list of more than maxBytes
+// decompressed is rejected as a whole, with an error for which isOversizedRLPList returns
+// true, the other lists are decoded as by decodeRLPList.
+func decodeTxList(ctx context.Context, msgType proto_node.TransactionMessageType, payload []byte, maxTxs, maxBytes int) ([]*types.Transaction, error) {
+	if msgType == proto_node.SendCompressed {
+		data, err := proto_node.DecompressTransactionList(payload, maxBytes)
+		if errors.Is(err, proto_node.ErrTransactionListTooLarge) {
+			return nil, errRLPListTooLarge
+		} else if err != nil {
+			return nil, errors.Wrap(err, "cannot decompress transaction list")
+		}
+		payload = data
+	}
+	return decodeRLPList[types.Transaction](ctx, payload, maxTxs, maxBytes)
+}
+
+const (
+	// defaultMaxTxsPerMessage is the default number of transactions of a message which are accepted.
+	defaultMaxTxsPerMessage = 4096
+	// defaultMaxTxListBytes is the default size of the transaction list of a message which is accepted.
+	defaultMaxTxListBytes = 4 * 1024 * 1024
+	// defaultTxGossipCompressThreshold is the default size from which the sent transaction lists are compressed.
+	defaultTxGossipCompressThreshold = 1024
+)
+
+// maxTxsPerMessage returns the number of transactions of a message which are accepted.
+func (node *Node) maxTxsPerMessage() int {
+	if n := node.NodeConfig.Handler.MaxTxsPerMessage; n > 0 {
+		return n
+	}
+	return defaultMaxTxsPerMessage
+}
+
+// maxTxListBytes returns the size of the transaction list of a message which is accepted.
+func (node *Node) maxTxListBytes() int {
+	if n := node.NodeConfig.Handler.MaxTxListBytes; n > 0 {
+		return n
+	}
+	return defaultMaxTxListBytes
+}
+
+// txGossipCompressThreshold returns the size from which the transaction lists sent by the
+// node are compressed, zero if they are not compressed. The compressed lists are sent from
+// the MessageVersion2Epoch only.
+func (node *Node) txGossipCompressThreshold() int {
+	n := node.NodeConfig.Handler.TxGossipCompressThreshold
+	if n < 0 || !node.sendsMessageVersion2() {
+		return 0
+	}
+	if n > 0 {
+		return n
+	}
+	return defaultTxGossipCompressThreshold
+}
+
+const (
+	// defaultTxGossipRateBurst is the number of transaction messages a peer can send at once
+	defaultTxGossipRateBurst = 100
+	// defaultTxRequestRateLimit is the number of transaction announces and requests per second
+	// processed from each peer
+	defaultTxRequestRateLimit = 10
+	// defaultTxRequestRateBurst is the number of transaction announces and requests a peer can
+	// send at once
+	defaultTxRequestRateBurst = 50
+	// maxTxGossipPeers is the number of peers whose transaction message rate is tracked
+	maxTxGossipPeers = 1024
+)
+
+// txGossipRateLimiter limits the transaction messages processed from each peer.
+type txGossipRateLimiter struct {
+	mu       sync.Mutex
+	limiters *lrucache.Cache[libp2p_peer.ID, *rate.Limiter]
+	// now returns the current time, time.Now if nil
+	now func() time.Time
+}
+
+// allow returns true if one more transaction message of peer is within the rate limit.
+// A limit which is not positive disables the limit.
+func (l *txGossipRateLimiter) allow(peer libp2p_peer.ID, limit float64, burst int) bool {
+	if limit <= 0 || peer == "" {
+		return true
+	}
+	if burst <= 0 {
+		burst = defaultTxGossipRateBurst
+	}
+	now := time.Now
+	if l.now != nil {
+		now = l.now
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limiters == nil {
+		l.limiters = lrucache.NewCache[libp2p_peer.ID, *rate.Limiter](maxTxGossipPeers)
+	}
+	limiter, ok := l.limiters.Get(peer)
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(limit), burst)
+		l.limiters.Set(peer, limiter)
+	}
+	return limiter.AllowN(now(), 1)
+}
+
+// txRequestRateLimit returns the number of transaction announces and requests per second
+// processed from each peer, negative if not limited.
+func (node *Node) txRequestRateLimit() (float64, int) {
+	limit, burst := node.NodeConfig.Handler.TxRequestRateLimit, node.NodeConfig.Handler.TxRequestRateBurst
+	if limit == 0 {
+		limit = defaultTxRequestRateLimit
+	}
+	if burst <= 0 {
+		burst = defaultTxRequestRateBurst
+	}
+	return limit, burst
+}
+
+// allowTxRequest returns true if one more transaction announce or request of peer is within
+// the rate limit, and counts it as rate limited otherwise.
+func (node *Node) allowTxRequest(peer libp2p_peer.ID, counter string) bool {
+	limit, burst := node.txRequestRateLimit()
+	if node.txRequestLimiter.allow(peer, limit, burst) {
+		return true
+	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counter}).Inc()
+	return false
+}
+
+// transactionMessageHandler handles a transaction message published by MessagePeer(ctx).
+// It stops early once ctx is done.
+func (node *Node) transactionMessageHandler(ctx context.Context, msgPayload []byte) error {
+	if len(msgPayload) == 0 {
+		return errors.New("empty payload for transaction message")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	peerID := MessagePeer(ctx)
+	txMessageType := proto_node.TransactionMessageType(msgPayload[0])
+
+	switch txMessageType {
+	case proto_node.Send, proto_node.SendCompressed:
+		if !node.txGossipLimiter.allow(peerID, node.NodeConfig.Handler.TxGossipRateLimit, node.NodeConfig.Handler.TxGossipRateBurst) {
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_rate_limited"}).Inc()
+			return nil
+		}
+		_, span := node.startSpan(ctx, "node.rlp_decode", attribute.Int("payload_size", len(msgPayload)-1))
+		txs, err := decodeTxList(
+			ctx, txMessageType, msgPayload[1:], node.maxTxsPerMessage(), node.maxTxListBytes(),
+		) // skip the Send messge type
+		span.SetAttributes(attribute.Int("txs", len(txs)))
+		span.End()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if isOversizedRLPList(err) {
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_batch_oversized"}).Inc()
+			return errors.WithMessagef(err, "rejected transaction list from peer %s", peerID)
+		} else if err != nil {
+			if !node.NodeConfig.Handler.SalvagePartialTxDecode || len(txs) == 0 {
+				return errors.WithMessage(err, "failed to deserialize transaction list")
+			}
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_partial_decode"}).Inc()
+			utils.Logger().Warn().
+				Err(err).
+				Int("salvaged", len(txs)).
+				Msg("Transaction list partially deserialized")
+		}
+		txs = dedupByHash(txs, "tx_duplicate_in_batch")
+		txs = node.seenTxs.filter(txs, node.NodeConfig.Handler.SeenTxCacheSize)
+		txs = dropInvalidSignatures(&node.sampler, txs, node.NodeConfig.Handler.TxSignatureCheckPercent, "tx_invalid_signature")
+		node.addGossipedTransactions(ctx, txs, 0)
+	case proto_node.Unlock:
+		// no longer sent, ignored
+	case proto_node.Announce:
+		return node.handleTxAnnounce(ctx, RelayPeer(ctx), msgPayload[1:])
+	case proto_node.Request:
+		if !isDirectMessage(ctx) {
+			// a published request would have every holder reply to the requester
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_request_not_direct"}).Inc()
+			return nil
+		}
+		return node.handleTxRequest(ctx, peerID, msgPayload[1:])
+	default:
+		return unknownTxMessageType(peerID, txMessageType, "tx_unknown_type")
+	}
+	return nil
+}
+
+// stakingMessageHandler handles a staking transaction message published by MessagePeer(ctx).
+// It stops early once ctx is done.
+func (node *Node) stakingMessageHandler(ctx context.Context, msgPayload []byte) error {
+	if len(msgPayload) == 0 {
+		return errors.New("empty payload for staking transaction message")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	peerID := MessagePeer(ctx)
+	txMessageType := proto_node.TransactionMessageType(msgPayload[0])
+
+	switch txMessageType {
+	case proto_node.Send:
+		_, span := node.startSpan(ctx, "node.rlp_decode", attribute.Int("payload_size", len(msgPayload)-1))
+		txs, err := decodeRLPList[staking.StakingTransaction](
+			ctx, msgPayload[1:], node.maxTxsPerMessage(), node.maxTxListBytes(),
+		) // skip the Send message type
+		span.SetAttributes(attribute.Int("txs", len(txs)))
+		span.End()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if isOversizedRLPList(err) {
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "staking_tx_batch_oversized"}).Inc()
+			return errors.WithMessagef(err, "rejected staking transaction list from peer %s", peerID)
+		} else if err != nil {
+			if !node.NodeConfig.Handler.SalvagePartialTxDecode || len(txs) == 0 {
+				return errors.WithMessage(err, "failed to deserialize staking transaction list")
+			}
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "staking_tx_partial_decode"}).Inc()
+			utils.Logger().Warn().
+				Err(err).
+				Int("salvaged", len(txs)).
+				Msg("Staking transaction list partially deserialized")
+		}
+		txs = dedupByHash(txs, "staking_tx_duplicate_in_batch")
+		txs = dropInvalidSignatures(&node.sampler, txs, node.NodeConfig.Handler.TxSignatureCheckPercent, "staking_tx_invalid_signature")
+		_, span = node.startSpan(ctx, "node.pool_insert", attribute.Int("txs", len(txs)))
+		node.addPendingStakingTransactions(ctx, txs, txSourceGossip)
+		span.End()
+	case proto_node.Unlock:
+		// no longer sent, ignored
+	default:
+		return unknownTxMessageType(peerID, txMessageType, "staking_tx_unknown_type")
+	}
+	return nil
+}
+
+var errUnknownTxMessageType = errors.New("unknown transaction message type")
+
+// unknownTxMessageType counts under counter and logs a transaction message of an unknown
+// type received from peerID, and returns the error reporting it.
+func unknownTxMessageType(peerID libp2p_peer.ID, txMessageType proto_node.TransactionMessageType, counter string) error {
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counter}).Inc()
+	utils.Logger().Warn().
+		Str("peer", peerID.String()).
+		Int("txMessageType", int(txMessageType)).
+		Msg("received transaction message of unknown type")
+	return errors.WithMessagef(errUnknownTxMessageType, "type %d from peer %s", txMessageType, peerID)
+}
+
+// txLookup finds the transactions of the pool by hash.
+type txLookup interface {
+	Get(hash common.Hash) types.PoolTransaction
+}
+
+// getTxLookup returns the lookup of the transactions the node has, the pool unless
+// another lookup is set.
+func (node *Node) getTxLookup() txLookup {
+	if node.txLookup != nil {
+		return node.txLookup
+	}
+	return node.TxPool
+}
+
+// handleTxAnnounce requests directly from peerID, which relayed the announce, the
+// transactions of the announce which are neither in the pool, nor seen or requested
+// recently. The request is sent in the background.
+func (node *Node) handleTxAnnounce(ctx context.Context, peerID libp2p_peer.ID, payload []byte) error {
+	if peerID == "" {
+		// nobody to request the transactions from
+		return nil
+	}
+	if !node.allowTxRequest(peerID, "tx_announce_rate_limited") {
+		return nil
+	}
+	hashes, err := decodeRLPList[common.Hash](ctx, payload, node.maxTxsPerMessage(), node.maxTxListBytes())
+	if isOversizedRLPList(err) {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_announce_oversized"}).Inc()
+		return errors.WithMessagef(err, "rejected transaction announce from peer %s", peerID)
+	} else if err != nil {
+		return errors.WithMessage(err, "failed to deserialize transaction announce")
+	}
+	pool := node.getTxLookup()
+	unknown := make([]common.Hash, 0, len(hashes))
+	for _, h := range hashes {
+		if pool.Get(*h) == nil && !node.seenTxs.contains(*h) {
+			unknown = append(unknown, *h)
+		}
+	}
+	unknown = node.requestedTxs.remember(unknown, node.NodeConfig.Handler.SeenTxCacheSize)
+	if len(unknown) == 0 {
+		return nil
+	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_request_sent"}).Inc()
+	msg := proto_node.ConstructTransactionRequestMessage(proto_node.TransactionRequest{Hashes: unknown})
+	node.goSpawn("tx_request", func() {
+		if err := node.host.SendMessageToPeer(node.shutdown.context(), peerID, msg); err != nil {
+			utils.Logger().Debug().Err(err).
+				Str("peer", peerID.String()).
+				Msg("[handleTxAnnounce] could not request transactions")
+		}
+	})
+	return nil
+}
+
+// handleTxRequest sends the transactions of the pool requested by peerID back to it.
+func (node *Node) handleTxRequest(ctx context.Context, peerID libp2p_peer.ID, payload []byte) error {
+	if !node.allowTxRequest(peerID, "tx_request_rate_limited") {
+		return nil
+	}
+	if maxBytes := node.maxTxListBytes(); len(payload) > maxBytes {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_request_oversized"}).Inc()
+		return errRLPListTooLarge
+	}
+	var req proto_node.TransactionRequest
+	if err := rlp.DecodeBytes(payload, &req); err != nil {
+		return errors.WithMessage(err, "failed to deserialize transaction request")
+	}
+	if len(req.Hashes) > node.maxTxsPerMessage() {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_request_oversized"}).Inc()
+		return errTooManyRLPItems
+	}
+	pool := node.getTxLookup()
+	var txs types.Transactions
+	for _, h := range req.Hashes {
+		if tx, ok := pool.Get(h).(*types.Transaction); ok {
+			txs = append(txs, tx)
+		}
+	}
+	if len(txs) == 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_request_served"}).Inc()
+	msg := proto_node.ConstructTransactionListMessageCompressed(txs, node.txGossipCompressThreshold())
+	return node.host.SendMessageToPeer(ctx, peerID, msg)
+}
+
+// defaultSeenTxCacheSize is the number of recently gossiped transaction hashes remembered.
+const defaultSeenTxCacheSize = 8192
+
+// seenTxCache remembers the hashes of recently gossiped transactions, so that transactions
+// received through several peers are added to the pool once.
+type seenTxCache struct {
+	mu     sync.Mutex
+	hashes *lrucache.Cache[common.Hash, struct{}]
+}
+
+// filter drops the transactions seen recently, keeping the order of the others, which are
+// remembered from now on, before their signatures are checked: a transaction rejected by
+// the pool for a transient reason is forgotten afterwards. A zero size uses the default, a
+// negative one disables the cache.
+func (c *seenTxCache) filter(txs types.Transactions, size int) types.Transactions {
+	if size < 0 || len(txs) == 0 {
+		return txs
+	}
+	if size == 0 {
+		size = defaultSeenTxCacheSize
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hashes == nil {
+		c.hashes = lrucache.NewCache[common.Hash, struct{}](size)
+	}
+	unseen := txs[:0]
+	for _, tx := range txs {
+		h := tx.Hash()
+		if c.hashes.Contains(h) {
+			continue
+		}
+		c.hashes.Set(h, struct{}{})
+		unseen = append(unseen, tx)
+	}
+	if hits := len(txs) - len(unseen); hits > 0 {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_seen_hit"}).Add(float64(hits))
+	}
+	if len(unseen) > 0 {
+		nodeNodeMessageCounterVec.With(prometheus.Labels{"type": "tx_seen_miss"}).Add(float64(len(unseen)))
+	}
+	return unseen
+}
+
+// forget drops txs from the recently seen transactions.
+func (c *seenTxCache) forget(txs types.Transactions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hashes == nil {
+		return
+	}
+	for _, tx := range txs {
+		c.hashes.Remove(tx.Hash())
+	}
+}
+
+// contains reports whether the transaction of hash was seen recently.
+func (c *seenTxCache) contains(hash common.Hash) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hashes != nil && c.hashes.Contains(hash)
+}
+
+// remember returns the hashes not seen recently, which are remembered from now on. A
+// zero size uses the default, a negative one disables the cache.
+func (c *seenTxCache) remember(hashes []common.Hash, size int) []common.Hash {
+	if size < 0 || len(hashes) == 0 {
+		return hashes
+	}
+	if size == 0 {
+		size = defaultSeenTxCacheSize
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hashes == nil {
+		c.hashes = lrucache.NewCache[common.Hash, struct{}](size)
+	}
+	unseen := hashes[:0]
+	for _, h := range hashes {
+		if c.hashes.Contains(h) {
+			continue
+		}
+		c.hashes.Set(h, struct{}{})
+		unseen = append(unseen, h)
+	}
+	return unseen
+}
+
+// dedupByHash drops the repeated transactions of a batch, keeping the first occurrence.
+func dedupByHash[T interface{ Hash() common.Hash }](txs []T, counterType string) []T {
+	if len(txs) < 2 {
+		return txs
+	}
+	seen := make(map[common.Hash]struct{}, len(txs))
+	unique := txs[:0]
+	for _, tx := range txs {
+		h := tx.Hash()
+		if _, ok := seen[h]; ok {
+			nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counterType}).Inc()
+			continue
+		}
+		seen[h] = struct{}{}
+		unique = append(unique, tx)
+	}
+	return unique
+}
+
+// dropInvalidSignatures verifies the signature of the given percentage of transactions,
+// picked by sampler, and drops those whose sender cannot be recovered.
+func dropInvalidSignatures[T interface {
+	SenderAddress() (common.Address, error)
+}](sampler *broadcastSampler, txs []T, percent int, counterType string) []T {
+	if percent <= 0 {
+		return txs
+	}
+	valid := txs[:0]
+	for _, tx := range txs {
+		if percent >= 100 || sampler.sample(percent) {
+			if _, err := tx.SenderAddress(); err != nil {
+				nodeNodeMessageCounterVec.With(prometheus.Labels{"type": counterType}).Inc()
+				utils.Logger().Debug().Err(err).Msg("Dropping transaction with invalid signature")
+				continue
+			}
+		}
+		valid = append(valid, tx)
+	}
+	return valid
+}
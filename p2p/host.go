@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"os"
@@ -78,7 +79,15 @@ type Host interface {
 	// AddStreamProtocol add the given protocol
 	AddStreamProtocol(protocols ...sttypes.Protocol)
 	// SendMessageToGroups sends a message to one or more multicast groups.
+	// Gossipsub flood publishes own messages to all the known peers of a group, it has
+	// no way to limit the fanout of a single message to a subset of them.
 	SendMessageToGroups(groups []nodeconfig.GroupID, msg []byte) error
+	// SendMessageToPeer sends a message to a single peer over a DirectMessageProtocol
+	// stream, for the replies which are of no use to the rest of a group.
+	SendMessageToPeer(ctx context.Context, id libp2p_peer.ID, msg []byte) error
+	// SetDirectMessageHandler sets the handler of the messages of at most maxSize bytes
+	// sent to this host with SendMessageToPeer.
+	SetDirectMessageHandler(handler DirectMessageHandler, maxSize int)
 	PubSub() *libp2p_pubsub.PubSub
 	PeerConnectivity() (int, int, int)
 	GetOrJoin(topic string) (*libp2p_pubsub.Topic, error)
@@ -96,6 +105,9 @@ type Host interface {
 	TrustedMinPeers() int
 }
 
+// DirectMessageHandler handles a message sent directly to the host by the peer from.
+type DirectMessageHandler func(from libp2p_peer.ID, msg []byte)
+
 // Peer is the object for a p2p peer (node)
 type Peer struct {
 	IP              string         // IP address of the peer
@@ -114,6 +126,13 @@ const (
 	MaxMessageHandlers = SetAsideForConsensus + SetAsideOtherwise
 	// MaxMessageSize is 2Mb
 	MaxMessageSize = 1 << 21
+	// DirectMessageProtocol is the stream protocol of the messages sent to a single peer
+	DirectMessageProtocol = protocol.ID("/harmony/direct/1.0.0")
+	// DirectMessageTimeout bounds the sending and the reading of a direct message
+	DirectMessageTimeout = 10 * time.Second
+	// MaxDirectMessageStreams is the number of direct messages read and handled at the same
+	// time, the streams above it are reset
+	MaxDirectMessageStreams = 64
 )
 
 // HostConfig is the config structure to create a new host
@@ -479,6 +498,7 @@ func NewHost(cfg HostConfig) (Host, error) {
 		cancel:                  cancel,
 		banned:                  banned,
 		trustedPeersInitiated:   abool.New(),
+		directStreams:           make(chan struct{}, MaxDirectMessageStreams),
 	}
 
 	// Set trusted peers as initiated immediately if:
@@ -592,6 +612,7 @@ type HostV2 struct {
 	cancel                  func()
 	banned                  *blockedpeers.Manager
 	trustedPeersInitiated   *abool.AtomicBool
+	directStreams           chan struct{}
 }
 
 // PubSub ..
@@ -696,6 +717,55 @@ func (host *HostV2) SendMessageToGroups(groups []nodeconfig.GroupID, msg []byte)
 	return err
 }
 
+// SendMessageToPeer sends msg to the peer id over a new DirectMessageProtocol stream.
+// Peers not supporting the protocol fail the stream negotiation.
+func (host *HostV2) SendMessageToPeer(ctx context.Context, id libp2p_peer.ID, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, DirectMessageTimeout)
+	defer cancel()
+	st, err := host.h.NewStream(ctx, id, DirectMessageProtocol)
+	if err != nil {
+		return errors.Wrapf(err, "cannot open direct stream to peer %s", id)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := st.SetWriteDeadline(deadline); err != nil {
+		st.Reset()
+		return err
+	}
+	if _, err := st.Write(msg); err != nil {
+		st.Reset()
+		return errors.Wrapf(err, "cannot send direct message to peer %s", id)
+	}
+	return st.Close()
+}
+
+// SetDirectMessageHandler sets the handler of the DirectMessageProtocol streams. A message
+// larger than maxSize bytes or not read within DirectMessageTimeout is dropped, as are the
+// messages received while MaxDirectMessageStreams others are being read or handled.
+func (host *HostV2) SetDirectMessageHandler(handler DirectMessageHandler, maxSize int) {
+	host.h.SetStreamHandler(DirectMessageProtocol, func(st libp2p_network.Stream) {
+		select {
+		case host.directStreams <- struct{}{}:
+			defer func() { <-host.directStreams }()
+		default:
+			host.logger.Debug().Str("peer", st.Conn().RemotePeer().String()).Msg("too many direct messages")
+			st.Reset()
+			return
+		}
+		if err := st.SetReadDeadline(time.Now().Add(DirectMessageTimeout)); err != nil {
+			st.Reset()
+			return
+		}
+		msg, err := io.ReadAll(io.LimitReader(st, int64(maxSize)+1))
+		if err != nil || len(msg) > maxSize {
+			host.logger.Debug().Err(err).Int("size", len(msg)).Msg("dropped direct message")
+			st.Reset()
+			return
+		}
+		st.Close()
+		handler(st.Conn().RemotePeer(), msg)
+	})
+}
+
 // AddPeer add p2p.Peer into Peerstore
 func (host *HostV2) AddPeer(p *Peer) error {
 	if p.PeerID != "" && len(p.Addrs) != 0 {
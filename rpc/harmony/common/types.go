@@ -2,6 +2,7 @@ package common
 
 import (
 	"encoding/json"
+	"time"
 
 	harmonyconfig "github.com/harmony-one/harmony/internal/configs/harmony"
 	nodeconfig "github.com/harmony-one/harmony/internal/configs/node"
@@ -89,3 +90,16 @@ type Config struct {
 	NodeConfig    nodeconfig.ConfigType
 	ChainConfig   params.ChainConfig
 }
+
+// HandlerConfig is the node message handling and broadcasting configuration in effect
+type HandlerConfig struct {
+	nodeconfig.HandlerConfig
+	BlockBroadcastEnabled bool
+}
+
+// BreakerStatus is the state of the broadcast circuit breaker of a group
+type BreakerStatus struct {
+	Open      bool      `json:"open"`
+	Failures  int       `json:"failures"`
+	OpenUntil time.Time `json:"open-until"`
+}
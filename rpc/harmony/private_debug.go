@@ -2,6 +2,7 @@ package rpc
 
 import (
 	"context"
+	"time"
 
 	"github.com/harmony-one/harmony/eth/rpc"
 	"github.com/harmony-one/harmony/hmy"
@@ -58,3 +59,35 @@ func (s *PrivateDebugService) GetConfig(
 ) (StructuredResponse, error) {
 	return NewStructuredResponse(s.hmy.NodeAPI.GetConfig())
 }
+
+// GetHandlerConfig get the node message handling and broadcasting config in effect
+func (s *PrivateDebugService) GetHandlerConfig(
+	ctx context.Context,
+) (StructuredResponse, error) {
+	return NewStructuredResponse(s.hmy.NodeAPI.HandlerConfig())
+}
+
+// GetQuarantinedPeers get the peers whose crosslinks are dropped, with the end of their quarantine
+func (s *PrivateDebugService) GetQuarantinedPeers(
+	ctx context.Context,
+) (StructuredResponse, error) {
+	peers := make(map[string]time.Time)
+	for id, until := range s.hmy.NodeAPI.QuarantinedPeers() {
+		peers[id.String()] = until
+	}
+	return NewStructuredResponse(peers)
+}
+
+// GetBroadcastBreakerState get the broadcast circuit breaker state of the groups with send failures
+func (s *PrivateDebugService) GetBroadcastBreakerState(
+	ctx context.Context,
+) (StructuredResponse, error) {
+	return NewStructuredResponse(s.hmy.NodeAPI.BroadcastBreakerState())
+}
+
+// ResetBroadcastBreaker close the broadcast circuit breaker of a group
+func (s *PrivateDebugService) ResetBroadcastBreaker(
+	ctx context.Context, group string,
+) bool {
+	return s.hmy.NodeAPI.ResetBroadcastBreaker(group)
+}